@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strconv"
+	"time"
+
+	"fiatjaf.com/nostr"
+	"fiatjaf.com/nostr/nip19"
+	qt "github.com/mappu/miqt/qt6"
+	"github.com/mappu/miqt/qt6/mainthread"
+)
+
+// address returns the "kind:pubkey:d" reference for addressable events, or "" for everything else.
+func address(evt nostr.Event) string {
+	if !evt.Kind.IsAddressable() {
+		return ""
+	}
+	return strconv.Itoa(int(evt.Kind)) + ":" + evt.PubKey.Hex() + ":" + evt.Tags.GetD()
+}
+
+// buildReply follows nip10 for replies to kind 1 and nip22 comments for everything else.
+func buildReply(target nostr.Event, hint string) nostr.Event {
+	if target.Kind != 1 {
+		return buildComment(target, hint)
+	}
+
+	reply := nostr.Event{Kind: 1, CreatedAt: nostr.Now()}
+
+	// find the root, either marked or the first positional e tag
+	var root nostr.Tag
+	for _, tag := range target.Tags {
+		if len(tag) >= 4 && tag[0] == "e" && tag[3] == "root" {
+			root = tag
+			break
+		}
+	}
+	if root == nil {
+		if first := target.Tags.Find("e"); first != nil {
+			root = first
+		}
+	}
+
+	if root != nil {
+		rootTag := nostr.Tag{"e", root[1], "", "root"}
+		if len(root) >= 3 {
+			rootTag[2] = root[2]
+		}
+		if len(root) >= 5 {
+			rootTag = append(rootTag, root[4])
+		}
+		reply.Tags = append(reply.Tags, rootTag, nostr.Tag{"e", target.ID.Hex(), hint, "reply", target.PubKey.Hex()})
+	} else {
+		reply.Tags = append(reply.Tags, nostr.Tag{"e", target.ID.Hex(), hint, "root", target.PubKey.Hex()})
+	}
+
+	// notify the author and everybody who was already in the thread
+	reply.Tags = append(reply.Tags, nostr.Tag{"p", target.PubKey.Hex(), hint})
+	for tag := range target.Tags.FindAll("p") {
+		if reply.Tags.FindWithValue("p", tag[1]) == nil {
+			reply.Tags = append(reply.Tags, nostr.Tag{"p", tag[1]})
+		}
+	}
+
+	return reply
+}
+
+func buildComment(target nostr.Event, hint string) nostr.Event {
+	comment := nostr.Event{Kind: nostr.KindComment, CreatedAt: nostr.Now()}
+	kind := strconv.Itoa(int(target.Kind))
+
+	if target.Kind == nostr.KindComment {
+		// same root as the parent comment
+		for _, tag := range target.Tags {
+			if len(tag) >= 2 && slices.Contains([]string{"E", "A", "I", "K", "P"}, tag[0]) {
+				comment.Tags = append(comment.Tags, tag)
+			}
+		}
+	} else {
+		// the target is the root itself
+		if addr := address(target); addr != "" {
+			comment.Tags = append(comment.Tags, nostr.Tag{"A", addr, hint})
+		}
+		comment.Tags = append(comment.Tags,
+			nostr.Tag{"E", target.ID.Hex(), hint, target.PubKey.Hex()},
+			nostr.Tag{"K", kind},
+			nostr.Tag{"P", target.PubKey.Hex(), hint},
+		)
+	}
+
+	// the parent is always the target
+	if addr := address(target); addr != "" {
+		comment.Tags = append(comment.Tags, nostr.Tag{"a", addr, hint})
+	}
+	comment.Tags = append(comment.Tags,
+		nostr.Tag{"e", target.ID.Hex(), hint, target.PubKey.Hex()},
+		nostr.Tag{"k", kind},
+		nostr.Tag{"p", target.PubKey.Hex(), hint},
+	)
+
+	return comment
+}
+
+func buildQuote(target nostr.Event, hint string) nostr.Event {
+	var relays []string
+	if hint != "" {
+		relays = []string{hint}
+	}
+
+	quote := nostr.Event{Kind: 1, CreatedAt: nostr.Now()}
+	if addr := address(target); addr != "" {
+		quote.Content = "\n\nnostr:" + nip19.EncodeNaddr(target.PubKey, target.Kind, target.Tags.GetD(), relays)
+		quote.Tags = nostr.Tags{{"q", addr, hint, target.PubKey.Hex()}}
+	} else {
+		quote.Content = "\n\nnostr:" + nip19.EncodeNevent(target.ID, relays, target.PubKey)
+		quote.Tags = nostr.Tags{{"q", target.ID.Hex(), hint, target.PubKey.Hex()}}
+	}
+	quote.Tags = append(quote.Tags, nostr.Tag{"p", target.PubKey.Hex()})
+	return quote
+}
+
+// buildRepost uses kind 6 for notes and kind 16 generic reposts for everything else.
+func buildRepost(target nostr.Event, hint string) nostr.Event {
+	repost := nostr.Event{Kind: 6, CreatedAt: nostr.Now()}
+	if target.Kind != 1 {
+		repost.Kind = 16
+	}
+
+	// protected events shouldn't be embedded
+	if !target.Tags.Has("-") {
+		j, _ := json.Marshal(target)
+		repost.Content = string(j)
+	}
+	repost.Tags = nostr.Tags{
+		{"e", target.ID.Hex(), hint},
+		{"p", target.PubKey.Hex()},
+	}
+	if repost.Kind == 16 {
+		repost.Tags = append(repost.Tags, nostr.Tag{"k", strconv.Itoa(int(target.Kind))})
+		if addr := address(target); addr != "" {
+			repost.Tags = append(repost.Tags, nostr.Tag{"a", addr, hint})
+		}
+	}
+	return repost
+}
+
+func buildReaction(target nostr.Event, hint string) nostr.Event {
+	reaction := nostr.Event{
+		Kind:      7,
+		CreatedAt: nostr.Now(),
+		Content:   "+",
+		Tags: nostr.Tags{
+			{"e", target.ID.Hex(), hint, target.PubKey.Hex()},
+			{"p", target.PubKey.Hex(), hint},
+			{"k", strconv.Itoa(int(target.Kind))},
+		},
+	}
+	if addr := address(target); addr != "" {
+		reaction.Tags = append(reaction.Tags, nostr.Tag{"a", addr, hint, target.PubKey.Hex()})
+	}
+	return reaction
+}
+
+// startAction finds a relay hint for the target author, then fills the event tab with what build returns.
+func startAction(target nostr.Event, build func(target nostr.Event, hint string) nostr.Event) {
+	statusLabel.SetText("looking for a relay hint...")
+	go func() {
+		hintCtx, cancel := context.WithTimeout(ctx, time.Second*3)
+		defer cancel()
+
+		hint := ""
+		if relays := sys.FetchOutboxRelays(hintCtx, target.PubKey, 1); len(relays) > 0 {
+			hint = relays[0]
+		}
+
+		mainthread.Wait(func() {
+			statusLabel.SetText("")
+			event.populate(build(target, hint))
+			tabWidget.SetCurrentIndex(tabIndexes.event)
+		})
+	}()
+}
+
+// addEventActions adds reply, quote, repost and react buttons acting on whatever getTarget returns.
+func addEventActions(layout *qt.QHBoxLayout, parent *qt.QWidget, getTarget func() (nostr.Event, bool)) {
+	for _, action := range []struct {
+		label string
+		build func(nostr.Event, string) nostr.Event
+	}{
+		{"reply", buildReply},
+		{"quote", buildQuote},
+		{"repost", buildRepost},
+		{"react", buildReaction},
+	} {
+		button := qt.NewQPushButton5(action.label, parent)
+		layout.AddWidget(button.QWidget)
+		button.OnClicked(func() {
+			if target, ok := getTarget(); ok {
+				startAction(target, action.build)
+			}
+		})
+	}
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"fiatjaf.com/nostr"
+	qt "github.com/mappu/miqt/qt6"
+	"github.com/mappu/miqt/qt6/mainthread"
+)
+
+type articlesVars struct {
+	tab *qt.QWidget
+
+	articlesList    *qt.QListWidget
+	titleEdit       *qt.QLineEdit
+	summaryEdit     *qt.QLineEdit
+	imageEdit       *qt.QLineEdit
+	publishedAtEdit *qt.QDateTimeEdit
+	dEdit           *qt.QLineEdit
+	hashtagsEdit    *qt.QLineEdit
+	sourceEdit      *qt.QTextEdit
+	previewEdit     *qt.QTextEdit
+	relaysEdit      *qt.QLineEdit
+	resultLabel     *qt.QLabel
+
+	articles []nostr.Event
+	editing  *nostr.Event
+}
+
+var articleManagedTags = []string{"d", "title", "summary", "image", "published_at", "t"}
+
+var slugInvalid = regexp.MustCompile(`[^a-z0-9]+`)
+
+var articles = &articlesVars{}
+
+func setupArticlesTab() *qt.QWidget {
+	articles.tab = qt.NewQWidget(window.QWidget)
+	layout := qt.NewQHBoxLayout2()
+	articles.tab.SetLayout(layout.QLayout)
+
+	// existing articles
+	listVBox := qt.NewQVBoxLayout2()
+	layout.AddLayout(listVBox.QLayout)
+	loadButton := qt.NewQPushButton5("load my articles", articles.tab)
+	listVBox.AddWidget(loadButton.QWidget)
+	loadButton.OnClicked(articles.load)
+	articles.articlesList = qt.NewQListWidget(articles.tab)
+	articles.articlesList.SetMaximumWidth(300)
+	listVBox.AddWidget(articles.articlesList.QWidget)
+	articles.articlesList.OnItemDoubleClicked(func(item *qt.QListWidgetItem) {
+		if row := articles.articlesList.Row(item); row >= 0 && row < len(articles.articles) {
+			articles.open(&articles.articles[row])
+		}
+	})
+	newButton := qt.NewQPushButton5("new article", articles.tab)
+	listVBox.AddWidget(newButton.QWidget)
+	newButton.OnClicked(func() { articles.open(nil) })
+
+	// editor
+	editorVBox := qt.NewQVBoxLayout2()
+	layout.AddLayout(editorVBox.QLayout)
+
+	articles.titleEdit = qt.NewQLineEdit(articles.tab)
+	articles.titleEdit.SetPlaceholderText("title")
+	editorVBox.AddWidget(articles.titleEdit.QWidget)
+	articles.summaryEdit = qt.NewQLineEdit(articles.tab)
+	articles.summaryEdit.SetPlaceholderText("summary")
+	editorVBox.AddWidget(articles.summaryEdit.QWidget)
+	articles.imageEdit = qt.NewQLineEdit(articles.tab)
+	articles.imageEdit.SetPlaceholderText("image url")
+	editorVBox.AddWidget(articles.imageEdit.QWidget)
+
+	metaHBox := qt.NewQHBoxLayout2()
+	editorVBox.AddLayout(metaHBox.QLayout)
+	articles.dEdit = qt.NewQLineEdit(articles.tab)
+	articles.dEdit.SetPlaceholderText("identifier (d tag, from the title if empty)")
+	metaHBox.AddWidget(articles.dEdit.QWidget)
+	articles.hashtagsEdit = qt.NewQLineEdit(articles.tab)
+	articles.hashtagsEdit.SetPlaceholderText("hashtags, space-separated")
+	metaHBox.AddWidget(articles.hashtagsEdit.QWidget)
+	publishedAtLabel := qt.NewQLabel2()
+	publishedAtLabel.SetText("published at:")
+	metaHBox.AddWidget(publishedAtLabel.QWidget)
+	articles.publishedAtEdit = qt.NewQDateTimeEdit(articles.tab)
+	articles.publishedAtEdit.SetCalendarPopup(true)
+	articles.publishedAtEdit.SetDisplayFormat("yyyy-MM-dd HH:mm")
+	metaHBox.AddWidget(articles.publishedAtEdit.QWidget)
+
+	// markdown source and preview side by side
+	splitter := qt.NewQSplitter3(qt.Horizontal)
+	editorVBox.AddWidget(splitter.QWidget)
+	articles.sourceEdit = qt.NewQTextEdit(articles.tab)
+	articles.sourceEdit.SetAcceptRichText(false)
+	articles.sourceEdit.SetPlaceholderText("markdown")
+	splitter.AddWidget(articles.sourceEdit.QWidget)
+	articles.previewEdit = qt.NewQTextEdit(articles.tab)
+	articles.previewEdit.SetReadOnly(true)
+	splitter.AddWidget(articles.previewEdit.QWidget)
+	articles.sourceEdit.OnTextChanged(func() {
+		articles.previewEdit.SetMarkdown(articles.sourceEdit.ToPlainText())
+	})
+
+	// publishing
+	publishHBox := qt.NewQHBoxLayout2()
+	editorVBox.AddLayout(publishHBox.QLayout)
+	articles.relaysEdit = qt.NewQLineEdit(articles.tab)
+	articles.relaysEdit.SetPlaceholderText("relays, filled with your write relays on load")
+	publishHBox.AddWidget(articles.relaysEdit.QWidget)
+	draftButton := qt.NewQPushButton5("save draft", articles.tab)
+	publishHBox.AddWidget(draftButton.QWidget)
+	draftButton.OnClicked(func() { articles.publish(30024) })
+	publishButton := qt.NewQPushButton5("publish", articles.tab)
+	publishHBox.AddWidget(publishButton.QWidget)
+	publishButton.OnClicked(func() { articles.publish(30023) })
+	articles.resultLabel = qt.NewQLabel2()
+	articles.resultLabel.SetWordWrap(true)
+	editorVBox.AddWidget(articles.resultLabel.QWidget)
+
+	articles.open(nil)
+	return articles.tab
+}
+
+func (articles *articlesVars) load() {
+	withCurrentPubKey(func(pk nostr.PubKey) {
+		articles.resultLabel.SetText("loading...")
+
+		go func() {
+			fetchCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+			defer cancel()
+
+			writeRelays := sys.FetchWriteRelays(fetchCtx, pk)
+			found := make([]nostr.Event, 0, 20)
+			for ie := range sys.Pool.FetchMany(fetchCtx, writeRelays, nostr.Filter{
+				Kinds:   []nostr.Kind{30023, 30024},
+				Authors: []nostr.PubKey{pk},
+				Limit:   200,
+			}, nostr.SubscriptionOptions{Label: "vnak-articles"}) {
+				// keep the latest of each kind and d
+				idx := slices.IndexFunc(found, func(evt nostr.Event) bool {
+					return evt.Kind == ie.Event.Kind && evt.Tags.GetD() == ie.Event.Tags.GetD()
+				})
+				if idx == -1 {
+					found = append(found, ie.Event)
+				} else if ie.Event.CreatedAt > found[idx].CreatedAt {
+					found[idx] = ie.Event
+				}
+			}
+			slices.SortFunc(found, func(a, b nostr.Event) int { return int(b.CreatedAt - a.CreatedAt) })
+
+			mainthread.Wait(func() {
+				articles.articles = found
+				if len(writeRelays) > 0 {
+					articles.relaysEdit.SetText(strings.Join(writeRelays, " "))
+				}
+				articles.render()
+				articles.resultLabel.SetText(fmt.Sprintf("%d articles and drafts, double-click to edit", len(found)))
+			})
+		}()
+	})
+}
+
+func (articles *articlesVars) render() {
+	articles.articlesList.Clear()
+	for _, evt := range articles.articles {
+		title := evt.Tags.GetD()
+		if tag := evt.Tags.Find("title"); tag != nil && tag[1] != "" {
+			title = tag[1]
+		}
+		prefix := ""
+		if evt.Kind == 30024 {
+			prefix = "[draft] "
+		}
+		articles.articlesList.AddItem(fmt.Sprintf("%s%s\n%s", prefix, title, evt.CreatedAt.Time().Format(time.DateTime)))
+	}
+}
+
+// open loads evt into the editor, or clears it for a new article when evt is nil.
+func (articles *articlesVars) open(evt *nostr.Event) {
+	articles.editing = evt
+	articles.titleEdit.SetText("")
+	articles.summaryEdit.SetText("")
+	articles.imageEdit.SetText("")
+	articles.dEdit.SetText("")
+	articles.hashtagsEdit.SetText("")
+	articles.publishedAtEdit.SetDateTime(qt.QDateTime_CurrentDateTime())
+	articles.sourceEdit.SetPlainText("")
+	if evt == nil {
+		return
+	}
+
+	hashtags := make([]string, 0, 4)
+	for _, tag := range evt.Tags {
+		if len(tag) < 2 {
+			continue
+		}
+		switch tag[0] {
+		case "d":
+			articles.dEdit.SetText(tag[1])
+		case "title":
+			articles.titleEdit.SetText(tag[1])
+		case "summary":
+			articles.summaryEdit.SetText(tag[1])
+		case "image":
+			articles.imageEdit.SetText(tag[1])
+		case "published_at":
+			if ts, err := strconv.ParseInt(tag[1], 10, 64); err == nil {
+				articles.publishedAtEdit.SetDateTime(qt.QDateTime_FromSecsSinceEpoch(ts))
+			}
+		case "t":
+			hashtags = append(hashtags, tag[1])
+		}
+	}
+	articles.hashtagsEdit.SetText(strings.Join(hashtags, " "))
+	articles.sourceEdit.SetPlainText(evt.Content)
+}
+
+func (articles *articlesVars) publish(kind nostr.Kind) {
+	title := strings.TrimSpace(articles.titleEdit.Text())
+	d := strings.TrimSpace(articles.dEdit.Text())
+	if d == "" {
+		d = strings.Trim(slugInvalid.ReplaceAllString(strings.ToLower(title), "-"), "-")
+		if d == "" {
+			articles.resultLabel.SetText("an article needs a title or an identifier")
+			return
+		}
+		articles.dEdit.SetText(d)
+	}
+	relays := parseRelays(articles.relaysEdit.Text())
+	if len(relays) == 0 {
+		articles.resultLabel.SetText("no relays specified")
+		return
+	}
+
+	evt := nostr.Event{
+		Kind:      kind,
+		CreatedAt: nostr.Now(),
+		Content:   articles.sourceEdit.ToPlainText(),
+		Tags: nostr.Tags{
+			{"d", d},
+			{"title", title},
+			{"published_at", strconv.FormatInt(articles.publishedAtEdit.DateTime().ToSecsSinceEpoch(), 10)},
+		},
+	}
+	if summary := strings.TrimSpace(articles.summaryEdit.Text()); summary != "" {
+		evt.Tags = append(evt.Tags, nostr.Tag{"summary", summary})
+	}
+	if image := strings.TrimSpace(articles.imageEdit.Text()); image != "" {
+		evt.Tags = append(evt.Tags, nostr.Tag{"image", image})
+	}
+	for _, hashtag := range strings.Fields(articles.hashtagsEdit.Text()) {
+		evt.Tags = append(evt.Tags, nostr.Tag{"t", strings.ToLower(strings.TrimPrefix(hashtag, "#"))})
+	}
+	if articles.editing != nil {
+		// keep whatever else the original had
+		for _, tag := range articles.editing.Tags {
+			if len(tag) >= 1 && !slices.Contains(articleManagedTags, tag[0]) {
+				evt.Tags = append(evt.Tags, tag)
+			}
+		}
+	}
+
+	articles.resultLabel.SetText("signing...")
+	signer.sign("articles tab", evt, func(signed nostr.Event) {
+		results := make([]string, 0, len(relays))
+		publishTo(relays, signed, func(url string, err error) {
+			if err != nil {
+				results = append(results, niceRelayURL(url)+": "+err.Error())
+			} else {
+				results = append(results, niceRelayURL(url)+": ok")
+			}
+			articles.resultLabel.SetText(strings.Join(results, "\n"))
+		})
+
+		// replace the previous version in the list
+		idx := slices.IndexFunc(articles.articles, func(evt nostr.Event) bool {
+			return evt.Kind == signed.Kind && evt.Tags.GetD() == signed.Tags.GetD()
+		})
+		if idx != -1 {
+			articles.articles = slices.Delete(articles.articles, idx, idx+1)
+		}
+		articles.articles = append([]nostr.Event{signed}, articles.articles...)
+		articles.editing = &articles.articles[0]
+		articles.render()
+	})
+}
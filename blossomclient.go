@@ -0,0 +1,415 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"fiatjaf.com/nostr"
+	"fiatjaf.com/nostr/nipb0/blossom"
+	qt "github.com/mappu/miqt/qt6"
+	"github.com/mappu/miqt/qt6/mainthread"
+)
+
+type blossomClientVars struct {
+	tab *qt.QWidget
+
+	serverEdit  *qt.QLineEdit
+	pubkeyEdit  *qt.QLineEdit
+	targetEdit  *qt.QLineEdit
+	blobsList   *qt.QListWidget
+	detailsEdit *qt.QTextEdit
+	resultLabel *qt.QLabel
+
+	server string
+	blobs  []blossom.BlobDescriptor
+}
+
+var blossomClient = &blossomClientVars{}
+
+func setupBlossomClientTab() *qt.QWidget {
+	blossomClient.tab = qt.NewQWidget(window.QWidget)
+	layout := qt.NewQVBoxLayout2()
+	blossomClient.tab.SetLayout(layout.QLayout)
+
+	// server
+	serverHBox := qt.NewQHBoxLayout2()
+	layout.AddLayout(serverHBox.QLayout)
+	serverLabel := qt.NewQLabel2()
+	serverLabel.SetText("server:")
+	serverHBox.AddWidget(serverLabel.QWidget)
+	blossomClient.serverEdit = qt.NewQLineEdit(blossomClient.tab)
+	blossomClient.serverEdit.SetText("http://localhost:10547")
+	serverHBox.AddWidget(blossomClient.serverEdit.QWidget)
+	uploadButton := qt.NewQPushButton5("upload file", blossomClient.tab)
+	serverHBox.AddWidget(uploadButton.QWidget)
+	uploadButton.OnClicked(blossomClient.upload)
+
+	// list
+	listHBox := qt.NewQHBoxLayout2()
+	layout.AddLayout(listHBox.QLayout)
+	blossomClient.pubkeyEdit = qt.NewQLineEdit(blossomClient.tab)
+	blossomClient.pubkeyEdit.SetPlaceholderText("pubkey to list blobs from (empty for the current key)")
+	listHBox.AddWidget(blossomClient.pubkeyEdit.QWidget)
+	listButton := qt.NewQPushButton5("list blobs", blossomClient.tab)
+	listHBox.AddWidget(listButton.QWidget)
+	listButton.OnClicked(blossomClient.list)
+
+	blossomClient.blobsList = qt.NewQListWidget(blossomClient.tab)
+	layout.AddWidget(blossomClient.blobsList.QWidget)
+	blossomClient.detailsEdit = qt.NewQTextEdit(blossomClient.tab)
+	blossomClient.detailsEdit.SetReadOnly(true)
+	blossomClient.detailsEdit.SetMaximumHeight(120)
+	layout.AddWidget(blossomClient.detailsEdit.QWidget)
+	blossomClient.blobsList.OnCurrentRowChanged(func(row int) {
+		if bd := blossomClient.selected(); bd != nil {
+			j, _ := json.MarshalIndent(bd, "", "  ")
+			blossomClient.detailsEdit.SetPlainText(string(j))
+		} else {
+			blossomClient.detailsEdit.SetPlainText("")
+		}
+	})
+
+	// actions on the selected blob
+	actionsHBox := qt.NewQHBoxLayout2()
+	layout.AddLayout(actionsHBox.QLayout)
+	downloadButton := qt.NewQPushButton5("download and verify", blossomClient.tab)
+	actionsHBox.AddWidget(downloadButton.QWidget)
+	downloadButton.OnClicked(blossomClient.download)
+	deleteButton := qt.NewQPushButton5("delete", blossomClient.tab)
+	actionsHBox.AddWidget(deleteButton.QWidget)
+	deleteButton.OnClicked(blossomClient.delete)
+	blossomClient.targetEdit = qt.NewQLineEdit(blossomClient.tab)
+	blossomClient.targetEdit.SetPlaceholderText("server to mirror to")
+	actionsHBox.AddWidget(blossomClient.targetEdit.QWidget)
+	mirrorButton := qt.NewQPushButton5("mirror", blossomClient.tab)
+	actionsHBox.AddWidget(mirrorButton.QWidget)
+	mirrorButton.OnClicked(blossomClient.mirror)
+
+	blossomClient.resultLabel = qt.NewQLabel2()
+	blossomClient.resultLabel.SetWordWrap(true)
+	layout.AddWidget(blossomClient.resultLabel.QWidget)
+
+	return blossomClient.tab
+}
+
+func (bc *blossomClientVars) serverURL() string {
+	server := strings.TrimRight(strings.TrimSpace(bc.serverEdit.Text()), "/")
+	if server != "" && !strings.HasPrefix(server, "http://") && !strings.HasPrefix(server, "https://") {
+		server = "https://" + server
+	}
+	return server
+}
+
+func (bc *blossomClientVars) selected() *blossom.BlobDescriptor {
+	if row := bc.blobsList.CurrentRow(); row >= 0 && row < len(bc.blobs) {
+		return &bc.blobs[row]
+	}
+	return nil
+}
+
+// authorize signs a kind 24242 event for the given action and calls then with the authorization header.
+func (bc *blossomClientVars) authorize(action string, hash string, server string, then func(header string)) {
+	if currentKeyer == nil {
+		bc.resultLabel.SetText("no key loaded")
+		return
+	}
+
+	evt := nostr.Event{
+		Kind:      24242,
+		CreatedAt: nostr.Now(),
+		Content:   action + " " + hash,
+		Tags: nostr.Tags{
+			{"t", action},
+			{"expiration", strconv.FormatInt(int64(nostr.Now())+300, 10)},
+		},
+	}
+	if hash != "" {
+		evt.Tags = append(evt.Tags, nostr.Tag{"x", hash})
+	}
+	if host := strings.SplitN(server, "/", 4); len(host) >= 3 {
+		evt.Tags = append(evt.Tags, nostr.Tag{"server", host[2]})
+	}
+
+	bc.resultLabel.SetText("signing authorization...")
+	signer.sign("blossom tab: "+action+" "+hash, evt, func(signed nostr.Event) {
+		j, _ := json.Marshal(signed)
+		then("Nostr " + base64.StdEncoding.EncodeToString(j))
+	})
+}
+
+// call does an http request in the background and reports the response body on the main thread.
+func (bc *blossomClientVars) call(method, url, authorization, contentType string, body []byte, done func(status int, respBody []byte, err error)) {
+	go func() {
+		callCtx, cancel := context.WithTimeout(ctx, time.Minute*5)
+		defer cancel()
+
+		status, respBody, err := func() (int, []byte, error) {
+			req, err := http.NewRequestWithContext(callCtx, method, url, bytes.NewReader(body))
+			if err != nil {
+				return 0, nil, err
+			}
+			if authorization != "" {
+				req.Header.Set("Authorization", authorization)
+			}
+			if contentType != "" {
+				req.Header.Set("Content-Type", contentType)
+			}
+			if body != nil {
+				req.ContentLength = int64(len(body))
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				return 0, nil, err
+			}
+			defer resp.Body.Close()
+			respBody, err := io.ReadAll(resp.Body)
+			if err == nil && resp.StatusCode >= 300 {
+				reason := resp.Header.Get("X-Reason")
+				if reason == "" {
+					reason = strings.TrimSpace(string(respBody))
+				}
+				err = fmt.Errorf("%s returned %d: %s", url, resp.StatusCode, reason)
+			}
+			return resp.StatusCode, respBody, err
+		}()
+
+		mainthread.Wait(func() {
+			done(status, respBody, err)
+		})
+	}()
+}
+
+func (bc *blossomClientVars) upload() {
+	server := bc.serverURL()
+	if server == "" {
+		bc.resultLabel.SetText("no server specified")
+		return
+	}
+	path := qt.QFileDialog_GetOpenFileName2(window.QWidget, "file to upload")
+	if path == "" {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		bc.resultLabel.SetText("failed to read file: " + err.Error())
+		return
+	}
+	hash := sha256.Sum256(data)
+	hexHash := hex.EncodeToString(hash[:])
+	contentType := mime.TypeByExtension(filepath.Ext(path))
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+
+	bc.authorize("upload", hexHash, server, func(header string) {
+		bc.resultLabel.SetText(fmt.Sprintf("uploading %s (%d bytes)...", filepath.Base(path), len(data)))
+		bc.call("PUT", server+"/upload", header, contentType, data, func(_ int, respBody []byte, err error) {
+			if err != nil {
+				bc.resultLabel.SetText("upload failed: " + err.Error())
+				return
+			}
+			var bd blossom.BlobDescriptor
+			if err := json.Unmarshal(respBody, &bd); err != nil {
+				bc.resultLabel.SetText("uploaded, but got an invalid descriptor: " + err.Error())
+				return
+			}
+			if bd.SHA256 != hexHash {
+				bc.resultLabel.SetText(fmt.Sprintf("uploaded, but the server says the hash is %s instead of %s", bd.SHA256, hexHash))
+				return
+			}
+			bc.resultLabel.SetText("uploaded: " + bd.URL)
+			if bc.server == server {
+				bc.blobs = append(bc.blobs, bd)
+				bc.render()
+			}
+		})
+	})
+}
+
+func (bc *blossomClientVars) list() {
+	server := bc.serverURL()
+	if server == "" {
+		bc.resultLabel.SetText("no server specified")
+		return
+	}
+
+	listFor := func(pk nostr.PubKey) {
+		bc.resultLabel.SetText("listing...")
+		url := server + "/list/" + pk.Hex()
+		handle := func(_ int, respBody []byte, err error) {
+			if err != nil {
+				bc.resultLabel.SetText("list failed: " + err.Error())
+				return
+			}
+			var blobs []blossom.BlobDescriptor
+			if err := json.Unmarshal(respBody, &blobs); err != nil {
+				bc.resultLabel.SetText("invalid list response: " + err.Error())
+				return
+			}
+			bc.server = server
+			bc.blobs = blobs
+			bc.render()
+			bc.resultLabel.SetText(fmt.Sprintf("%d blobs", len(blobs)))
+		}
+
+		bc.call("GET", url, "", "", nil, func(status int, respBody []byte, err error) {
+			if status == 401 && currentKeyer != nil {
+				// this server wants us to authenticate for listing
+				bc.authorize("list", "", server, func(header string) {
+					bc.call("GET", url, header, "", nil, handle)
+				})
+				return
+			}
+			handle(status, respBody, err)
+		})
+	}
+
+	if value := strings.TrimSpace(bc.pubkeyEdit.Text()); value != "" {
+		go func() {
+			pk, err := parsePubKey(value)
+			mainthread.Wait(func() {
+				if err != nil {
+					bc.resultLabel.SetText(err.Error())
+					return
+				}
+				listFor(pk)
+			})
+		}()
+	} else {
+		withCurrentPubKey(listFor)
+	}
+}
+
+func (bc *blossomClientVars) render() {
+	bc.blobsList.Clear()
+	for _, bd := range bc.blobs {
+		bc.blobsList.AddItem(fmt.Sprintf("%s  %d bytes  %s  %s",
+			bd.SHA256, bd.Size, bd.Type, bd.Uploaded.Time().Format(time.DateTime)))
+	}
+}
+
+// blobURL is where a listed blob can be fetched, servers may leave the url out of descriptors.
+func (bc *blossomClientVars) blobURL(bd *blossom.BlobDescriptor) string {
+	if bd.URL != "" {
+		return bd.URL
+	}
+	return bc.server + "/" + bd.SHA256
+}
+
+func (bc *blossomClientVars) download() {
+	bd := bc.selected()
+	if bd == nil {
+		return
+	}
+	url := bc.blobURL(bd)
+	expected := bd.SHA256
+
+	bc.resultLabel.SetText("downloading...")
+	bc.call("GET", url, "", "", nil, func(_ int, respBody []byte, err error) {
+		if err != nil {
+			bc.resultLabel.SetText("download failed: " + err.Error())
+			return
+		}
+		hash := sha256.Sum256(respBody)
+		if actual := hex.EncodeToString(hash[:]); actual != expected {
+			bc.resultLabel.SetText(fmt.Sprintf("hash mismatch! expected %s, got %s (%d bytes)", expected, actual, len(respBody)))
+			return
+		}
+
+		bc.resultLabel.SetText(fmt.Sprintf("verified: %d bytes match %s", len(respBody), expected))
+		path := qt.QFileDialog_GetSaveFileName3(window.QWidget, "save blob", expected+extensionFromURL(url))
+		if path == "" {
+			return
+		}
+		if err := os.WriteFile(path, respBody, 0o644); err != nil {
+			bc.resultLabel.SetText("verified, but failed to save: " + err.Error())
+			return
+		}
+		bc.resultLabel.SetText(fmt.Sprintf("verified and saved to %s", path))
+	})
+}
+
+func extensionFromURL(url string) string {
+	base := url[strings.LastIndex(url, "/")+1:]
+	if idx := strings.Index(base, "."); idx != -1 {
+		return base[idx:]
+	}
+	return ""
+}
+
+func (bc *blossomClientVars) delete() {
+	bd := bc.selected()
+	if bd == nil {
+		return
+	}
+	server := bc.server
+	hash := bd.SHA256
+
+	bc.authorize("delete", hash, server, func(header string) {
+		bc.call("DELETE", server+"/"+hash, header, "", nil, func(_ int, _ []byte, err error) {
+			if err != nil {
+				bc.resultLabel.SetText("delete failed: " + err.Error())
+				return
+			}
+			bc.resultLabel.SetText("deleted " + hash)
+			for i, bd := range bc.blobs {
+				if bd.SHA256 == hash {
+					bc.blobs = append(bc.blobs[:i], bc.blobs[i+1:]...)
+					break
+				}
+			}
+			bc.render()
+		})
+	})
+}
+
+func (bc *blossomClientVars) mirror() {
+	bd := bc.selected()
+	if bd == nil {
+		return
+	}
+	target := strings.TrimRight(strings.TrimSpace(bc.targetEdit.Text()), "/")
+	if target == "" {
+		bc.resultLabel.SetText("no target server specified")
+		return
+	}
+	if !strings.HasPrefix(target, "http://") && !strings.HasPrefix(target, "https://") {
+		target = "https://" + target
+	}
+	source := bc.blobURL(bd)
+	hash := bd.SHA256
+
+	bc.authorize("upload", hash, target, func(header string) {
+		body, _ := json.Marshal(map[string]string{"url": source})
+		bc.resultLabel.SetText("mirroring to " + target + "...")
+		bc.call("PUT", target+"/mirror", header, "application/json", body, func(_ int, respBody []byte, err error) {
+			if err != nil {
+				bc.resultLabel.SetText("mirror failed: " + err.Error())
+				return
+			}
+			var mirrored blossom.BlobDescriptor
+			if err := json.Unmarshal(respBody, &mirrored); err != nil {
+				bc.resultLabel.SetText("mirrored, but got an invalid descriptor: " + err.Error())
+				return
+			}
+			if mirrored.SHA256 != hash {
+				bc.resultLabel.SetText(fmt.Sprintf("mirror returned a different hash: %s", mirrored.SHA256))
+				return
+			}
+			bc.resultLabel.SetText("mirrored: " + mirrored.URL)
+		})
+	})
+}
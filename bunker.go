@@ -0,0 +1,454 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"fiatjaf.com/nostr"
+	"fiatjaf.com/nostr/nip04"
+	"fiatjaf.com/nostr/nip19"
+	"fiatjaf.com/nostr/nip44"
+	"fiatjaf.com/nostr/nip46"
+	"github.com/mailru/easyjson"
+	qt "github.com/mappu/miqt/qt6"
+	"github.com/mappu/miqt/qt6/mainthread"
+)
+
+type bunkerVars struct {
+	tab *qt.QWidget
+
+	relaysEdit       *qt.QLineEdit
+	secretEdit       *qt.QLineEdit
+	autoMethodsEdit  *qt.QLineEdit
+	autoKindsEdit    *qt.QLineEdit
+	startButton      *qt.QPushButton
+	stopButton       *qt.QPushButton
+	urlEdit          *qt.QLineEdit
+	requestsList     *qt.QListWidget
+	detailsEdit      *qt.QTextEdit
+	approveButton    *qt.QPushButton
+	denyButton       *qt.QPushButton
+	connectedClients *qt.QLabel
+
+	sk        nostr.SecretKey
+	pk        nostr.PubKey
+	relays    []string
+	cancel    context.CancelFunc
+	requests  []*bunkerRequest
+	connected map[nostr.PubKey]bool
+}
+
+type bunkerRequest struct {
+	event   nostr.Event
+	request nip46.Request
+	session nip46.Session
+	status  string
+	item    *qt.QListWidgetItem
+}
+
+var bunker = &bunkerVars{}
+
+func setupBunkerTab() *qt.QWidget {
+	bunker.tab = qt.NewQWidget(window.QWidget)
+	layout := qt.NewQVBoxLayout2()
+	bunker.tab.SetLayout(layout.QLayout)
+
+	// relays
+	relaysHBox := qt.NewQHBoxLayout2()
+	layout.AddLayout(relaysHBox.QLayout)
+	relaysLabel := qt.NewQLabel2()
+	relaysLabel.SetText("relays:")
+	relaysHBox.AddWidget(relaysLabel.QWidget)
+	bunker.relaysEdit = qt.NewQLineEdit(bunker.tab)
+	bunker.relaysEdit.SetText("ws://localhost:10547")
+	bunker.relaysEdit.SetPlaceholderText("space-separated relay urls")
+	relaysHBox.AddWidget(bunker.relaysEdit.QWidget)
+
+	// secret
+	secretLabel := qt.NewQLabel2()
+	secretLabel.SetText("secret:")
+	relaysHBox.AddWidget(secretLabel.QWidget)
+	bunker.secretEdit = qt.NewQLineEdit(bunker.tab)
+	bunker.secretEdit.SetText(randomSecret())
+	bunker.secretEdit.SetPlaceholderText("optional")
+	relaysHBox.AddWidget(bunker.secretEdit.QWidget)
+
+	// auto-approve
+	autoHBox := qt.NewQHBoxLayout2()
+	layout.AddLayout(autoHBox.QLayout)
+	autoMethodsLabel := qt.NewQLabel2()
+	autoMethodsLabel.SetText("auto-approve methods:")
+	autoHBox.AddWidget(autoMethodsLabel.QWidget)
+	bunker.autoMethodsEdit = qt.NewQLineEdit(bunker.tab)
+	bunker.autoMethodsEdit.SetText("connect,get_public_key,ping")
+	autoHBox.AddWidget(bunker.autoMethodsEdit.QWidget)
+	autoKindsLabel := qt.NewQLabel2()
+	autoKindsLabel.SetText("auto-sign kinds:")
+	autoHBox.AddWidget(autoKindsLabel.QWidget)
+	bunker.autoKindsEdit = qt.NewQLineEdit(bunker.tab)
+	bunker.autoKindsEdit.SetPlaceholderText("like 1,7 or * for all")
+	autoHBox.AddWidget(bunker.autoKindsEdit.QWidget)
+
+	// buttons
+	buttonsHBox := qt.NewQHBoxLayout2()
+	layout.AddLayout(buttonsHBox.QLayout)
+	bunker.startButton = qt.NewQPushButton5("start", bunker.tab)
+	buttonsHBox.AddWidget(bunker.startButton.QWidget)
+	bunker.stopButton = qt.NewQPushButton5("stop", bunker.tab)
+	bunker.stopButton.SetEnabled(false)
+	buttonsHBox.AddWidget(bunker.stopButton.QWidget)
+
+	// bunker url
+	urlHBox := qt.NewQHBoxLayout2()
+	layout.AddLayout(urlHBox.QLayout)
+	urlLabel := qt.NewQLabel2()
+	urlLabel.SetText("bunker url:")
+	urlHBox.AddWidget(urlLabel.QWidget)
+	bunker.urlEdit = qt.NewQLineEdit(bunker.tab)
+	bunker.urlEdit.SetReadOnly(true)
+	urlHBox.AddWidget(bunker.urlEdit.QWidget)
+	copyButton := qt.NewQPushButton5("copy", bunker.tab)
+	urlHBox.AddWidget(copyButton.QWidget)
+	copyButton.OnClicked(func() {
+		qt.QGuiApplication_Clipboard().SetText(bunker.urlEdit.Text())
+	})
+
+	bunker.connectedClients = qt.NewQLabel2()
+	layout.AddWidget(bunker.connectedClients.QWidget)
+
+	// requests and details
+	requestsHBox := qt.NewQHBoxLayout2()
+	layout.AddLayout(requestsHBox.QLayout)
+
+	requestsVBox := qt.NewQVBoxLayout2()
+	requestsHBox.AddLayout(requestsVBox.QLayout)
+	requestsLabel := qt.NewQLabel2()
+	requestsLabel.SetText("requests:")
+	requestsVBox.AddWidget(requestsLabel.QWidget)
+	bunker.requestsList = qt.NewQListWidget(bunker.tab)
+	requestsVBox.AddWidget(bunker.requestsList.QWidget)
+
+	detailsVBox := qt.NewQVBoxLayout2()
+	requestsHBox.AddLayout(detailsVBox.QLayout)
+	detailsLabel := qt.NewQLabel2()
+	detailsLabel.SetText("payload:")
+	detailsVBox.AddWidget(detailsLabel.QWidget)
+	bunker.detailsEdit = qt.NewQTextEdit(bunker.tab)
+	bunker.detailsEdit.SetReadOnly(true)
+	detailsVBox.AddWidget(bunker.detailsEdit.QWidget)
+	decisionHBox := qt.NewQHBoxLayout2()
+	detailsVBox.AddLayout(decisionHBox.QLayout)
+	bunker.approveButton = qt.NewQPushButton5("approve", bunker.tab)
+	bunker.approveButton.SetEnabled(false)
+	decisionHBox.AddWidget(bunker.approveButton.QWidget)
+	bunker.denyButton = qt.NewQPushButton5("deny", bunker.tab)
+	bunker.denyButton.SetEnabled(false)
+	decisionHBox.AddWidget(bunker.denyButton.QWidget)
+
+	bunker.requestsList.OnCurrentRowChanged(func(row int) {
+		bunker.showRequest(row)
+	})
+	bunker.approveButton.OnClicked(func() {
+		if row := bunker.requestsList.CurrentRow(); row >= 0 && row < len(bunker.requests) {
+			bunker.respond(bunker.requests[row], true)
+			bunker.showRequest(row)
+		}
+	})
+	bunker.denyButton.OnClicked(func() {
+		if row := bunker.requestsList.CurrentRow(); row >= 0 && row < len(bunker.requests) {
+			bunker.respond(bunker.requests[row], false)
+			bunker.showRequest(row)
+		}
+	})
+
+	bunker.startButton.OnClicked(bunker.start)
+	bunker.stopButton.OnClicked(bunker.stop)
+
+	return bunker.tab
+}
+
+func (bunker *bunkerVars) start() {
+	if currentSec == [32]byte{} {
+		statusLabel.SetText("the bunker needs a secret key loaded (it can't proxy another bunker)")
+		return
+	}
+
+	bunker.relays = bunker.relays[:0]
+	for _, r := range strings.Fields(bunker.relaysEdit.Text()) {
+		bunker.relays = append(bunker.relays, nostr.NormalizeURL(r))
+	}
+	if len(bunker.relays) == 0 {
+		statusLabel.SetText("no relays specified")
+		return
+	}
+
+	bunker.sk = currentSec
+	bunker.pk = nostr.GetPublicKey(bunker.sk)
+	bunker.connected = make(map[nostr.PubKey]bool)
+
+	qs := url.Values{}
+	for _, r := range bunker.relays {
+		qs.Add("relay", r)
+	}
+	if secret := strings.TrimSpace(bunker.secretEdit.Text()); secret != "" {
+		qs.Set("secret", secret)
+	}
+	bunker.urlEdit.SetText("bunker://" + bunker.pk.Hex() + "?" + qs.Encode())
+
+	bunker.startButton.SetEnabled(false)
+	bunker.stopButton.SetEnabled(true)
+	bunker.relaysEdit.SetEnabled(false)
+	bunker.secretEdit.SetEnabled(false)
+	bunker.updateConnectedClients()
+
+	bunkerCtx, cancel := context.WithCancel(ctx)
+	bunker.cancel = cancel
+
+	go func() {
+		for ie := range sys.Pool.SubscribeMany(bunkerCtx, bunker.relays, nostr.Filter{
+			Kinds: []nostr.Kind{nostr.KindNostrConnect},
+			Tags:  nostr.TagMap{"p": []string{bunker.pk.Hex()}},
+			Since: nostr.Now(),
+		}, nostr.SubscriptionOptions{
+			Label: "vnak-bunker",
+		}) {
+			ck, err := nip44.GenerateConversationKey(ie.PubKey, bunker.sk)
+			if err != nil {
+				continue
+			}
+			session := nip46.Session{PublicKey: bunker.pk, ConversationKey: ck}
+			request, err := session.ParseRequest(ie.Event)
+			if err != nil {
+				continue
+			}
+
+			mainthread.Wait(func() {
+				bunker.handleIncoming(&bunkerRequest{
+					event:   ie.Event,
+					request: request,
+					session: session,
+					status:  "pending",
+				})
+			})
+		}
+	}()
+
+	statusLabel.SetText("bunker listening on " + strings.Join(niceRelayURLs(bunker.relays), ", "))
+}
+
+func (bunker *bunkerVars) stop() {
+	if bunker.cancel != nil {
+		bunker.cancel()
+		bunker.cancel = nil
+	}
+	bunker.startButton.SetEnabled(true)
+	bunker.stopButton.SetEnabled(false)
+	bunker.relaysEdit.SetEnabled(true)
+	bunker.secretEdit.SetEnabled(true)
+	bunker.urlEdit.SetText("")
+	statusLabel.SetText("bunker stopped")
+}
+
+func (bunker *bunkerVars) handleIncoming(br *bunkerRequest) {
+	br.item = qt.NewQListWidgetItem2("")
+	bunker.requests = append(bunker.requests, br)
+	bunker.requestsList.AddItemWithItem(br.item)
+	bunker.updateItem(br)
+
+	if bunker.shouldAutoApprove(br) {
+		bunker.respond(br, true)
+	}
+}
+
+func (bunker *bunkerVars) shouldAutoApprove(br *bunkerRequest) bool {
+	if br.request.Method == "connect" {
+		// the connect secret, when set, must always match
+		secret := strings.TrimSpace(bunker.secretEdit.Text())
+		if secret != "" && (len(br.request.Params) < 2 || br.request.Params[1] != secret) {
+			return false
+		}
+	} else if !bunker.connected[br.event.PubKey] {
+		// everything else is only automatic for clients that went through connect
+		return false
+	}
+
+	methods := strings.Split(strings.ReplaceAll(bunker.autoMethodsEdit.Text(), " ", ""), ",")
+	if slices.Contains(methods, br.request.Method) {
+		return true
+	}
+
+	if br.request.Method == "sign_event" && len(br.request.Params) == 1 {
+		kinds := strings.TrimSpace(bunker.autoKindsEdit.Text())
+		if kinds == "*" {
+			return true
+		}
+		var evt nostr.Event
+		if err := easyjson.Unmarshal([]byte(br.request.Params[0]), &evt); err != nil {
+			return false
+		}
+		for _, k := range strings.Split(kinds, ",") {
+			if kind, err := strconv.Atoi(strings.TrimSpace(k)); err == nil && nostr.Kind(kind) == evt.Kind {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (bunker *bunkerVars) respond(br *bunkerRequest, approved bool) {
+	if br.status != "pending" {
+		return
+	}
+
+	var result string
+	var err error
+	if approved {
+		result, err = bunker.execute(br)
+		br.status = "approved"
+		if err != nil {
+			br.status = "failed: " + err.Error()
+		}
+	} else {
+		err = fmt.Errorf("denied by user")
+		br.status = "denied"
+	}
+	bunker.updateItem(br)
+
+	_, evt, err := br.session.MakeResponse(br.request.ID, br.event.PubKey, result, err)
+	if err != nil {
+		br.status = "failed: " + err.Error()
+		bunker.updateItem(br)
+		return
+	}
+	if err := evt.Sign(bunker.sk); err != nil {
+		br.status = "failed to sign response: " + err.Error()
+		bunker.updateItem(br)
+		return
+	}
+
+	results := sys.Pool.PublishMany(ctx, bunker.relays, evt)
+	go func() {
+		for range results {
+		}
+	}()
+}
+
+func (bunker *bunkerVars) execute(br *bunkerRequest) (string, error) {
+	params := br.request.Params
+	switch br.request.Method {
+	case "connect":
+		bunker.connected[br.event.PubKey] = true
+		bunker.updateConnectedClients()
+		if len(params) >= 2 && params[1] != "" {
+			return params[1], nil
+		}
+		return "ack", nil
+	case "ping":
+		return "pong", nil
+	case "get_public_key":
+		return bunker.pk.Hex(), nil
+	case "sign_event":
+		if len(params) != 1 {
+			return "", fmt.Errorf("wrong number of arguments to 'sign_event'")
+		}
+		evt := nostr.Event{}
+		if err := easyjson.Unmarshal([]byte(params[0]), &evt); err != nil {
+			return "", fmt.Errorf("failed to decode event: %w", err)
+		}
+		if err := evt.Sign(bunker.sk); err != nil {
+			return "", fmt.Errorf("failed to sign event: %w", err)
+		}
+		jevt, _ := easyjson.Marshal(evt)
+		return string(jevt), nil
+	case "nip44_encrypt", "nip44_decrypt":
+		if len(params) != 2 {
+			return "", fmt.Errorf("wrong number of arguments to '%s'", br.request.Method)
+		}
+		pk, err := nostr.PubKeyFromHex(params[0])
+		if err != nil {
+			return "", fmt.Errorf("invalid pubkey: %w", err)
+		}
+		ck, err := nip44.GenerateConversationKey(pk, bunker.sk)
+		if err != nil {
+			return "", fmt.Errorf("failed to compute shared secret: %w", err)
+		}
+		if br.request.Method == "nip44_encrypt" {
+			return nip44.Encrypt(params[1], ck)
+		}
+		return nip44.Decrypt(params[1], ck)
+	case "nip04_encrypt", "nip04_decrypt":
+		if len(params) != 2 {
+			return "", fmt.Errorf("wrong number of arguments to '%s'", br.request.Method)
+		}
+		pk, err := nostr.PubKeyFromHex(params[0])
+		if err != nil {
+			return "", fmt.Errorf("invalid pubkey: %w", err)
+		}
+		shared, err := nip04.ComputeSharedSecret(pk, bunker.sk)
+		if err != nil {
+			return "", fmt.Errorf("failed to compute shared secret: %w", err)
+		}
+		if br.request.Method == "nip04_encrypt" {
+			return nip04.Encrypt(params[1], shared)
+		}
+		return nip04.Decrypt(params[1], shared)
+	default:
+		return "", fmt.Errorf("unsupported method '%s'", br.request.Method)
+	}
+}
+
+func (bunker *bunkerVars) updateItem(br *bunkerRequest) {
+	summary := br.request.Method
+	if br.request.Method == "sign_event" && len(br.request.Params) == 1 {
+		var evt nostr.Event
+		if err := easyjson.Unmarshal([]byte(br.request.Params[0]), &evt); err == nil {
+			summary += fmt.Sprintf(" kind %d", evt.Kind)
+		}
+	}
+	br.item.SetText(fmt.Sprintf("[%s] %s from %s", br.status, summary, nip19.EncodeNpub(br.event.PubKey)))
+}
+
+func (bunker *bunkerVars) showRequest(row int) {
+	if row < 0 || row >= len(bunker.requests) {
+		bunker.detailsEdit.SetPlainText("")
+		bunker.approveButton.SetEnabled(false)
+		bunker.denyButton.SetEnabled(false)
+		return
+	}
+	br := bunker.requests[row]
+
+	text := fmt.Sprintf("id: %s\nmethod: %s\nfrom: %s\nstatus: %s\n\nparams:\n",
+		br.request.ID, br.request.Method, br.event.PubKey.Hex(), br.status)
+	for _, param := range br.request.Params {
+		var v any
+		if err := json.Unmarshal([]byte(param), &v); err == nil {
+			if pretty, err := json.MarshalIndent(v, "", "  "); err == nil {
+				param = string(pretty)
+			}
+		}
+		text += param + "\n"
+	}
+	bunker.detailsEdit.SetPlainText(text)
+
+	pending := br.status == "pending"
+	bunker.approveButton.SetEnabled(pending)
+	bunker.denyButton.SetEnabled(pending)
+}
+
+func (bunker *bunkerVars) updateConnectedClients() {
+	if len(bunker.connected) == 0 {
+		bunker.connectedClients.SetText("no clients connected")
+		return
+	}
+	clients := make([]string, 0, len(bunker.connected))
+	for pk := range bunker.connected {
+		clients = append(clients, nip19.EncodeNpub(pk))
+	}
+	bunker.connectedClients.SetText("connected clients: " + strings.Join(clients, ", "))
+}
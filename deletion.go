@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"fiatjaf.com/nostr"
+	qt "github.com/mappu/miqt/qt6"
+	"github.com/mappu/miqt/qt6/mainthread"
+)
+
+func buildDeletion(targets []nostr.Event, reason string) nostr.Event {
+	deletion := nostr.Event{
+		Kind:      5,
+		CreatedAt: nostr.Now(),
+		Content:   reason,
+	}
+	kinds := make([]string, 0, 2)
+	for _, target := range targets {
+		deletion.Tags = append(deletion.Tags, nostr.Tag{"e", target.ID.Hex()})
+		if addr := address(target); addr != "" {
+			deletion.Tags = append(deletion.Tags, nostr.Tag{"a", addr})
+		} else if target.Kind.IsReplaceable() {
+			deletion.Tags = append(deletion.Tags, nostr.Tag{"a", fmt.Sprintf("%d:%s:", target.Kind, target.PubKey.Hex())})
+		}
+		if kind := strconv.Itoa(int(target.Kind)); !slices.Contains(kinds, kind) {
+			kinds = append(kinds, kind)
+		}
+	}
+	for _, kind := range kinds {
+		deletion.Tags = append(deletion.Tags, nostr.Tag{"k", kind})
+	}
+	return deletion
+}
+
+// deleteEvents asks for confirmation, publishes a deletion for targets and then checks if the relays still have them.
+func deleteEvents(source string, targets []nostr.Event, relays []string, report func(text string)) {
+	if currentKeyer == nil {
+		report("no key loaded")
+		return
+	}
+	if len(targets) == 0 {
+		report("no events selected")
+		return
+	}
+	// one publish result comes per normalized url, so that's what we count on
+	relays = parseRelays(strings.Join(relays, " "))
+	if len(relays) == 0 {
+		report("no relays to send the deletion to")
+		return
+	}
+
+	withCurrentPubKey(func(pk nostr.PubKey) {
+		for _, target := range targets {
+			if target.PubKey != pk {
+				report("can only delete your own events, " + target.ID.Hex() + " is from someone else")
+				return
+			}
+		}
+
+		if qt.QMessageBox_Question6(window.QWidget, "delete events",
+			fmt.Sprintf("publish a deletion request for %d events to %s?", len(targets), strings.Join(niceRelayURLs(relays), ", ")),
+			qt.QMessageBox__Yes|qt.QMessageBox__No, qt.QMessageBox__No) != qt.QMessageBox__Yes {
+			return
+		}
+
+		report("signing...")
+		signer.sign(source, buildDeletion(targets, ""), func(signed nostr.Event) {
+			results := make([]string, 0, len(relays))
+			pending := len(relays)
+			publishTo(relays, signed, func(url string, err error) {
+				if err != nil {
+					results = append(results, niceRelayURL(url)+": "+err.Error())
+				} else {
+					results = append(results, niceRelayURL(url)+": deletion accepted")
+				}
+				report(strings.Join(results, "\n"))
+
+				pending--
+				if pending == 0 {
+					verifyDeletion(targets, relays, results, report)
+				}
+			})
+		})
+	})
+}
+
+// verifyDeletion queries the relays again to see which ones are still serving the deleted events.
+func verifyDeletion(targets []nostr.Event, relays []string, results []string, report func(text string)) {
+	ids := make([]nostr.ID, len(targets))
+	for i, target := range targets {
+		ids[i] = target.ID
+	}
+
+	for _, url := range relays {
+		go func() {
+			still, err := countStillServed(url, ids)
+			mainthread.Wait(func() {
+				switch {
+				case err != nil:
+					results = append(results, niceRelayURL(url)+": ? couldn't check, "+err.Error())
+				case still == 0:
+					results = append(results, niceRelayURL(url)+": ✓ events gone")
+				default:
+					results = append(results, fmt.Sprintf("%s: ✗ still serving %d of %d events", niceRelayURL(url), still, len(ids)))
+				}
+				report(strings.Join(results, "\n"))
+			})
+		}()
+	}
+}
+
+// countStillServed asks a single relay for ids and only trusts the answer if it gets a real EOSE.
+func countStillServed(url string, ids []nostr.ID) (int, error) {
+	checkCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	relay, err := sys.Pool.EnsureRelay(url)
+	if err != nil {
+		return 0, err
+	}
+	sub, err := relay.Subscribe(checkCtx, nostr.Filter{IDs: ids}, nostr.SubscriptionOptions{
+		Label:          "vnak-delete-check",
+		MaxWaitForEOSE: math.MaxInt64,
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer sub.Unsub()
+
+	found := make(map[nostr.ID]struct{}, len(ids))
+	for {
+		select {
+		case evt, ok := <-sub.Events:
+			if !ok {
+				if checkCtx.Err() != nil {
+					return len(found), errors.New("timed out")
+				}
+				return len(found), errors.New("subscription ended early")
+			}
+			found[evt.ID] = struct{}{}
+		case <-sub.EndOfStoredEvents:
+			return len(found), nil
+		case reason := <-sub.ClosedReason:
+			return len(found), errors.New("closed: " + reason)
+		case <-sub.Context.Done():
+			if checkCtx.Err() != nil {
+				return len(found), errors.New("timed out")
+			}
+			return len(found), errors.New("disconnected")
+		}
+	}
+}
+
+// openVanishComposer builds a nip62 request to vanish and publishes it after an explicit confirmation.
+func openVanishComposer() {
+	if currentKeyer == nil {
+		statusLabel.SetText("no key loaded")
+		return
+	}
+
+	dialog := qt.NewQDialog(window.QWidget)
+	dialog.SetWindowTitle("request to vanish")
+	dialog.SetMinimumWidth(600)
+	layout := qt.NewQVBoxLayout2()
+	dialog.SetLayout(layout.QLayout)
+
+	warning := qt.NewQLabel2()
+	warning.SetWordWrap(true)
+	warning.SetText("a request to vanish (kind 62) asks relays to delete everything from your key, including events from others that mention it, and to never accept them again. it cannot be undone.")
+	layout.AddWidget(warning.QWidget)
+
+	allCheck := qt.NewQCheckBox3("all relays (ALL_RELAYS), should be broadcast as widely as possible")
+	layout.AddWidget(allCheck.QWidget)
+	relaysEdit := qt.NewQLineEdit(dialog.QWidget)
+	relaysEdit.SetPlaceholderText("relays that should delete everything, also where it will be published")
+	layout.AddWidget(relaysEdit.QWidget)
+	reasonEdit := qt.NewQTextEdit(dialog.QWidget)
+	reasonEdit.SetAcceptRichText(false)
+	reasonEdit.SetPlaceholderText("reason or legal notice, optional")
+	reasonEdit.SetMaximumHeight(100)
+	layout.AddWidget(reasonEdit.QWidget)
+
+	confirmEdit := qt.NewQLineEdit(dialog.QWidget)
+	confirmEdit.SetPlaceholderText("type VANISH to confirm")
+	layout.AddWidget(confirmEdit.QWidget)
+	publishButton := qt.NewQPushButton5("publish request to vanish", dialog.QWidget)
+	publishButton.SetEnabled(false)
+	layout.AddWidget(publishButton.QWidget)
+	confirmEdit.OnTextChanged(func(text string) {
+		publishButton.SetEnabled(text == "VANISH")
+	})
+
+	resultLabel := qt.NewQLabel2()
+	resultLabel.SetWordWrap(true)
+	layout.AddWidget(resultLabel.QWidget)
+
+	publishButton.OnClicked(func() {
+		relays := parseRelays(relaysEdit.Text())
+		if len(relays) == 0 {
+			resultLabel.SetText("no relays specified")
+			return
+		}
+
+		evt := nostr.Event{
+			Kind:      62,
+			CreatedAt: nostr.Now(),
+			Content:   reasonEdit.ToPlainText(),
+		}
+		if allCheck.IsChecked() {
+			evt.Tags = nostr.Tags{{"relay", "ALL_RELAYS"}}
+		} else {
+			for _, url := range relays {
+				evt.Tags = append(evt.Tags, nostr.Tag{"relay", url})
+			}
+		}
+
+		if qt.QMessageBox_Question6(dialog.QWidget, "request to vanish",
+			"this is your last chance, really ask these relays to erase your key?",
+			qt.QMessageBox__Yes|qt.QMessageBox__No, qt.QMessageBox__No) != qt.QMessageBox__Yes {
+			return
+		}
+
+		publishButton.SetEnabled(false)
+		confirmEdit.SetText("")
+		resultLabel.SetText("signing...")
+		signer.sign("vanish", evt, func(signed nostr.Event) {
+			results := make([]string, 0, len(relays))
+			publishTo(relays, signed, func(url string, err error) {
+				if err != nil {
+					results = append(results, niceRelayURL(url)+": "+err.Error())
+				} else {
+					results = append(results, niceRelayURL(url)+": ok")
+				}
+				resultLabel.SetText(strings.Join(results, "\n"))
+			})
+		})
+	})
+
+	closeButton := qt.NewQPushButton5("close", dialog.QWidget)
+	closeButton.OnClicked(func() { dialog.Close() })
+	layout.AddWidget(closeButton.QWidget)
+
+	dialog.Exec()
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"fiatjaf.com/nostr"
+	"fiatjaf.com/nostr/nip04"
+	"fiatjaf.com/nostr/nip19"
+	qt "github.com/mappu/miqt/qt6"
+	"github.com/mappu/miqt/qt6/mainthread"
+)
+
+type dvmVars struct {
+	tab *qt.QWidget
+
+	kindSpin       *qt.QSpinBox
+	inputsEdit     *qt.QTextEdit
+	paramsEdit     *qt.QTextEdit
+	outputEdit     *qt.QLineEdit
+	bidSpin        *qt.QSpinBox
+	providerEdit   *qt.QLineEdit
+	encryptedCheck *qt.QCheckBox
+	relaysEdit     *qt.QLineEdit
+	timelineList   *qt.QListWidget
+	detailEdit     *qt.QTextEdit
+	resultLabel    *qt.QLabel
+
+	timeline   []nostr.Event
+	plaintexts []string
+	cancel     context.CancelFunc
+}
+
+var dvm = &dvmVars{}
+
+func setupDVMTab() *qt.QWidget {
+	dvm.tab = qt.NewQWidget(window.QWidget)
+	layout := qt.NewQHBoxLayout2()
+	dvm.tab.SetLayout(layout.QLayout)
+
+	// job request
+	form := qt.NewQFormLayout2()
+	layout.AddLayout(form.QLayout)
+
+	dvm.kindSpin = qt.NewQSpinBox(dvm.tab)
+	dvm.kindSpin.SetRange(5000, 5999)
+	dvm.kindSpin.SetValue(5050)
+	form.AddRow3("job kind:", dvm.kindSpin.QWidget)
+
+	dvm.inputsEdit = qt.NewQTextEdit(dvm.tab)
+	dvm.inputsEdit.SetAcceptRichText(false)
+	dvm.inputsEdit.SetPlaceholderText("one input per line: <data> <type: text, url, event or job> [relay] [marker]\nor a JSON array like [\"i\", \"what is nostr?\", \"text\"]")
+	form.AddRow3("inputs:", dvm.inputsEdit.QWidget)
+
+	dvm.paramsEdit = qt.NewQTextEdit(dvm.tab)
+	dvm.paramsEdit.SetAcceptRichText(false)
+	dvm.paramsEdit.SetPlaceholderText("one param per line: <name> <value> [more values]")
+	dvm.paramsEdit.SetMaximumHeight(100)
+	form.AddRow3("params:", dvm.paramsEdit.QWidget)
+
+	dvm.outputEdit = qt.NewQLineEdit(dvm.tab)
+	dvm.outputEdit.SetPlaceholderText("expected output mime type, optional")
+	form.AddRow3("output:", dvm.outputEdit.QWidget)
+
+	dvm.bidSpin = qt.NewQSpinBox(dvm.tab)
+	dvm.bidSpin.SetRange(0, 100_000_000)
+	dvm.bidSpin.SetSuffix(" sats")
+	dvm.bidSpin.SetSpecialValueText("no bid")
+	form.AddRow3("bid:", dvm.bidSpin.QWidget)
+
+	dvm.providerEdit = qt.NewQLineEdit(dvm.tab)
+	dvm.providerEdit.SetPlaceholderText("npub of a specific service provider, optional")
+	form.AddRow3("provider:", dvm.providerEdit.QWidget)
+
+	dvm.encryptedCheck = qt.NewQCheckBox3("encrypt inputs and params to the provider")
+	form.AddRow3("", dvm.encryptedCheck.QWidget)
+
+	dvm.relaysEdit = qt.NewQLineEdit(dvm.tab)
+	dvm.relaysEdit.SetPlaceholderText("relays to publish to and listen for responses on")
+	form.AddRow3("relays:", dvm.relaysEdit.QWidget)
+
+	buttonsHBox := qt.NewQHBoxLayout2()
+	submitButton := qt.NewQPushButton5("submit job", dvm.tab)
+	buttonsHBox.AddWidget(submitButton.QWidget)
+	submitButton.OnClicked(dvm.submit)
+	stopButton := qt.NewQPushButton5("stop listening", dvm.tab)
+	buttonsHBox.AddWidget(stopButton.QWidget)
+	stopButton.OnClicked(func() {
+		if dvm.cancel != nil {
+			dvm.cancel()
+			dvm.cancel = nil
+			dvm.resultLabel.SetText("stopped listening")
+		}
+	})
+	form.AddRowWithLayout(buttonsHBox.QLayout)
+
+	dvm.resultLabel = qt.NewQLabel2()
+	dvm.resultLabel.SetWordWrap(true)
+	form.AddRowWithWidget(dvm.resultLabel.QWidget)
+
+	// job lifecycle
+	timelineVBox := qt.NewQVBoxLayout2()
+	layout.AddLayout(timelineVBox.QLayout)
+	timelineLabel := qt.NewQLabel2()
+	timelineLabel.SetText("job timeline:")
+	timelineVBox.AddWidget(timelineLabel.QWidget)
+	splitter := qt.NewQSplitter3(qt.Vertical)
+	timelineVBox.AddWidget(splitter.QWidget)
+	dvm.timelineList = qt.NewQListWidget(dvm.tab)
+	splitter.AddWidget(dvm.timelineList.QWidget)
+	dvm.detailEdit = qt.NewQTextEdit(dvm.tab)
+	dvm.detailEdit.SetReadOnly(true)
+	splitter.AddWidget(dvm.detailEdit.QWidget)
+	dvm.timelineList.OnCurrentRowChanged(func(row int) {
+		if row >= 0 && row < len(dvm.timeline) {
+			dvm.showDetail(dvm.timeline[row], dvm.plaintexts[row])
+		}
+	})
+
+	return dvm.tab
+}
+
+// parseJobTag reads a line from the inputs or params box into a tag.
+func parseJobTag(name string, line string) (nostr.Tag, error) {
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, "[") {
+		var tag nostr.Tag
+		if err := json.Unmarshal([]byte(line), &tag); err != nil {
+			return nil, fmt.Errorf("invalid JSON tag %s: %w", line, err)
+		}
+		if len(tag) < 2 || tag[0] != name {
+			return nil, fmt.Errorf("expected a %q tag, got %s", name, line)
+		}
+		return tag, nil
+	}
+
+	// inputs are usually long text, so the type goes last and everything before it is the data
+	fields := strings.Fields(line)
+	if name == "i" {
+		for i := len(fields) - 1; i >= 1; i-- {
+			switch fields[i] {
+			case "text", "url", "event", "job":
+				return append(nostr.Tag{"i", strings.Join(fields[:i], " ")}, fields[i:]...), nil
+			}
+		}
+		return nostr.Tag{"i", line, "text"}, nil
+	}
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("param %q has no value", line)
+	}
+	return append(nostr.Tag{"param"}, fields...), nil
+}
+
+func dvmEncrypt(sec nostr.SecretKey, provider nostr.PubKey, plaintext string) (string, error) {
+	shared, err := nip04.ComputeSharedSecret(provider, sec)
+	if err != nil {
+		return "", err
+	}
+	return nip04.Encrypt(plaintext, shared)
+}
+
+// dvmDecrypt handles the nip04 the spec asks for, but also nip44 from providers that use it.
+func dvmDecrypt(ctx context.Context, sec nostr.SecretKey, keyer nostr.Keyer, sender nostr.PubKey, ciphertext string) (string, error) {
+	if strings.Contains(ciphertext, "?iv=") {
+		if sec == [32]byte{} {
+			return "", fmt.Errorf("nip04 needs a local key")
+		}
+		shared, err := nip04.ComputeSharedSecret(sender, sec)
+		if err != nil {
+			return "", err
+		}
+		return nip04.Decrypt(ciphertext, shared)
+	}
+	if keyer == nil {
+		return "", fmt.Errorf("no key loaded")
+	}
+	return keyer.Decrypt(ctx, ciphertext, sender)
+}
+
+func (dvm *dvmVars) submit() {
+	if currentKeyer == nil {
+		dvm.resultLabel.SetText("no key loaded")
+		return
+	}
+	relays := parseRelays(dvm.relaysEdit.Text())
+	if len(relays) == 0 {
+		dvm.resultLabel.SetText("no relays specified")
+		return
+	}
+
+	jobTags := make(nostr.Tags, 0, 4)
+	for _, line := range strings.Split(dvm.inputsEdit.ToPlainText(), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		tag, err := parseJobTag("i", line)
+		if err != nil {
+			dvm.resultLabel.SetText(err.Error())
+			return
+		}
+		jobTags = append(jobTags, tag)
+	}
+	for _, line := range strings.Split(dvm.paramsEdit.ToPlainText(), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		tag, err := parseJobTag("param", line)
+		if err != nil {
+			dvm.resultLabel.SetText(err.Error())
+			return
+		}
+		jobTags = append(jobTags, tag)
+	}
+
+	evt := nostr.Event{
+		Kind:      nostr.Kind(dvm.kindSpin.Value()),
+		CreatedAt: nostr.Now(),
+		Tags:      nostr.Tags{append(nostr.Tag{"relays"}, relays...)},
+	}
+	if output := strings.TrimSpace(dvm.outputEdit.Text()); output != "" {
+		evt.Tags = append(evt.Tags, nostr.Tag{"output", output})
+	}
+	if bid := dvm.bidSpin.Value(); bid > 0 {
+		evt.Tags = append(evt.Tags, nostr.Tag{"bid", strconv.Itoa(bid * 1000)})
+	}
+
+	providerText := strings.TrimSpace(dvm.providerEdit.Text())
+	encrypted := dvm.encryptedCheck.IsChecked()
+	if encrypted && providerText == "" {
+		dvm.resultLabel.SetText("encrypted jobs need a provider")
+		return
+	}
+	// nip90 encryption is nip04, which we can only do with a local key
+	sec := currentSec
+	keyer := currentKeyer
+	if encrypted && sec == [32]byte{} {
+		dvm.resultLabel.SetText("encrypted jobs need a local key, remote signers can't do nip04 here")
+		return
+	}
+
+	dvm.resultLabel.SetText("preparing job...")
+	go func() {
+		// parsePubKey may hit the network for nip05
+		var provider nostr.PubKey
+		if providerText != "" {
+			var err error
+			provider, err = parsePubKey(providerText)
+			if err != nil {
+				mainthread.Wait(func() {
+					dvm.resultLabel.SetText("invalid provider: " + err.Error())
+				})
+				return
+			}
+			evt.Tags = append(evt.Tags, nostr.Tag{"p", provider.Hex()})
+		}
+
+		if encrypted {
+			// inputs and params go in the content, only the provider can read them
+			plaintext, _ := json.Marshal(jobTags)
+			ciphertext, err := dvmEncrypt(sec, provider, string(plaintext))
+			if err != nil {
+				mainthread.Wait(func() {
+					dvm.resultLabel.SetText("failed to encrypt job: " + err.Error())
+				})
+				return
+			}
+			evt.Content = ciphertext
+			evt.Tags = append(evt.Tags, nostr.Tag{"encrypted"})
+		} else {
+			evt.Tags = append(evt.Tags, jobTags...)
+		}
+
+		mainthread.Wait(func() {
+			dvm.resultLabel.SetText("signing...")
+			signer.sign("dvm tab", evt, func(signed nostr.Event) {
+				dvm.follow(signed, relays, sec, keyer)
+
+				results := make([]string, 0, len(relays))
+				publishTo(relays, signed, func(url string, err error) {
+					if err != nil {
+						results = append(results, niceRelayURL(url)+": "+err.Error())
+					} else {
+						results = append(results, niceRelayURL(url)+": ok")
+					}
+					dvm.resultLabel.SetText(strings.Join(results, "\n"))
+				})
+			})
+		})
+	}()
+}
+
+// follow resets the timeline and listens for feedback and results for the job, decrypting with
+// the key that was loaded when it was submitted.
+func (dvm *dvmVars) follow(job nostr.Event, relays []string, sec nostr.SecretKey, keyer nostr.Keyer) {
+	if dvm.cancel != nil {
+		dvm.cancel()
+	}
+	subCtx, cancel := context.WithCancel(ctx)
+	dvm.cancel = cancel
+
+	dvm.timeline = []nostr.Event{job}
+	dvm.plaintexts = []string{""}
+	dvm.timelineList.Clear()
+	dvm.timelineList.AddItem(dvm.describe(job, ""))
+
+	go func() {
+		for ie := range sys.Pool.SubscribeMany(subCtx, relays, nostr.Filter{
+			Kinds: []nostr.Kind{7000, job.Kind + 1000},
+			Tags:  nostr.TagMap{"e": []string{job.ID.Hex()}},
+		}, nostr.SubscriptionOptions{Label: "vnak-dvm"}) {
+			evt := ie.Event
+
+			// encrypted responses only have the status in the clear
+			plaintext := ""
+			if evt.Tags.Has("encrypted") && evt.Content != "" {
+				decryptCtx, cancel := context.WithTimeout(subCtx, time.Second*30)
+				var err error
+				plaintext, err = dvmDecrypt(decryptCtx, sec, keyer, evt.PubKey, evt.Content)
+				cancel()
+				if err != nil {
+					plaintext = "failed to decrypt: " + err.Error()
+				}
+			}
+
+			mainthread.Wait(func() {
+				if subCtx.Err() != nil {
+					return
+				}
+				for _, existing := range dvm.timeline {
+					if existing.ID == evt.ID {
+						return
+					}
+				}
+				dvm.timeline = append(dvm.timeline, evt)
+				dvm.plaintexts = append(dvm.plaintexts, plaintext)
+				dvm.timelineList.AddItem(dvm.describe(evt, plaintext))
+			})
+		}
+	}()
+}
+
+func (dvm *dvmVars) describe(evt nostr.Event, plaintext string) string {
+	when := evt.CreatedAt.Time().Format(time.TimeOnly)
+	from := nip19.EncodeNpub(evt.PubKey)[0:16] + "…"
+	content := evt.Content
+	if plaintext != "" {
+		content = plaintext
+	}
+
+	switch {
+	case evt.Kind >= 5000 && evt.Kind < 6000:
+		return fmt.Sprintf("%s  job request %s (kind %d)", when, evt.ID.Hex()[0:8], evt.Kind)
+	case evt.Kind == 7000:
+		line := fmt.Sprintf("%s  %s", when, from)
+		if status := evt.Tags.Find("status"); status != nil {
+			line += "  status: " + status[1]
+			if len(status) >= 3 && status[2] != "" {
+				line += " (" + status[2] + ")"
+			}
+		}
+		if amount := evt.Tags.Find("amount"); amount != nil {
+			msats, _ := strconv.ParseInt(amount[1], 10, 64)
+			line += fmt.Sprintf("  amount: %d sats", msats/1000)
+			if len(amount) >= 3 {
+				line += "  invoice: " + amount[2]
+			}
+		}
+		if content != "" {
+			line += "\n    " + content
+		}
+		return line
+	default:
+		line := fmt.Sprintf("%s  %s  result (kind %d)", when, from, evt.Kind)
+		if amount := evt.Tags.Find("amount"); amount != nil {
+			msats, _ := strconv.ParseInt(amount[1], 10, 64)
+			line += fmt.Sprintf("  amount: %d sats", msats/1000)
+		}
+		if len(content) > 200 {
+			content = content[0:200] + "…"
+		}
+		return line + "\n    " + content
+	}
+}
+
+func (dvm *dvmVars) showDetail(evt nostr.Event, plaintext string) {
+	pretty, _ := json.MarshalIndent(evt, "", "  ")
+	if plaintext != "" {
+		pretty = append(pretty, []byte("\n\ndecrypted content:\n"+plaintext)...)
+	}
+	dvm.detailEdit.SetPlainText(string(pretty))
+}
@@ -102,6 +102,11 @@ func setupEventTab() *qt.QWidget {
 	buttonHBox := qt.NewQHBoxLayout2()
 	sendButton := qt.NewQPushButton5("send request", event.tab)
 	buttonHBox.AddWidget(sendButton.QWidget)
+	deleteButton := qt.NewQPushButton5("delete", event.tab)
+	buttonHBox.AddWidget(deleteButton.QWidget)
+	vanishButton := qt.NewQPushButton5("request to vanish...", event.tab)
+	buttonHBox.AddWidget(vanishButton.QWidget)
+	vanishButton.OnClicked(openVanishComposer)
 	buttonHBox.AddStretch()
 
 	// relays
@@ -151,20 +156,21 @@ func setupEventTab() *qt.QWidget {
 
 	layout.AddLayout(buttonHBox.QLayout)
 
+	deleteButton.OnClicked(func() {
+		if event.currentEvent == nil || event.currentEvent.Sig == [64]byte{} {
+			statusLabel.SetText("no signed event to delete")
+			return
+		}
+		deleteEvents("event tab", []nostr.Event{*event.currentEvent}, event.relays(), statusLabel.SetText)
+	})
+
 	sendButton.OnClicked(func() {
 		if event.currentEvent == nil {
 			statusLabel.SetText("no event to publish")
 			return
 		}
 
-		// collect relays
-		relays := []string{}
-		for _, edit := range event.relaysEdits {
-			url := strings.TrimSpace(edit.Text())
-			if url != "" {
-				relays = append(relays, nostr.NormalizeURL(url))
-			}
-		}
+		relays := event.relays()
 		if len(relays) == 0 {
 			statusLabel.SetText("no relays specified")
 			return
@@ -257,6 +263,17 @@ func (event *eventVars) addTagRow(tag nostr.Tag) {
 	}
 }
 
+func (event *eventVars) relays() []string {
+	relays := []string{}
+	for _, edit := range event.relaysEdits {
+		url := strings.TrimSpace(edit.Text())
+		if url != "" {
+			relays = append(relays, nostr.NormalizeURL(url))
+		}
+	}
+	return relays
+}
+
 func (event *eventVars) updateEvent() {
 	kind := nostr.Kind(event.kindSpin.Value())
 	kindName := kind.Name()
@@ -299,26 +316,23 @@ func (event *eventVars) updateEvent() {
 	}
 
 	if currentKeyer != nil {
-		signAndFinalize := func() {
-			if currentKeyer != nil {
-				if err := currentKeyer.SignEvent(ctx, &result); err == nil {
-					finalize()
-				} else {
-					statusLabel.SetText("failed to sign: " + err.Error())
-				}
-			}
-		}
-
 		if currentSec == [32]byte{} {
-			// empty key, we must have a bunker
+			// empty key, we must have a bunker, so queue a signature request in the background
 			debounced.Call(func() {
 				mainthread.Wait(func() {
-					signAndFinalize()
+					signer.sign("event tab", result, func(signed nostr.Event) {
+						result = signed
+						finalize()
+					})
 				})
 			})
 		} else {
 			// we have a key, can sign immediately
-			signAndFinalize()
+			if err := currentKeyer.SignEvent(ctx, &result); err == nil {
+				finalize()
+			} else {
+				statusLabel.SetText("failed to sign: " + err.Error())
+			}
 			return
 		}
 	}
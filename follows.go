@@ -0,0 +1,512 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"fiatjaf.com/nostr"
+	"fiatjaf.com/nostr/nip19"
+	qt "github.com/mappu/miqt/qt6"
+	"github.com/mappu/miqt/qt6/mainthread"
+)
+
+type followsVars struct {
+	tab *qt.QWidget
+
+	infoLabel     *qt.QLabel
+	list          *qt.QListWidget
+	addEdit       *qt.QLineEdit
+	petnameEdit   *qt.QLineEdit
+	relayHintEdit *qt.QLineEdit
+	versionsCombo *qt.QComboBox
+	relaysEdit    *qt.QLineEdit
+	resultsLabel  *qt.QLabel
+
+	pubkey   nostr.PubKey
+	loaded   bool
+	follows  []followEntry
+	names    map[nostr.PubKey]string
+	versions []nostr.Event
+}
+
+type followEntry struct {
+	pubkey  nostr.PubKey
+	relay   string
+	petname string
+}
+
+var follows = &followsVars{
+	names: make(map[nostr.PubKey]string),
+}
+
+func setupFollowsTab() *qt.QWidget {
+	follows.tab = qt.NewQWidget(window.QWidget)
+	layout := qt.NewQVBoxLayout2()
+	follows.tab.SetLayout(layout.QLayout)
+
+	// load
+	loadHBox := qt.NewQHBoxLayout2()
+	layout.AddLayout(loadHBox.QLayout)
+	loadButton := qt.NewQPushButton5("load current follow list", follows.tab)
+	loadHBox.AddWidget(loadButton.QWidget)
+	follows.infoLabel = qt.NewQLabel2()
+	loadHBox.AddWidget(follows.infoLabel.QWidget)
+	loadHBox.AddStretch()
+	loadButton.OnClicked(follows.load)
+
+	// list
+	follows.list = qt.NewQListWidget(follows.tab)
+	follows.list.SetSelectionMode(qt.QAbstractItemView__ExtendedSelection)
+	layout.AddWidget(follows.list.QWidget)
+
+	// add
+	addHBox := qt.NewQHBoxLayout2()
+	layout.AddLayout(addHBox.QLayout)
+	follows.addEdit = qt.NewQLineEdit(follows.tab)
+	follows.addEdit.SetPlaceholderText("npub, nprofile, hex or nip05")
+	addHBox.AddWidget(follows.addEdit.QWidget)
+	follows.petnameEdit = qt.NewQLineEdit(follows.tab)
+	follows.petnameEdit.SetPlaceholderText("petname")
+	follows.petnameEdit.SetMaximumWidth(150)
+	addHBox.AddWidget(follows.petnameEdit.QWidget)
+	follows.relayHintEdit = qt.NewQLineEdit(follows.tab)
+	follows.relayHintEdit.SetPlaceholderText("relay hint")
+	follows.relayHintEdit.SetMaximumWidth(200)
+	addHBox.AddWidget(follows.relayHintEdit.QWidget)
+	addButton := qt.NewQPushButton5("add", follows.tab)
+	addHBox.AddWidget(addButton.QWidget)
+	addButton.OnClicked(follows.add)
+	follows.addEdit.OnReturnPressed(follows.add)
+	removeButton := qt.NewQPushButton5("remove selected", follows.tab)
+	addHBox.AddWidget(removeButton.QWidget)
+	removeButton.OnClicked(follows.removeSelected)
+	importButton := qt.NewQPushButton5("bulk import", follows.tab)
+	addHBox.AddWidget(importButton.QWidget)
+	importButton.OnClicked(follows.openImportDialog)
+
+	// versions
+	versionsHBox := qt.NewQHBoxLayout2()
+	layout.AddLayout(versionsHBox.QLayout)
+	versionsLabel := qt.NewQLabel2()
+	versionsLabel.SetText("compare with version:")
+	versionsHBox.AddWidget(versionsLabel.QWidget)
+	follows.versionsCombo = qt.NewQComboBox(follows.tab)
+	versionsHBox.AddWidget(follows.versionsCombo.QWidget)
+	diffButton := qt.NewQPushButton5("diff", follows.tab)
+	versionsHBox.AddWidget(diffButton.QWidget)
+	diffButton.OnClicked(func() {
+		follows.showDiff(false)
+	})
+	restoreButton := qt.NewQPushButton5("restore this version", follows.tab)
+	versionsHBox.AddWidget(restoreButton.QWidget)
+	restoreButton.OnClicked(func() {
+		if idx := follows.versionsCombo.CurrentIndex(); idx >= 0 && idx < len(follows.versions) {
+			follows.follows = followsFromEvent(follows.versions[idx])
+			follows.render()
+		}
+	})
+	versionsHBox.AddStretch()
+
+	// publish
+	publishHBox := qt.NewQHBoxLayout2()
+	layout.AddLayout(publishHBox.QLayout)
+	relaysLabel := qt.NewQLabel2()
+	relaysLabel.SetText("relays:")
+	publishHBox.AddWidget(relaysLabel.QWidget)
+	follows.relaysEdit = qt.NewQLineEdit(follows.tab)
+	follows.relaysEdit.SetPlaceholderText("space-separated relay urls, filled with your write relays on load")
+	publishHBox.AddWidget(follows.relaysEdit.QWidget)
+	publishButton := qt.NewQPushButton5("review and publish", follows.tab)
+	publishHBox.AddWidget(publishButton.QWidget)
+	publishButton.OnClicked(func() {
+		follows.showDiff(true)
+	})
+	follows.resultsLabel = qt.NewQLabel2()
+	follows.resultsLabel.SetWordWrap(true)
+	layout.AddWidget(follows.resultsLabel.QWidget)
+
+	return follows.tab
+}
+
+func followsFromEvent(evt nostr.Event) []followEntry {
+	entries := make([]followEntry, 0, len(evt.Tags))
+	for _, tag := range evt.Tags {
+		if len(tag) < 2 || tag[0] != "p" {
+			continue
+		}
+		pk, err := nostr.PubKeyFromHex(tag[1])
+		if err != nil {
+			continue
+		}
+		entry := followEntry{pubkey: pk}
+		if len(tag) >= 3 {
+			entry.relay = tag[2]
+		}
+		if len(tag) >= 4 {
+			entry.petname = tag[3]
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func (follows *followsVars) load() {
+	withCurrentPubKey(func(pk nostr.PubKey) {
+		follows.pubkey = pk
+		follows.loaded = false
+		follows.infoLabel.SetText("loading...")
+
+		go func() {
+			fetchCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+			defer cancel()
+
+			writeRelays := sys.FetchWriteRelays(fetchCtx, pk)
+			relays := append(sys.FetchOutboxRelays(fetchCtx, pk, 4), writeRelays...)
+
+			// gather every version we can find, relays may have kept some old ones
+			versions := make([]nostr.Event, 0, 5)
+			if fl := sys.FetchFollowList(fetchCtx, pk); fl.Event != nil {
+				versions = append(versions, *fl.Event)
+			}
+			for ie := range sys.Pool.FetchMany(fetchCtx, relays, nostr.Filter{
+				Kinds:   []nostr.Kind{3},
+				Authors: []nostr.PubKey{pk},
+				Limit:   20,
+			}, nostr.SubscriptionOptions{Label: "vnak-follows"}) {
+				if !slices.ContainsFunc(versions, func(evt nostr.Event) bool { return evt.ID == ie.Event.ID }) {
+					versions = append(versions, ie.Event)
+				}
+			}
+			slices.SortFunc(versions, func(a, b nostr.Event) int { return int(b.CreatedAt - a.CreatedAt) })
+
+			mainthread.Wait(func() {
+				follows.versions = versions
+				follows.loaded = true
+				follows.versionsCombo.Clear()
+				for i, evt := range versions {
+					label := fmt.Sprintf("%s (%d follows)", evt.CreatedAt.Time().Format(time.DateTime), len(followsFromEvent(evt)))
+					if i == 0 {
+						label += ", latest"
+					}
+					follows.versionsCombo.AddItem(label)
+				}
+
+				if len(versions) > 0 {
+					follows.follows = followsFromEvent(versions[0])
+					follows.infoLabel.SetText(fmt.Sprintf("%d versions found, latest from %s",
+						len(versions), versions[0].CreatedAt.Time().Format(time.DateTime)))
+				} else {
+					follows.follows = nil
+					follows.infoLabel.SetText("no follow list found")
+				}
+				if len(writeRelays) > 0 {
+					follows.relaysEdit.SetText(strings.Join(writeRelays, " "))
+				}
+				follows.render()
+			})
+		}()
+	})
+}
+
+func (follows *followsVars) describe(entry followEntry) string {
+	text := nip19.EncodeNpub(entry.pubkey)
+	if name, ok := follows.names[entry.pubkey]; ok {
+		text = name + "  " + text
+	}
+	if entry.petname != "" {
+		text += "  petname: " + entry.petname
+	}
+	if entry.relay != "" {
+		text += "  relay: " + entry.relay
+	}
+	return text
+}
+
+func (follows *followsVars) render() {
+	follows.list.Clear()
+	for _, entry := range follows.follows {
+		follows.list.AddItem(follows.describe(entry))
+	}
+	follows.resultsLabel.SetText(fmt.Sprintf("%d follows", len(follows.follows)))
+	follows.resolveNames()
+}
+
+// resolveNames fetches kind 0 for every follow whose name we don't know yet and updates the rows.
+func (follows *followsVars) resolveNames() {
+	missing := make([]nostr.PubKey, 0, len(follows.follows))
+	for _, entry := range follows.follows {
+		if _, ok := follows.names[entry.pubkey]; !ok {
+			missing = append(missing, entry.pubkey)
+		}
+	}
+
+	semaphore := make(chan struct{}, 20)
+	for _, pk := range missing {
+		go func() {
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			fetchCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+			defer cancel()
+			pm := sys.FetchProfileMetadata(fetchCtx, pk)
+			if pm.Event == nil {
+				return
+			}
+
+			mainthread.Wait(func() {
+				follows.names[pk] = pm.ShortName()
+				for i, entry := range follows.follows {
+					if entry.pubkey == pk {
+						follows.list.Item(i).SetText(follows.describe(entry))
+					}
+				}
+			})
+		}()
+	}
+}
+
+func (follows *followsVars) add() {
+	value := strings.TrimSpace(follows.addEdit.Text())
+	if value == "" {
+		return
+	}
+	petname := strings.TrimSpace(follows.petnameEdit.Text())
+	relay := strings.TrimSpace(follows.relayHintEdit.Text())
+
+	// parsePubKey may hit the network for nip05
+	go func() {
+		pk, err := parsePubKey(value)
+		mainthread.Wait(func() {
+			if err != nil {
+				follows.resultsLabel.SetText(err.Error())
+				return
+			}
+			if relay == "" {
+				if prefix, decoded, err := nip19.Decode(value); err == nil && prefix == "nprofile" {
+					if pp := decoded.(nostr.ProfilePointer); len(pp.Relays) > 0 {
+						relay = pp.Relays[0]
+					}
+				}
+			}
+			if !follows.addEntry(followEntry{pubkey: pk, relay: relay, petname: petname}) {
+				follows.resultsLabel.SetText("already following " + nip19.EncodeNpub(pk))
+				return
+			}
+			follows.addEdit.SetText("")
+			follows.petnameEdit.SetText("")
+			follows.relayHintEdit.SetText("")
+			follows.render()
+		})
+	}()
+}
+
+func (follows *followsVars) addEntry(entry followEntry) bool {
+	if slices.ContainsFunc(follows.follows, func(f followEntry) bool { return f.pubkey == entry.pubkey }) {
+		return false
+	}
+	follows.follows = append(follows.follows, entry)
+	return true
+}
+
+func (follows *followsVars) removeSelected() {
+	rows := make([]int, 0, 4)
+	for _, item := range follows.list.SelectedItems() {
+		rows = append(rows, follows.list.Row(item))
+	}
+	slices.Sort(rows)
+	for i := len(rows) - 1; i >= 0; i-- {
+		follows.follows = slices.Delete(follows.follows, rows[i], rows[i]+1)
+	}
+	follows.render()
+}
+
+func (follows *followsVars) openImportDialog() {
+	dialog := qt.NewQDialog(window.QWidget)
+	dialog.SetWindowTitle("import follows")
+	dialog.SetMinimumWidth(500)
+	dialog.SetMinimumHeight(400)
+	layout := qt.NewQVBoxLayout2()
+	dialog.SetLayout(layout.QLayout)
+
+	label := qt.NewQLabel2()
+	label.SetText("one npub, nprofile, hex pubkey or nip05 per line:")
+	layout.AddWidget(label.QWidget)
+	textEdit := qt.NewQTextEdit(dialog.QWidget)
+	layout.AddWidget(textEdit.QWidget)
+	resultLabel := qt.NewQLabel2()
+	resultLabel.SetWordWrap(true)
+	layout.AddWidget(resultLabel.QWidget)
+	importButton := qt.NewQPushButton5("import", dialog.QWidget)
+	layout.AddWidget(importButton.QWidget)
+
+	importButton.OnClicked(func() {
+		lines := strings.Split(textEdit.ToPlainText(), "\n")
+		importButton.SetEnabled(false)
+		resultLabel.SetText("importing...")
+
+		go func() {
+			added := 0
+			failed := make([]string, 0, 4)
+			for _, line := range lines {
+				line = strings.TrimSpace(line)
+				if line == "" {
+					continue
+				}
+				pk, err := parsePubKey(line)
+				if err != nil {
+					failed = append(failed, line)
+					continue
+				}
+				mainthread.Wait(func() {
+					if follows.addEntry(followEntry{pubkey: pk}) {
+						added++
+					}
+				})
+			}
+
+			mainthread.Wait(func() {
+				importButton.SetEnabled(true)
+				text := fmt.Sprintf("%d added", added)
+				if len(failed) > 0 {
+					text += fmt.Sprintf(", %d failed:\n%s", len(failed), strings.Join(failed, "\n"))
+				}
+				resultLabel.SetText(text)
+				follows.render()
+			})
+		}()
+	})
+
+	dialog.Exec()
+}
+
+// showDiff shows what changed against the selected version and, if publish is set, offers to publish.
+func (follows *followsVars) showDiff(publish bool) {
+	var base []followEntry
+	baseName := "nothing"
+	if idx := follows.versionsCombo.CurrentIndex(); idx >= 0 && idx < len(follows.versions) {
+		base = followsFromEvent(follows.versions[idx])
+		baseName = follows.versionsCombo.CurrentText()
+	}
+
+	added := make([]string, 0, 4)
+	for _, entry := range follows.follows {
+		if !slices.ContainsFunc(base, func(f followEntry) bool { return f.pubkey == entry.pubkey }) {
+			added = append(added, "+ "+follows.describe(entry))
+		}
+	}
+	removed := make([]string, 0, 4)
+	for _, entry := range base {
+		if !slices.ContainsFunc(follows.follows, func(f followEntry) bool { return f.pubkey == entry.pubkey }) {
+			removed = append(removed, "- "+follows.describe(entry))
+		}
+	}
+
+	dialog := qt.NewQDialog(window.QWidget)
+	dialog.SetWindowTitle("follow list diff")
+	dialog.SetMinimumWidth(600)
+	dialog.SetMinimumHeight(400)
+	layout := qt.NewQVBoxLayout2()
+	dialog.SetLayout(layout.QLayout)
+	summary := qt.NewQLabel2()
+	summary.SetText(fmt.Sprintf("against %s: %d added, %d removed, %d total", baseName, len(added), len(removed), len(follows.follows)))
+	layout.AddWidget(summary.QWidget)
+	diffEdit := qt.NewQTextEdit(dialog.QWidget)
+	diffEdit.SetReadOnly(true)
+	diffEdit.SetPlainText(strings.Join(append(added, removed...), "\n"))
+	layout.AddWidget(diffEdit.QWidget)
+
+	buttonsHBox := qt.NewQHBoxLayout2()
+	layout.AddLayout(buttonsHBox.QLayout)
+	if publish {
+		publishButton := qt.NewQPushButton5("publish", dialog.QWidget)
+		buttonsHBox.AddWidget(publishButton.QWidget)
+		publishButton.OnClicked(func() {
+			if len(follows.follows) == 0 {
+				answer := qt.QMessageBox_Question6(dialog.QWidget, "empty follow list",
+					"you are about to publish an empty follow list, which will wipe all your follows. are you sure?",
+					qt.QMessageBox__Yes|qt.QMessageBox__No, qt.QMessageBox__No)
+				if answer != qt.QMessageBox__Yes {
+					return
+				}
+			}
+			dialog.Close()
+			follows.publish()
+		})
+	}
+	closeButton := qt.NewQPushButton5("close", dialog.QWidget)
+	buttonsHBox.AddWidget(closeButton.QWidget)
+	closeButton.OnClicked(func() { dialog.Close() })
+
+	dialog.Exec()
+}
+
+func (follows *followsVars) publish() {
+	relays := parseRelays(follows.relaysEdit.Text())
+	if len(relays) == 0 {
+		follows.resultsLabel.SetText("no relays specified")
+		return
+	}
+
+	// a kind 3 replaces the whole list, so publishing without the current one would wipe it
+	if !follows.loaded {
+		follows.resultsLabel.SetText("load the current follow list first")
+		return
+	}
+	if len(follows.versions) == 0 && qt.QMessageBox_Question6(window.QWidget, "publish follow list",
+		fmt.Sprintf("no previous follow list was found for this key, publish a new one with %d follows?", len(follows.follows)),
+		qt.QMessageBox__Yes|qt.QMessageBox__No, qt.QMessageBox__No) != qt.QMessageBox__Yes {
+		return
+	}
+
+	// keep whatever else was in the latest version
+	evt := nostr.Event{
+		Kind:      3,
+		CreatedAt: nostr.Now(),
+		Tags:      make(nostr.Tags, 0, len(follows.follows)),
+	}
+	if len(follows.versions) > 0 {
+		evt.Content = follows.versions[0].Content
+		for _, tag := range follows.versions[0].Tags {
+			if len(tag) >= 1 && tag[0] != "p" {
+				evt.Tags = append(evt.Tags, tag)
+			}
+		}
+	}
+	for _, entry := range follows.follows {
+		tag := nostr.Tag{"p", entry.pubkey.Hex()}
+		if entry.relay != "" || entry.petname != "" {
+			tag = append(tag, entry.relay)
+		}
+		if entry.petname != "" {
+			tag = append(tag, entry.petname)
+		}
+		evt.Tags = append(evt.Tags, tag)
+	}
+
+	follows.resultsLabel.SetText("signing...")
+	signer.sign("follows tab", evt, func(signed nostr.Event) {
+		if signed.PubKey != follows.pubkey {
+			follows.resultsLabel.SetText("the loaded follow list belongs to another key, load it again")
+			return
+		}
+
+		results := make([]string, 0, len(relays))
+		publishTo(relays, signed, func(url string, err error) {
+			if err != nil {
+				results = append(results, niceRelayURL(url)+": "+err.Error())
+			} else {
+				results = append(results, niceRelayURL(url)+": ok")
+			}
+			follows.resultsLabel.SetText(strings.Join(results, "\n"))
+		})
+
+		// the new version becomes the latest
+		follows.versions = append([]nostr.Event{signed}, follows.versions...)
+		follows.versionsCombo.InsertItem(0, fmt.Sprintf("%s (%d follows), just published",
+			signed.CreatedAt.Time().Format(time.DateTime), len(follows.follows)))
+		follows.versionsCombo.SetCurrentIndex(0)
+	})
+}
@@ -0,0 +1,611 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"fiatjaf.com/nostr"
+	"fiatjaf.com/nostr/nip19"
+	"fiatjaf.com/nostr/nip34"
+	"github.com/bluekeyes/go-gitdiff/gitdiff"
+	qt "github.com/mappu/miqt/qt6"
+	"github.com/mappu/miqt/qt6/mainthread"
+)
+
+type gitVars struct {
+	tab *qt.QWidget
+
+	naddrEdit     *qt.QLineEdit
+	infoLabel     *qt.QLabel
+	itemsList     *qt.QListWidget
+	viewEdit      *qt.QTextEdit
+	statusCombo   *qt.QComboBox
+	statusEdit    *qt.QLineEdit
+	repoPathEdit  *qt.QLineEdit
+	rangeEdit     *qt.QLineEdit
+	resultLabel   *qt.QLabel
+	showClosedBox *qt.QCheckBox
+
+	pointer    nostr.EntityPointer
+	repo       *nip34.Repository
+	relays     []string
+	roots      []nostr.Event
+	shown      []nostr.Event
+	thread     map[nostr.ID][]nostr.Event
+	statuses   map[nostr.ID]nostr.Event
+	loadSerial int
+}
+
+var statusKinds = []nostr.Kind{
+	nostr.KindStatusOpen,
+	nostr.KindStatusApplied,
+	nostr.KindStatusClosed,
+	nostr.KindStatusDraft,
+}
+
+var statusNames = map[nostr.Kind]string{
+	nostr.KindStatusOpen:    "open",
+	nostr.KindStatusApplied: "applied",
+	nostr.KindStatusClosed:  "closed",
+	nostr.KindStatusDraft:   "draft",
+}
+
+var formatPatchSeparator = regexp.MustCompile(`(?m)^From ([0-9a-f]{40}) Mon Sep 17 00:00:00 2001$`)
+
+var git = &gitVars{}
+
+func setupGitTab() *qt.QWidget {
+	git.tab = qt.NewQWidget(window.QWidget)
+	layout := qt.NewQVBoxLayout2()
+	git.tab.SetLayout(layout.QLayout)
+
+	// repository
+	repoHBox := qt.NewQHBoxLayout2()
+	layout.AddLayout(repoHBox.QLayout)
+	git.naddrEdit = qt.NewQLineEdit(git.tab)
+	git.naddrEdit.SetPlaceholderText("repository naddr1...")
+	repoHBox.AddWidget(git.naddrEdit.QWidget)
+	loadButton := qt.NewQPushButton5("load", git.tab)
+	repoHBox.AddWidget(loadButton.QWidget)
+	loadButton.OnClicked(git.load)
+	git.naddrEdit.OnReturnPressed(git.load)
+	git.showClosedBox = qt.NewQCheckBox3("show closed and applied")
+	git.showClosedBox.SetChecked(true)
+	repoHBox.AddWidget(git.showClosedBox.QWidget)
+	git.showClosedBox.OnToggled(func(bool) { git.render() })
+	git.infoLabel = qt.NewQLabel2()
+	git.infoLabel.SetWordWrap(true)
+	layout.AddWidget(git.infoLabel.QWidget)
+
+	// patches and issues
+	git.itemsList = qt.NewQListWidget(git.tab)
+	git.itemsList.SetMaximumHeight(200)
+	layout.AddWidget(git.itemsList.QWidget)
+	git.viewEdit = qt.NewQTextEdit(git.tab)
+	git.viewEdit.SetReadOnly(true)
+	layout.AddWidget(git.viewEdit.QWidget)
+	git.itemsList.OnCurrentRowChanged(git.showItem)
+
+	// status
+	statusHBox := qt.NewQHBoxLayout2()
+	layout.AddLayout(statusHBox.QLayout)
+	gitStatusLabel := qt.NewQLabel2()
+	gitStatusLabel.SetText("set status:")
+	statusHBox.AddWidget(gitStatusLabel.QWidget)
+	git.statusCombo = qt.NewQComboBox(git.tab)
+	for _, kind := range statusKinds {
+		git.statusCombo.AddItem(fmt.Sprintf("%s (%d)", statusNames[kind], kind))
+	}
+	statusHBox.AddWidget(git.statusCombo.QWidget)
+	git.statusEdit = qt.NewQLineEdit(git.tab)
+	git.statusEdit.SetPlaceholderText("optional comment")
+	statusHBox.AddWidget(git.statusEdit.QWidget)
+	statusButton := qt.NewQPushButton5("publish status", git.tab)
+	statusHBox.AddWidget(statusButton.QWidget)
+	statusButton.OnClicked(git.publishStatus)
+
+	// patch creation
+	patchHBox := qt.NewQHBoxLayout2()
+	layout.AddLayout(patchHBox.QLayout)
+	git.repoPathEdit = qt.NewQLineEdit(git.tab)
+	git.repoPathEdit.SetPlaceholderText("local git repository")
+	patchHBox.AddWidget(git.repoPathEdit.QWidget)
+	browseButton := qt.NewQPushButton5("browse", git.tab)
+	patchHBox.AddWidget(browseButton.QWidget)
+	browseButton.OnClicked(func() {
+		if dir := qt.QFileDialog_GetExistingDirectory3(window.QWidget, "git repository", git.repoPathEdit.Text()); dir != "" {
+			git.repoPathEdit.SetText(dir)
+		}
+	})
+	git.rangeEdit = qt.NewQLineEdit(git.tab)
+	git.rangeEdit.SetText("HEAD~1..HEAD")
+	git.rangeEdit.SetMaximumWidth(200)
+	patchHBox.AddWidget(git.rangeEdit.QWidget)
+	patchButton := qt.NewQPushButton5("send patches", git.tab)
+	patchHBox.AddWidget(patchButton.QWidget)
+	patchButton.OnClicked(git.sendPatches)
+
+	git.resultLabel = qt.NewQLabel2()
+	git.resultLabel.SetWordWrap(true)
+	layout.AddWidget(git.resultLabel.QWidget)
+
+	return git.tab
+}
+
+func (git *gitVars) address() string {
+	return fmt.Sprintf("%d:%s:%s", nostr.KindRepositoryAnnouncement, git.pointer.PublicKey.Hex(), git.pointer.Identifier)
+}
+
+func (git *gitVars) load() {
+	prefix, decoded, err := nip19.Decode(strings.TrimSpace(git.naddrEdit.Text()))
+	if err != nil || prefix != "naddr" {
+		git.infoLabel.SetText("expected a repository naddr")
+		return
+	}
+	pointer := decoded.(nostr.EntityPointer)
+	if pointer.Kind != nostr.KindRepositoryAnnouncement {
+		git.infoLabel.SetText(fmt.Sprintf("expected a kind %d naddr, got kind %d", nostr.KindRepositoryAnnouncement, pointer.Kind))
+		return
+	}
+
+	git.pointer = pointer
+	git.repo = nil
+	git.roots = nil
+	git.thread = make(map[nostr.ID][]nostr.Event)
+	git.statuses = make(map[nostr.ID]nostr.Event)
+	git.loadSerial++
+	serial := git.loadSerial
+	address := git.address()
+	git.render()
+	git.infoLabel.SetText("loading...")
+
+	go func() {
+		fetchCtx, cancel := context.WithTimeout(ctx, time.Second*15)
+		defer cancel()
+
+		relays := append(slices.Clone(pointer.Relays), sys.FetchOutboxRelays(fetchCtx, pointer.PublicKey, 3)...)
+		var repo *nip34.Repository
+		if ie := sys.Pool.QuerySingle(fetchCtx, relays, nostr.Filter{
+			Kinds:   []nostr.Kind{nostr.KindRepositoryAnnouncement},
+			Authors: []nostr.PubKey{pointer.PublicKey},
+			Tags:    nostr.TagMap{"d": []string{pointer.Identifier}},
+		}, nostr.SubscriptionOptions{Label: "vnak-git"}); ie != nil {
+			r := nip34.ParseRepository(ie.Event)
+			repo = &r
+			relays = append(relays, r.Relays...)
+		}
+		relays = parseRelays(strings.Join(relays, " "))
+
+		roots := make([]nostr.Event, 0, 20)
+		series := make([]nostr.Event, 0, 20)
+		for ie := range sys.Pool.FetchMany(fetchCtx, relays, nostr.Filter{
+			Kinds: []nostr.Kind{nostr.KindPatch, nostr.KindIssue},
+			Tags:  nostr.TagMap{"a": []string{address}},
+			Limit: 500,
+		}, nostr.SubscriptionOptions{Label: "vnak-git"}) {
+			if ie.Event.Kind == nostr.KindPatch && ie.Event.Tags.FindWithValue("t", "root") == nil && ie.Event.Tags.Find("e") != nil {
+				// patches after the first in a series, they belong to some thread
+				series = append(series, ie.Event)
+			} else {
+				roots = append(roots, ie.Event)
+			}
+		}
+		slices.SortFunc(roots, func(a, b nostr.Event) int { return int(b.CreatedAt - a.CreatedAt) })
+
+		ids := make([]string, len(roots))
+		for i, root := range roots {
+			ids[i] = root.ID.Hex()
+		}
+		thread := make(map[nostr.ID][]nostr.Event)
+		statuses := make(map[nostr.ID]nostr.Event)
+		if len(ids) > 0 {
+			// events reference the root directly, except patches in a series that may reference the previous one
+			rootOf := make(map[string]nostr.ID, len(ids))
+			for _, root := range roots {
+				rootOf[root.ID.Hex()] = root.ID
+			}
+			addToThread := func(evt nostr.Event) bool {
+				for _, tag := range evt.Tags {
+					if len(tag) >= 2 && (tag[0] == "e" || tag[0] == "E") {
+						if id, ok := rootOf[tag[1]]; ok {
+							if !slices.ContainsFunc(thread[id], func(t nostr.Event) bool { return t.ID == evt.ID }) {
+								thread[id] = append(thread[id], evt)
+								rootOf[evt.ID.Hex()] = id
+							}
+							return true
+						}
+					}
+				}
+				return false
+			}
+			for len(series) > 0 {
+				remaining := series[:0]
+				for _, evt := range series {
+					if !addToThread(evt) {
+						remaining = append(remaining, evt)
+					}
+				}
+				if len(remaining) == len(series) {
+					break
+				}
+				series = remaining
+			}
+			for ie := range sys.Pool.FetchMany(fetchCtx, relays, nostr.Filter{
+				Kinds: append(slices.Clone(statusKinds), nostr.KindComment, 1622),
+				Tags:  nostr.TagMap{"e": ids},
+				Limit: 1000,
+			}, nostr.SubscriptionOptions{Label: "vnak-git"}) {
+				addToThread(ie.Event)
+			}
+			for ie := range sys.Pool.FetchMany(fetchCtx, relays, nostr.Filter{
+				Kinds: []nostr.Kind{nostr.KindComment},
+				Tags:  nostr.TagMap{"E": ids},
+				Limit: 1000,
+			}, nostr.SubscriptionOptions{Label: "vnak-git"}) {
+				addToThread(ie.Event)
+			}
+		}
+
+		mainthread.Wait(func() {
+			if serial != git.loadSerial {
+				return
+			}
+			git.repo = repo
+			git.relays = relays
+			git.roots = roots
+			git.thread = thread
+			for _, root := range roots {
+				slices.SortFunc(thread[root.ID], func(a, b nostr.Event) int { return int(a.CreatedAt - b.CreatedAt) })
+				if status, ok := git.latestStatus(root); ok {
+					statuses[root.ID] = status
+				}
+			}
+			git.statuses = statuses
+
+			info := fmt.Sprintf("%s by %s", pointer.Identifier, nip19.EncodeNpub(pointer.PublicKey))
+			if repo != nil {
+				if repo.Name != "" {
+					info = repo.Name + " (" + info + ")"
+				}
+				if repo.Description != "" {
+					info += "\n" + repo.Description
+				}
+			} else {
+				info += "\nrepository announcement not found"
+			}
+			info += fmt.Sprintf("\n%d patches and issues on %s", len(roots), strings.Join(niceRelayURLs(relays), ", "))
+			git.infoLabel.SetText(info)
+			git.render()
+		})
+	}()
+}
+
+// latestStatus only considers status events from the root author and the repository maintainers.
+func (git *gitVars) latestStatus(root nostr.Event) (nostr.Event, bool) {
+	allowed := []nostr.PubKey{root.PubKey, git.pointer.PublicKey}
+	if git.repo != nil {
+		allowed = append(allowed, git.repo.Maintainers...)
+	}
+
+	var latest nostr.Event
+	found := false
+	for _, evt := range git.thread[root.ID] {
+		if slices.Contains(statusKinds, evt.Kind) && slices.Contains(allowed, evt.PubKey) && (!found || evt.CreatedAt > latest.CreatedAt) {
+			latest = evt
+			found = true
+		}
+	}
+	return latest, found
+}
+
+func (git *gitVars) statusOf(root nostr.Event) string {
+	if status, ok := git.statuses[root.ID]; ok {
+		return statusNames[status.Kind]
+	}
+	return "open"
+}
+
+func subjectOf(evt nostr.Event) string {
+	if evt.Kind == nostr.KindPatch {
+		if patch := nip34.ParsePatch(evt); patch.Header != nil && patch.Header.Title != "" {
+			return patch.Header.Title
+		}
+		for _, line := range strings.Split(evt.Content, "\n") {
+			if subject, ok := strings.CutPrefix(line, "Subject: "); ok {
+				return subject
+			}
+		}
+	}
+	if subject := evt.Tags.Find("subject"); subject != nil {
+		return subject[1]
+	}
+	line, _, _ := strings.Cut(strings.TrimSpace(evt.Content), "\n")
+	if len(line) > 80 {
+		line = line[:80] + "…"
+	}
+	return line
+}
+
+func (git *gitVars) render() {
+	git.shown = git.shown[:0]
+	git.itemsList.Clear()
+	git.viewEdit.Clear()
+	for _, root := range git.roots {
+		status := git.statusOf(root)
+		if !git.showClosedBox.IsChecked() && (status == "closed" || status == "applied") {
+			continue
+		}
+		kind := "issue"
+		if root.Kind == nostr.KindPatch {
+			kind = "patch"
+		}
+		git.itemsList.AddItem(fmt.Sprintf("[%s] %s: %s  (%s, %s, %d replies)",
+			kind, status, subjectOf(root), nip19.EncodeNpub(root.PubKey)[0:16]+"…",
+			root.CreatedAt.Time().Format(time.DateOnly), len(git.thread[root.ID])))
+		git.shown = append(git.shown, root)
+	}
+}
+
+func (git *gitVars) selected() *nostr.Event {
+	if row := git.itemsList.CurrentRow(); row >= 0 && row < len(git.shown) {
+		return &git.shown[row]
+	}
+	return nil
+}
+
+func (git *gitVars) showItem(int) {
+	root := git.selected()
+	if root == nil {
+		git.viewEdit.Clear()
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString(renderGitEvent(*root))
+	for _, evt := range git.thread[root.ID] {
+		b.WriteString("<hr>")
+		b.WriteString(renderGitEvent(evt))
+	}
+	git.viewEdit.SetHtml(b.String())
+}
+
+func renderGitEvent(evt nostr.Event) string {
+	var b strings.Builder
+	label := fmt.Sprintf("kind %d", evt.Kind)
+	switch evt.Kind {
+	case nostr.KindPatch:
+		label = "patch"
+	case nostr.KindIssue:
+		label = "issue"
+	case nostr.KindComment, 1622:
+		label = "reply"
+	default:
+		if name, ok := statusNames[evt.Kind]; ok {
+			label = "status: " + name
+		}
+	}
+	fmt.Fprintf(&b, "<p><b>%s</b> by %s at %s</p>", label,
+		html.EscapeString(nip19.EncodeNpub(evt.PubKey)), evt.CreatedAt.Time().Format(time.DateTime))
+
+	if evt.Kind == nostr.KindPatch {
+		b.WriteString(renderPatch(evt))
+	} else if evt.Content != "" {
+		fmt.Fprintf(&b, "<pre style=\"white-space: pre-wrap\">%s</pre>", html.EscapeString(evt.Content))
+	}
+	return b.String()
+}
+
+// renderPatch turns a patch event into html with the usual diff colors and the code highlighted by file type.
+func renderPatch(evt nostr.Event) string {
+	patch := nip34.ParsePatch(evt)
+	if len(patch.Files) == 0 {
+		return fmt.Sprintf("<pre>%s</pre>", html.EscapeString(evt.Content))
+	}
+
+	var b strings.Builder
+	if patch.Header != nil {
+		if patch.Header.Author != nil {
+			fmt.Fprintf(&b, "<p>%s<br>", html.EscapeString(patch.Header.Author.String()))
+		}
+		fmt.Fprintf(&b, "<b>%s</b></p>", html.EscapeString(patch.Header.Title))
+		if patch.Header.Body != "" {
+			fmt.Fprintf(&b, "<pre style=\"white-space: pre-wrap\">%s</pre>", html.EscapeString(patch.Header.Body))
+		}
+	}
+
+	b.WriteString("<pre>")
+	for _, file := range patch.Files {
+		name := file.NewName
+		switch {
+		case file.IsNew:
+			name += " (new)"
+		case file.IsDelete:
+			name = file.OldName + " (deleted)"
+		case file.IsRename:
+			name = file.OldName + " → " + file.NewName
+		}
+		fmt.Fprintf(&b, "<span style=\"font-weight: bold; background-color: #e8e8e8\">%s</span>\n", html.EscapeString(name))
+		if file.IsBinary {
+			b.WriteString("(binary)\n")
+			continue
+		}
+		lang := syntaxFor(file.NewName)
+		if file.IsDelete {
+			lang = syntaxFor(file.OldName)
+		}
+		for _, fragment := range file.TextFragments {
+			fmt.Fprintf(&b, "<span style=\"color: #0550ae\">%s</span>\n", html.EscapeString(strings.TrimRight(fragment.Header(), "\n")))
+			for _, line := range fragment.Lines {
+				text := highlightLine(lang, strings.TrimRight(line.Line, "\n"))
+				switch line.Op {
+				case gitdiff.OpAdd:
+					fmt.Fprintf(&b, "<span style=\"background-color: #dafbe1\">+%s</span>\n", text)
+				case gitdiff.OpDelete:
+					fmt.Fprintf(&b, "<span style=\"background-color: #ffebe9\">-%s</span>\n", text)
+				default:
+					fmt.Fprintf(&b, " %s\n", text)
+				}
+			}
+		}
+	}
+	b.WriteString("</pre>")
+	return b.String()
+}
+
+func (git *gitVars) publishStatus() {
+	root := git.selected()
+	if root == nil {
+		git.resultLabel.SetText("select a patch or issue first")
+		return
+	}
+	kind := statusKinds[max(0, git.statusCombo.CurrentIndex())]
+	evt := nostr.Event{
+		Kind:      kind,
+		CreatedAt: nostr.Now(),
+		Content:   strings.TrimSpace(git.statusEdit.Text()),
+		Tags: nostr.Tags{
+			{"e", root.ID.Hex(), "", "root"},
+			{"a", git.address()},
+			{"p", root.PubKey.Hex()},
+		},
+	}
+	if root.PubKey != git.pointer.PublicKey {
+		evt.Tags = append(evt.Tags, nostr.Tag{"p", git.pointer.PublicKey.Hex()})
+	}
+
+	rootID := root.ID
+	relays := git.relays
+	git.resultLabel.SetText("signing...")
+	signer.sign("git tab: status", evt, func(signed nostr.Event) {
+		git.statusEdit.SetText("")
+		git.thread[rootID] = append(git.thread[rootID], signed)
+		for _, r := range git.roots {
+			if r.ID == rootID {
+				if status, ok := git.latestStatus(r); ok {
+					git.statuses[rootID] = status
+				}
+			}
+		}
+		git.reportPublish(relays, signed)
+		row := git.itemsList.CurrentRow()
+		git.render()
+		git.itemsList.SetCurrentRow(row)
+	})
+}
+
+func (git *gitVars) reportPublish(relays []string, evt nostr.Event) {
+	results := make([]string, 0, len(relays))
+	publishTo(relays, evt, func(url string, err error) {
+		if err != nil {
+			results = append(results, niceRelayURL(url)+": "+err.Error())
+		} else {
+			results = append(results, niceRelayURL(url)+": ok")
+		}
+		git.resultLabel.SetText(fmt.Sprintf("kind %d: %s", evt.Kind, strings.Join(results, ", ")))
+	})
+}
+
+// sendPatches runs git format-patch on the given range and publishes one event per commit,
+// the first being the root and the others replying to the previous one.
+func (git *gitVars) sendPatches() {
+	if git.pointer.Identifier == "" {
+		git.resultLabel.SetText("load a repository first")
+		return
+	}
+	repoPath := strings.TrimSpace(git.repoPathEdit.Text())
+	commitRange := strings.TrimSpace(git.rangeEdit.Text())
+	if repoPath == "" || commitRange == "" {
+		git.resultLabel.SetText("specify a local repository and a commit range")
+		return
+	}
+
+	git.resultLabel.SetText("running git format-patch...")
+	go func() {
+		cmd := exec.Command("git", "format-patch", "--stdout", commitRange)
+		cmd.Dir = repoPath
+		out, err := cmd.Output()
+		mainthread.Wait(func() {
+			git.publishPatches(commitRange, out, err)
+		})
+	}()
+}
+
+// publishPatches splits the output of git format-patch and publishes each commit as a patch in a series.
+func (git *gitVars) publishPatches(commitRange string, out []byte, err error) {
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			err = fmt.Errorf("%s", strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		git.resultLabel.SetText("git format-patch failed: " + err.Error())
+		return
+	}
+
+	// split the mbox into one patch per commit
+	starts := formatPatchSeparator.FindAllSubmatchIndex(out, -1)
+	if len(starts) == 0 {
+		git.resultLabel.SetText("no commits in " + commitRange)
+		return
+	}
+	patches := make([]string, len(starts))
+	commits := make([]string, len(starts))
+	for i, loc := range starts {
+		end := len(out)
+		if i+1 < len(starts) {
+			end = starts[i+1][0]
+		}
+		patches[i] = string(out[loc[0]:end])
+		commits[i] = string(out[loc[2]:loc[3]])
+	}
+
+	answer := qt.QMessageBox_Question6(git.tab, "send patches",
+		fmt.Sprintf("publish %d patch events for %s to %s?", len(patches), commitRange, strings.Join(niceRelayURLs(git.relays), ", ")),
+		qt.QMessageBox__Yes|qt.QMessageBox__No, qt.QMessageBox__Yes)
+	if answer != qt.QMessageBox__Yes {
+		return
+	}
+
+	var sendNext func(i int, root nostr.ID, previous nostr.ID)
+	sendNext = func(i int, root nostr.ID, previous nostr.ID) {
+		if i >= len(patches) {
+			return
+		}
+		evt := nostr.Event{
+			Kind:      nostr.KindPatch,
+			CreatedAt: nostr.Now(),
+			Content:   patches[i],
+			Tags: nostr.Tags{
+				{"a", git.address()},
+				{"p", git.pointer.PublicKey.Hex()},
+				{"commit", commits[i]},
+			},
+		}
+		if git.repo != nil && git.repo.EarliestUniqueCommitID != "" {
+			evt.Tags = append(evt.Tags, nostr.Tag{"r", git.repo.EarliestUniqueCommitID})
+		}
+		if i == 0 {
+			evt.Tags = append(evt.Tags, nostr.Tag{"t", "root"})
+		} else {
+			evt.Tags = append(evt.Tags, nostr.Tag{"e", previous.Hex(), "", "reply"})
+		}
+
+		git.resultLabel.SetText(fmt.Sprintf("signing patch %d of %d...", i+1, len(patches)))
+		signer.sign(fmt.Sprintf("git tab: patch %d", i+1), evt, func(signed nostr.Event) {
+			git.reportPublish(git.relays, signed)
+			if i == 0 {
+				root = signed.ID
+				git.roots = append([]nostr.Event{signed}, git.roots...)
+			} else {
+				git.thread[root] = append(git.thread[root], signed)
+			}
+			git.render()
+			sendNext(i+1, root, signed.ID)
+		})
+	}
+	sendNext(0, nostr.ID{}, nostr.ID{})
+}
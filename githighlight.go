@@ -0,0 +1,242 @@
+package main
+
+import (
+	"html"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// syntax is just enough about a language to color diff lines one at a time,
+// block comments and multi-line strings aren't tracked across lines.
+type syntax struct {
+	keywords      []string
+	types         []string
+	lineComments  []string
+	blockComments [][2]string
+	quotes        string
+}
+
+var cLikeQuotes = "\"'`"
+
+var syntaxes = map[string]*syntax{
+	"go": {
+		keywords: strings.Fields(`break case chan const continue default defer else fallthrough for func go goto if
+			import interface map package range return select struct switch type var nil true false iota`),
+		types: strings.Fields(`bool byte complex64 complex128 error float32 float64 int int8 int16 int32 int64 rune
+			string uint uint8 uint16 uint32 uint64 uintptr any append cap close copy delete len make new panic print
+			println recover min max clear`),
+		lineComments:  []string{"//"},
+		blockComments: [][2]string{{"/*", "*/"}},
+		quotes:        cLikeQuotes,
+	},
+	"js": {
+		keywords: strings.Fields(`async await break case catch class const continue debugger default delete do else
+			export extends finally for from function if import in instanceof let new of return static super switch
+			this throw try typeof var void while with yield null undefined true false type interface enum`),
+		types:         strings.Fields(`string number boolean any unknown never object Array Promise Map Set`),
+		lineComments:  []string{"//"},
+		blockComments: [][2]string{{"/*", "*/"}},
+		quotes:        cLikeQuotes,
+	},
+	"py": {
+		keywords: strings.Fields(`and as assert async await break class continue def del elif else except finally for
+			from global if import in is lambda nonlocal not or pass raise return try while with yield None True False`),
+		types:        strings.Fields(`int float str bytes bool list dict set tuple object self print len range`),
+		lineComments: []string{"#"},
+		quotes:       "\"'",
+	},
+	"rust": {
+		keywords: strings.Fields(`as async await break const continue crate dyn else enum extern false fn for if impl
+			in let loop match mod move mut pub ref return self Self static struct super trait true type unsafe use
+			where while`),
+		types: strings.Fields(`bool char str String i8 i16 i32 i64 i128 isize u8 u16 u32 u64 u128 usize f32 f64
+			Option Result Vec Box Some None Ok Err`),
+		lineComments:  []string{"//"},
+		blockComments: [][2]string{{"/*", "*/"}},
+		quotes:        "\"",
+	},
+	"c": {
+		keywords: strings.Fields(`auto break case catch class const continue default delete do else enum extern for
+			goto if inline namespace new private protected public return sizeof static struct switch template this
+			throw try typedef union using virtual volatile while NULL nullptr true false #include #define #ifdef
+			#ifndef #endif #if #else`),
+		types: strings.Fields(`bool char double float int long short signed unsigned void size_t uint8_t uint16_t
+			uint32_t uint64_t int8_t int16_t int32_t int64_t std string vector`),
+		lineComments:  []string{"//"},
+		blockComments: [][2]string{{"/*", "*/"}},
+		quotes:        "\"'",
+	},
+	"java": {
+		keywords: strings.Fields(`abstract assert break case catch class const continue default do else enum extends
+			final finally for goto if implements import instanceof interface native new package private protected
+			public record return static strictfp super switch synchronized this throw throws transient try var void
+			volatile while yield null true false`),
+		types: strings.Fields(`boolean byte char double float int long short String Object Integer Long Boolean
+			List Map Set`),
+		lineComments:  []string{"//"},
+		blockComments: [][2]string{{"/*", "*/"}},
+		quotes:        "\"'",
+	},
+	"kotlin": {
+		keywords: strings.Fields(`as break by class companion const continue data do else enum false for fun if import
+			in init interface internal is lateinit null object open operator override package private protected
+			public return sealed super suspend this throw true try typealias val var when while`),
+		types: strings.Fields(`Any Boolean Byte Char Double Float Int Long Nothing Short String Unit Array List
+			MutableList Map MutableMap Set`),
+		lineComments:  []string{"//"},
+		blockComments: [][2]string{{"/*", "*/"}},
+		quotes:        "\"'",
+	},
+	"sh": {
+		keywords: strings.Fields(`if then else elif fi for while until do done case esac in function return local
+			export set unset echo exit`),
+		lineComments: []string{"#"},
+		quotes:       "\"'",
+	},
+	"nix": {
+		keywords:      strings.Fields(`let in with rec inherit if then else assert import true false null`),
+		lineComments:  []string{"#"},
+		blockComments: [][2]string{{"/*", "*/"}},
+		quotes:        "\"",
+	},
+	"json": {
+		keywords: strings.Fields(`true false null`),
+		quotes:   "\"",
+	},
+	"toml": {
+		keywords:     strings.Fields(`true false`),
+		lineComments: []string{"#"},
+		quotes:       "\"'",
+	},
+	"yaml": {
+		keywords:     strings.Fields(`true false yes no on off null`),
+		lineComments: []string{"#"},
+		quotes:       "\"'",
+	},
+}
+
+var syntaxByExtension = map[string]string{
+	".go":   "go",
+	".js":   "js",
+	".jsx":  "js",
+	".mjs":  "js",
+	".ts":   "js",
+	".tsx":  "js",
+	".py":   "py",
+	".rs":   "rust",
+	".c":    "c",
+	".h":    "c",
+	".cc":   "c",
+	".cpp":  "c",
+	".hpp":  "c",
+	".java": "java",
+	".kt":   "kotlin",
+	".kts":  "kotlin",
+	".sh":   "sh",
+	".bash": "sh",
+	".nix":  "nix",
+	".json": "json",
+	".toml": "toml",
+	".yaml": "yaml",
+	".yml":  "yaml",
+}
+
+func syntaxFor(filename string) *syntax {
+	if filepath.Base(filename) == "justfile" || filepath.Base(filename) == "Makefile" {
+		return syntaxes["sh"]
+	}
+	return syntaxes[syntaxByExtension[strings.ToLower(filepath.Ext(filename))]]
+}
+
+const (
+	highlightKeyword = "#cf222e"
+	highlightType    = "#8250df"
+	highlightString  = "#0a3069"
+	highlightNumber  = "#0550ae"
+	highlightComment = "#6e7781"
+)
+
+func colored(color string, text string) string {
+	return "<span style=\"color: " + color + "\">" + html.EscapeString(text) + "</span>"
+}
+
+// highlightLine returns the html for a single line of code, escaped, with tokens colored by lang.
+func highlightLine(lang *syntax, line string) string {
+	if lang == nil {
+		return html.EscapeString(line)
+	}
+
+	isIdent := func(r rune) bool { return r == '_' || r == '#' || unicode.IsLetter(r) || unicode.IsDigit(r) }
+
+	var b strings.Builder
+	runes := []rune(line)
+	rest := func(i int) string { return string(runes[i:]) }
+	for i := 0; i < len(runes); {
+		r := runes[i]
+
+		if slices.ContainsFunc(lang.lineComments, func(prefix string) bool { return strings.HasPrefix(rest(i), prefix) }) {
+			b.WriteString(colored(highlightComment, rest(i)))
+			break
+		}
+		if idx := slices.IndexFunc(lang.blockComments, func(pair [2]string) bool { return strings.HasPrefix(rest(i), pair[0]) }); idx != -1 {
+			opening, closing := lang.blockComments[idx][0], lang.blockComments[idx][1]
+			inside := i + utf8.RuneCountInString(opening)
+			end := len(runes)
+			if j := strings.Index(rest(inside), closing); j != -1 {
+				end = inside + utf8.RuneCountInString(rest(inside)[:j]) + utf8.RuneCountInString(closing)
+			}
+			b.WriteString(colored(highlightComment, string(runes[i:end])))
+			i = end
+			continue
+		}
+
+		if strings.ContainsRune(lang.quotes, r) {
+			j := i + 1
+			for j < len(runes) && runes[j] != r {
+				if runes[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			j = min(j+1, len(runes))
+			b.WriteString(colored(highlightString, string(runes[i:j])))
+			i = j
+			continue
+		}
+
+		if unicode.IsDigit(r) {
+			j := i
+			for j < len(runes) && (isIdent(runes[j]) || runes[j] == '.') {
+				j++
+			}
+			b.WriteString(colored(highlightNumber, string(runes[i:j])))
+			i = j
+			continue
+		}
+
+		if isIdent(r) {
+			j := i
+			for j < len(runes) && isIdent(runes[j]) {
+				j++
+			}
+			word := string(runes[i:j])
+			switch {
+			case slices.Contains(lang.keywords, word):
+				b.WriteString(colored(highlightKeyword, word))
+			case slices.Contains(lang.types, word):
+				b.WriteString(colored(highlightType, word))
+			default:
+				b.WriteString(html.EscapeString(word))
+			}
+			i = j
+			continue
+		}
+
+		b.WriteString(html.EscapeString(string(r)))
+		i++
+	}
+	return b.String()
+}
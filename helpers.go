@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
+	"slices"
 	"strings"
 	"time"
 
@@ -11,23 +12,32 @@ import (
 	"fiatjaf.com/nostr/nip05"
 	"fiatjaf.com/nostr/nip19"
 	"fiatjaf.com/nostr/nip46"
+	"github.com/mappu/miqt/qt6/mainthread"
 )
 
-func handleSecretKeyOrBunker(sec string) (nostr.SecretKey, nostr.Keyer, error) {
-	if strings.HasPrefix(sec, "bunker://") {
-		// it's a bunker
-		bunkerURL := sec
-		clientKey := nostr.Generate()
-		ctx := context.Background()
-
-		bunker, err := nip46.ConnectBunker(ctx, clientKey, bunkerURL, nil, func(s string) {})
-		if err != nil {
-			return nostr.SecretKey{}, nil, fmt.Errorf("failed to connect to %s: %w", bunkerURL, err)
-		}
+// connectBunker performs the NIP-46 connect handshake within connectCtx, but the returned
+// keyer keeps listening for responses until the returned cancel function is called.
+func connectBunker(connectCtx context.Context, bunkerURL string) (nostr.Keyer, context.CancelFunc, error) {
+	parsed, err := nip46.ParseBunkerInput(connectCtx, bunkerURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid bunker: %w", err)
+	}
 
-		return nostr.SecretKey{}, keyer.NewBunkerSignerFromBunkerClient(bunker), err
+	bunkerCtx, cancel := context.WithCancel(ctx)
+	bunker := nip46.NewBunker(bunkerCtx, nostr.Generate(), parsed.HostPubKey, parsed.Relays, nil, func(authURL string) {
+		mainthread.Start(func() {
+			signer.setStatus("bunker requires auth at " + authURL)
+		})
+	})
+	if _, err := bunker.RPC(connectCtx, "connect", []string{parsed.HostPubKey.Hex(), parsed.Secret}); err != nil {
+		cancel()
+		return nil, nil, fmt.Errorf("failed to connect to %s: %w", bunkerURL, err)
 	}
 
+	return keyer.NewBunkerSignerFromBunkerClient(bunker), cancel, nil
+}
+
+func handleSecretKey(sec string) (nostr.SecretKey, nostr.Keyer, error) {
 	if prefix, ski, err := nip19.Decode(sec); err == nil && prefix == "nsec" {
 		sk := ski.(nostr.SecretKey)
 		return sk, keyer.NewPlainKeySigner(sk), nil
@@ -116,3 +126,48 @@ func niceRelayURLs(urls []string) []string {
 	}
 	return nices
 }
+
+func parseRelays(text string) []string {
+	relays := make([]string, 0, 4)
+	for _, url := range strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == ' ' || r == '\n' }) {
+		url = nostr.NormalizeURL(url)
+		if url != "" && !slices.Contains(relays, url) {
+			relays = append(relays, url)
+		}
+	}
+	return relays
+}
+
+// publishTo publishes evt in the background, calling report on the main thread for each relay response.
+func publishTo(relays []string, evt nostr.Event, report func(url string, err error)) {
+	results := sys.Pool.PublishMany(ctx, relays, evt)
+	go func() {
+		for result := range results {
+			mainthread.Wait(func() {
+				report(result.RelayURL, result.Error)
+			})
+		}
+	}()
+}
+
+// withCurrentPubKey gets the public key from currentKeyer in the background (it may be a bunker)
+// and then calls fn on the main thread.
+func withCurrentPubKey(fn func(nostr.PubKey)) {
+	kr := currentKeyer
+	if kr == nil {
+		statusLabel.SetText("no key loaded")
+		return
+	}
+	go func() {
+		pubkeyCtx, cancel := context.WithTimeout(ctx, signer.signTimeout)
+		defer cancel()
+		pk, err := kr.GetPublicKey(pubkeyCtx)
+		mainthread.Wait(func() {
+			if err != nil {
+				statusLabel.SetText("failed to get public key: " + err.Error())
+				return
+			}
+			fn(pk)
+		})
+	}()
+}
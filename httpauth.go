@@ -0,0 +1,220 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"fiatjaf.com/nostr"
+	"fiatjaf.com/nostr/nip19"
+	qt "github.com/mappu/miqt/qt6"
+)
+
+type httpAuthVars struct {
+	tab *qt.QWidget
+
+	urlEdit     *qt.QLineEdit
+	methodCombo *qt.QComboBox
+	bodyEdit    *qt.QTextEdit
+	eventEdit   *qt.QTextEdit
+	headerEdit  *qt.QLineEdit
+	resultLabel *qt.QLabel
+}
+
+var httpAuth = &httpAuthVars{}
+
+var httpMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"}
+
+func setupHTTPAuthTab() *qt.QWidget {
+	httpAuth.tab = qt.NewQWidget(window.QWidget)
+	layout := qt.NewQVBoxLayout2()
+	httpAuth.tab.SetLayout(layout.QLayout)
+
+	requestHBox := qt.NewQHBoxLayout2()
+	layout.AddLayout(requestHBox.QLayout)
+	httpAuth.methodCombo = qt.NewQComboBox(httpAuth.tab)
+	for _, method := range httpMethods {
+		httpAuth.methodCombo.AddItem(method)
+	}
+	requestHBox.AddWidget(httpAuth.methodCombo.QWidget)
+	httpAuth.urlEdit = qt.NewQLineEdit(httpAuth.tab)
+	httpAuth.urlEdit.SetPlaceholderText("https://example.com/api/endpoint")
+	requestHBox.AddWidget(httpAuth.urlEdit.QWidget)
+
+	httpAuth.bodyEdit = qt.NewQTextEdit(httpAuth.tab)
+	httpAuth.bodyEdit.SetAcceptRichText(false)
+	httpAuth.bodyEdit.SetPlaceholderText("request body (optional, adds a payload tag with its sha256)")
+	httpAuth.bodyEdit.SetMaximumHeight(120)
+	layout.AddWidget(httpAuth.bodyEdit.QWidget)
+
+	signButton := qt.NewQPushButton5("sign", httpAuth.tab)
+	layout.AddWidget(signButton.QWidget)
+	signButton.OnClicked(httpAuth.sign)
+
+	eventLabel := qt.NewQLabel2()
+	eventLabel.SetText("auth event (kind 27235):")
+	layout.AddWidget(eventLabel.QWidget)
+	httpAuth.eventEdit = qt.NewQTextEdit(httpAuth.tab)
+	httpAuth.eventEdit.SetReadOnly(true)
+	layout.AddWidget(httpAuth.eventEdit.QWidget)
+
+	headerHBox := qt.NewQHBoxLayout2()
+	layout.AddLayout(headerHBox.QLayout)
+	httpAuth.headerEdit = qt.NewQLineEdit(httpAuth.tab)
+	httpAuth.headerEdit.SetReadOnly(true)
+	httpAuth.headerEdit.SetPlaceholderText("Authorization header")
+	headerHBox.AddWidget(httpAuth.headerEdit.QWidget)
+	copyButton := qt.NewQPushButton5("copy", httpAuth.tab)
+	headerHBox.AddWidget(copyButton.QWidget)
+	copyButton.OnClicked(func() {
+		qt.QGuiApplication_Clipboard().SetText(httpAuth.headerEdit.Text())
+	})
+
+	httpAuth.resultLabel = qt.NewQLabel2()
+	httpAuth.resultLabel.SetWordWrap(true)
+	layout.AddWidget(httpAuth.resultLabel.QWidget)
+
+	return httpAuth.tab
+}
+
+func (httpAuth *httpAuthVars) sign() {
+	if currentKeyer == nil {
+		httpAuth.resultLabel.SetText("no key loaded")
+		return
+	}
+	u := strings.TrimSpace(httpAuth.urlEdit.Text())
+	if !strings.HasPrefix(u, "http://") && !strings.HasPrefix(u, "https://") {
+		httpAuth.resultLabel.SetText("url must be absolute")
+		return
+	}
+
+	evt := nostr.Event{
+		Kind:      27235,
+		CreatedAt: nostr.Now(),
+		Tags: nostr.Tags{
+			{"u", u},
+			{"method", httpAuth.methodCombo.CurrentText()},
+		},
+	}
+	if body := httpAuth.bodyEdit.ToPlainText(); body != "" {
+		hash := sha256.Sum256([]byte(body))
+		evt.Tags = append(evt.Tags, nostr.Tag{"payload", hex.EncodeToString(hash[:])})
+	}
+
+	httpAuth.eventEdit.SetPlainText("")
+	httpAuth.headerEdit.SetText("")
+	httpAuth.resultLabel.SetText("signing...")
+	signer.sign("http auth tab", evt, func(signed nostr.Event) {
+		pretty, _ := json.MarshalIndent(signed, "", "  ")
+		httpAuth.eventEdit.SetPlainText(string(pretty))
+		httpAuth.headerEdit.SetText("Authorization: " + encodeHTTPAuth(signed))
+		httpAuth.resultLabel.SetText("signed, servers usually only accept it for 60 seconds")
+	})
+}
+
+func encodeHTTPAuth(evt nostr.Event) string {
+	j, _ := json.Marshal(evt)
+	return "Nostr " + base64.StdEncoding.EncodeToString(j)
+}
+
+// decodeHTTPAuth takes an Authorization header, with or without the header name, and returns the event in it.
+func decodeHTTPAuth(text string) (nostr.Event, bool) {
+	var evt nostr.Event
+	text = strings.TrimSpace(text)
+	if name, value, ok := strings.Cut(text, ":"); ok && strings.EqualFold(strings.TrimSpace(name), "authorization") {
+		text = strings.TrimSpace(value)
+	}
+	encoded, ok := strings.CutPrefix(text, "Nostr ")
+	if !ok {
+		return evt, false
+	}
+	j, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return evt, false
+	}
+	if err := json.Unmarshal(j, &evt); err != nil {
+		return evt, false
+	}
+	return evt, true
+}
+
+func (p *pasteVars) displayHTTPAuth(evt nostr.Event) {
+	title := qt.NewQLabel2()
+	title.SetText(fmt.Sprintf("http auth event from %s:", nip19.EncodeNpub(evt.PubKey)))
+	p.outputVBox.AddWidget(title.QWidget)
+
+	// the actual request has to be typed in, the event's own tags are only hints
+	form := qt.NewQFormLayout2()
+	p.outputVBox.AddLayout(form.QLayout)
+	urlEdit := qt.NewQLineEdit2()
+	if tag := evt.Tags.Find("u"); tag != nil {
+		urlEdit.SetPlaceholderText(tag[1])
+	}
+	form.AddRow3("request url:", urlEdit.QWidget)
+	methodEdit := qt.NewQLineEdit2()
+	if tag := evt.Tags.Find("method"); tag != nil {
+		methodEdit.SetPlaceholderText(tag[1])
+	}
+	form.AddRow3("request method:", methodEdit.QWidget)
+	bodyEdit := qt.NewQTextEdit2()
+	bodyEdit.SetAcceptRichText(false)
+	bodyEdit.SetPlaceholderText("request body, to check the payload hash")
+	bodyEdit.SetMaximumHeight(120)
+	form.AddRow3("request body:", bodyEdit.QWidget)
+
+	checksLabel := qt.NewQLabel2()
+	checksLabel.SetWordWrap(true)
+	p.outputVBox.AddWidget(checksLabel.QWidget)
+
+	update := func() {
+		checks := make([]string, 0, 6)
+		addCheck := func(ok bool, text string) {
+			if ok {
+				checks = append(checks, "✓ "+text)
+			} else {
+				checks = append(checks, "✗ "+text)
+			}
+		}
+
+		addCheck(evt.Kind == 27235, fmt.Sprintf("kind is %d", evt.Kind))
+		addCheck(evt.CheckID() && evt.VerifySignature(), "id and signature")
+
+		age := time.Since(evt.CreatedAt.Time()).Round(time.Second)
+		addCheck(age < time.Minute && age > -time.Minute, fmt.Sprintf("created %s ago, must be within 60 seconds", age))
+
+		url := strings.TrimSpace(urlEdit.Text())
+		if tag := evt.Tags.Find("u"); tag == nil {
+			addCheck(false, "missing u tag")
+		} else if url == "" {
+			checks = append(checks, "? u tag is "+tag[1]+", not checked, type the request url")
+		} else {
+			addCheck(tag[1] == url, "u tag is "+tag[1])
+		}
+		method := strings.TrimSpace(methodEdit.Text())
+		if tag := evt.Tags.Find("method"); tag == nil {
+			addCheck(false, "missing method tag")
+		} else if method == "" {
+			checks = append(checks, "? method tag is "+tag[1]+", not checked, type the request method")
+		} else {
+			addCheck(strings.EqualFold(tag[1], method), "method tag is "+tag[1])
+		}
+
+		body := bodyEdit.ToPlainText()
+		if tag := evt.Tags.Find("payload"); tag != nil {
+			hash := sha256.Sum256([]byte(body))
+			addCheck(tag[1] == hex.EncodeToString(hash[:]), "payload tag matches the sha256 of the body")
+		} else if body != "" {
+			addCheck(false, "body given but there is no payload tag")
+		}
+
+		checksLabel.SetText(strings.Join(checks, "\n"))
+	}
+	urlEdit.OnTextChanged(func(string) { update() })
+	methodEdit.OnTextChanged(func(string) { update() })
+	bodyEdit.OnTextChanged(update)
+	update()
+}
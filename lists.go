@@ -0,0 +1,498 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"fiatjaf.com/nostr"
+	qt "github.com/mappu/miqt/qt6"
+	"github.com/mappu/miqt/qt6/mainthread"
+)
+
+type listsVars struct {
+	tab *qt.QWidget
+
+	kindCombo   *qt.QComboBox
+	setCombo    *qt.QComboBox
+	dEdit       *qt.QLineEdit
+	titleEdit   *qt.QLineEdit
+	infoLabel   *qt.QLabel
+	publicList  *qt.QListWidget
+	privateList *qt.QListWidget
+	addEdit     *qt.QLineEdit
+	resultLabel *qt.QLabel
+
+	pubkey nostr.PubKey
+	events []nostr.Event // versions of the selected kind, one per d tag for addressable lists
+	meta   nostr.Tags    // d, title and the like, kept public and untouched
+	public nostr.Tags
+	secret nostr.Tags
+	// set when the content couldn't be decrypted, publishing would lose the private items
+	undecryptable bool
+	loadSerial    int
+	loaded        bool // whether a load for pubkey and the selected kind finished
+}
+
+type listKind struct {
+	kind nostr.Kind
+	name string
+	hint string
+}
+
+var listKinds = []listKind{
+	{10000, "mute list", "p <pubkey>, t <hashtag>, word <word>, e <event id>"},
+	{10001, "pinned notes", "e <event id>"},
+	{10003, "bookmarks", "e <event id>, a <address>, t <hashtag>, r <url>"},
+	{10004, "communities", "a <address>"},
+	{10005, "public chats", "e <channel id>"},
+	{10006, "blocked relays", "relay <url>"},
+	{10007, "search relays", "relay <url>"},
+	{10009, "simple groups", "group <id> <relay>, r <relay>"},
+	{10015, "interests", "t <hashtag>, a <address>"},
+	{10030, "emojis", "emoji <shortcode> <url>, a <address>"},
+	{30000, "follow sets", "p <pubkey>"},
+	{30002, "relay sets", "relay <url>"},
+	{30003, "bookmark sets", "e <event id>, a <address>, t <hashtag>, r <url>"},
+	{30004, "curation sets (articles)", "a <address>, e <event id>"},
+	{30005, "curation sets (videos)", "e <event id>"},
+	{30015, "interest sets", "t <hashtag>"},
+	{30030, "emoji sets", "emoji <shortcode> <url>"},
+}
+
+var lists = &listsVars{}
+
+func setupListsTab() *qt.QWidget {
+	lists.tab = qt.NewQWidget(window.QWidget)
+	layout := qt.NewQVBoxLayout2()
+	lists.tab.SetLayout(layout.QLayout)
+
+	// kind and set selection
+	selectHBox := qt.NewQHBoxLayout2()
+	layout.AddLayout(selectHBox.QLayout)
+	lists.kindCombo = qt.NewQComboBox(lists.tab)
+	for _, lk := range listKinds {
+		lists.kindCombo.AddItem(fmt.Sprintf("%d: %s", lk.kind, lk.name))
+	}
+	selectHBox.AddWidget(lists.kindCombo.QWidget)
+	loadButton := qt.NewQPushButton5("load", lists.tab)
+	selectHBox.AddWidget(loadButton.QWidget)
+	loadButton.OnClicked(lists.load)
+	lists.setCombo = qt.NewQComboBox(lists.tab)
+	lists.setCombo.SetMinimumWidth(200)
+	selectHBox.AddWidget(lists.setCombo.QWidget)
+	lists.dEdit = qt.NewQLineEdit(lists.tab)
+	lists.dEdit.SetPlaceholderText("set identifier (d tag)")
+	selectHBox.AddWidget(lists.dEdit.QWidget)
+	lists.titleEdit = qt.NewQLineEdit(lists.tab)
+	lists.titleEdit.SetPlaceholderText("title")
+	selectHBox.AddWidget(lists.titleEdit.QWidget)
+	lists.infoLabel = qt.NewQLabel2()
+	layout.AddWidget(lists.infoLabel.QWidget)
+
+	lists.kindCombo.OnCurrentIndexChanged(func(int) {
+		lists.events = nil
+		lists.loaded = false
+		lists.show(nil)
+		lists.refreshSetCombo()
+	})
+	lists.setCombo.OnCurrentIndexChanged(func(idx int) {
+		if idx >= 0 && idx < len(lists.events) {
+			lists.show(&lists.events[idx])
+		} else {
+			lists.show(nil)
+		}
+	})
+
+	// public and private items
+	itemsHBox := qt.NewQHBoxLayout2()
+	layout.AddLayout(itemsHBox.QLayout)
+	publicVBox := qt.NewQVBoxLayout2()
+	itemsHBox.AddLayout(publicVBox.QLayout)
+	publicLabel := qt.NewQLabel2()
+	publicLabel.SetText("public (tags):")
+	publicVBox.AddWidget(publicLabel.QWidget)
+	lists.publicList = qt.NewQListWidget(lists.tab)
+	lists.publicList.SetSelectionMode(qt.QAbstractItemView__ExtendedSelection)
+	publicVBox.AddWidget(lists.publicList.QWidget)
+
+	moveVBox := qt.NewQVBoxLayout2()
+	itemsHBox.AddLayout(moveVBox.QLayout)
+	moveVBox.AddStretch()
+	toPrivateButton := qt.NewQPushButton5("→", lists.tab)
+	toPrivateButton.SetToolTip("make selected items private")
+	moveVBox.AddWidget(toPrivateButton.QWidget)
+	toPublicButton := qt.NewQPushButton5("←", lists.tab)
+	toPublicButton.SetToolTip("make selected items public")
+	moveVBox.AddWidget(toPublicButton.QWidget)
+	moveVBox.AddStretch()
+	toPrivateButton.OnClicked(func() {
+		lists.public, lists.secret = moveSelectedTags(lists.publicList, lists.public, lists.secret)
+		lists.render()
+	})
+	toPublicButton.OnClicked(func() {
+		lists.secret, lists.public = moveSelectedTags(lists.privateList, lists.secret, lists.public)
+		lists.render()
+	})
+
+	privateVBox := qt.NewQVBoxLayout2()
+	itemsHBox.AddLayout(privateVBox.QLayout)
+	privateLabel := qt.NewQLabel2()
+	privateLabel.SetText("private (nip-44 encrypted content):")
+	privateVBox.AddWidget(privateLabel.QWidget)
+	lists.privateList = qt.NewQListWidget(lists.tab)
+	lists.privateList.SetSelectionMode(qt.QAbstractItemView__ExtendedSelection)
+	privateVBox.AddWidget(lists.privateList.QWidget)
+
+	// add and remove
+	addHBox := qt.NewQHBoxLayout2()
+	layout.AddLayout(addHBox.QLayout)
+	lists.addEdit = qt.NewQLineEdit(lists.tab)
+	addHBox.AddWidget(lists.addEdit.QWidget)
+	addPublicButton := qt.NewQPushButton5("add public", lists.tab)
+	addHBox.AddWidget(addPublicButton.QWidget)
+	addPublicButton.OnClicked(func() {
+		if tag := lists.parseItem(); tag != nil {
+			lists.public = append(lists.public, tag)
+			lists.render()
+		}
+	})
+	addPrivateButton := qt.NewQPushButton5("add private", lists.tab)
+	addHBox.AddWidget(addPrivateButton.QWidget)
+	addPrivateButton.OnClicked(func() {
+		if tag := lists.parseItem(); tag != nil {
+			lists.secret = append(lists.secret, tag)
+			lists.render()
+		}
+	})
+	removeButton := qt.NewQPushButton5("remove selected", lists.tab)
+	addHBox.AddWidget(removeButton.QWidget)
+	removeButton.OnClicked(func() {
+		lists.public, _ = moveSelectedTags(lists.publicList, lists.public, nil)
+		lists.secret, _ = moveSelectedTags(lists.privateList, lists.secret, nil)
+		lists.render()
+	})
+
+	publishButton := qt.NewQPushButton5("encrypt and publish", lists.tab)
+	layout.AddWidget(publishButton.QWidget)
+	publishButton.OnClicked(lists.publish)
+	lists.resultLabel = qt.NewQLabel2()
+	lists.resultLabel.SetWordWrap(true)
+	layout.AddWidget(lists.resultLabel.QWidget)
+
+	lists.refreshSetCombo()
+	return lists.tab
+}
+
+func (lists *listsVars) selectedKind() listKind {
+	return listKinds[max(0, lists.kindCombo.CurrentIndex())]
+}
+
+func (lists *listsVars) refreshSetCombo() {
+	lk := lists.selectedKind()
+	lists.addEdit.SetPlaceholderText(lk.hint)
+	addressable := lk.kind.IsAddressable()
+	lists.setCombo.SetVisible(addressable)
+	lists.dEdit.SetVisible(addressable)
+	lists.titleEdit.SetVisible(addressable)
+
+	lists.setCombo.BlockSignals(true)
+	lists.setCombo.Clear()
+	for _, evt := range lists.events {
+		label := evt.Tags.GetD()
+		if title := evt.Tags.Find("title"); title != nil {
+			label += " (" + title[1] + ")"
+		}
+		lists.setCombo.AddItem(label)
+	}
+	lists.setCombo.AddItem("new set")
+	lists.setCombo.BlockSignals(false)
+	lists.setCombo.SetCurrentIndex(0)
+	if len(lists.events) > 0 {
+		lists.show(&lists.events[0])
+	}
+}
+
+func (lists *listsVars) load() {
+	lk := lists.selectedKind()
+	withCurrentPubKey(func(pk nostr.PubKey) {
+		lists.pubkey = pk
+		lists.loadSerial++
+		serial := lists.loadSerial
+		lists.loaded = false
+		lists.infoLabel.SetText("loading...")
+
+		go func() {
+			fetchCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+			defer cancel()
+
+			relays := append(slices.Clone(sys.RelayListRelays.URLs), sys.FetchWriteRelays(fetchCtx, pk)...)
+			events := make([]nostr.Event, 0, 4)
+			for ie := range sys.Pool.FetchMany(fetchCtx, relays, nostr.Filter{
+				Kinds:   []nostr.Kind{lk.kind},
+				Authors: []nostr.PubKey{pk},
+			}, nostr.SubscriptionOptions{Label: "vnak-lists"}) {
+				// keep only the latest version for each d tag
+				d := ie.Event.Tags.GetD()
+				idx := slices.IndexFunc(events, func(evt nostr.Event) bool { return evt.Tags.GetD() == d })
+				if idx == -1 {
+					events = append(events, ie.Event)
+				} else if ie.Event.CreatedAt > events[idx].CreatedAt {
+					events[idx] = ie.Event
+				}
+			}
+			slices.SortFunc(events, func(a, b nostr.Event) int { return int(b.CreatedAt - a.CreatedAt) })
+
+			mainthread.Wait(func() {
+				if serial != lists.loadSerial || lk.kind != lists.selectedKind().kind {
+					return
+				}
+				lists.events = events
+				lists.loaded = true
+				if len(events) == 0 {
+					lists.infoLabel.SetText("nothing found")
+				} else {
+					lists.infoLabel.SetText(fmt.Sprintf("%d found", len(events)))
+				}
+				lists.refreshSetCombo()
+			})
+		}()
+	})
+}
+
+// show splits evt into metadata, public and private items, decrypting the content in the background.
+func (lists *listsVars) show(evt *nostr.Event) {
+	lists.meta = nil
+	lists.public = nil
+	lists.secret = nil
+	lists.undecryptable = false
+	lists.dEdit.SetText("")
+	lists.titleEdit.SetText("")
+	lists.resultLabel.SetText("")
+	if evt == nil {
+		lists.render()
+		return
+	}
+
+	for _, tag := range evt.Tags {
+		if len(tag) >= 1 && slices.Contains([]string{"d", "title", "name", "description", "image", "alt"}, tag[0]) {
+			lists.meta = append(lists.meta, tag)
+		} else {
+			lists.public = append(lists.public, tag)
+		}
+	}
+	lists.dEdit.SetText(evt.Tags.GetD())
+	if title := evt.Tags.Find("title"); title != nil {
+		lists.titleEdit.SetText(title[1])
+	}
+	lists.render()
+
+	if evt.Content == "" {
+		return
+	}
+	if strings.Contains(evt.Content, "?iv=") {
+		lists.undecryptable = true
+		lists.resultLabel.SetText("private items are nip-04 encrypted and can't be decrypted here")
+		return
+	}
+
+	kr := currentKeyer
+	if kr == nil {
+		return
+	}
+	lists.undecryptable = true
+	lists.resultLabel.SetText("decrypting private items...")
+	id := evt.ID
+	content := evt.Content
+	go func() {
+		decryptCtx, cancel := context.WithTimeout(ctx, signer.signTimeout)
+		defer cancel()
+
+		var secret nostr.Tags
+		plaintext, err := kr.Decrypt(decryptCtx, content, lists.pubkey)
+		if err == nil {
+			err = json.Unmarshal([]byte(plaintext), &secret)
+		}
+
+		mainthread.Wait(func() {
+			if idx := lists.setCombo.CurrentIndex(); idx < 0 || idx >= len(lists.events) || lists.events[idx].ID != id {
+				return
+			}
+			if err != nil {
+				lists.resultLabel.SetText("failed to decrypt private items: " + err.Error())
+				return
+			}
+			lists.undecryptable = false
+			lists.secret = secret
+			lists.resultLabel.SetText("")
+			lists.render()
+		})
+	}()
+}
+
+func (lists *listsVars) render() {
+	lists.publicList.Clear()
+	for _, tag := range lists.public {
+		lists.publicList.AddItem(describeListItem(tag))
+	}
+	lists.privateList.Clear()
+	for _, tag := range lists.secret {
+		lists.privateList.AddItem(describeListItem(tag))
+	}
+}
+
+func describeListItem(tag nostr.Tag) string {
+	if len(tag) < 2 {
+		return strings.Join(tag, " ")
+	}
+	return tag[0] + ": " + strings.Join(tag[1:], ", ")
+}
+
+// moveSelectedTags removes the selected rows of list from "from" and appends them to "to".
+func moveSelectedTags(list *qt.QListWidget, from, to nostr.Tags) (nostr.Tags, nostr.Tags) {
+	rows := make([]int, 0, 4)
+	for _, item := range list.SelectedItems() {
+		rows = append(rows, list.Row(item))
+	}
+	slices.Sort(rows)
+	for _, row := range rows {
+		to = append(to, from[row])
+	}
+	for i := len(rows) - 1; i >= 0; i-- {
+		from = slices.Delete(from, rows[i], rows[i]+1)
+	}
+	return from, to
+}
+
+// parseItem reads the add field as a json tag array or as whitespace-separated values,
+// decoding nip-19 codes into what tags expect.
+func (lists *listsVars) parseItem() nostr.Tag {
+	text := strings.TrimSpace(lists.addEdit.Text())
+	if text == "" {
+		return nil
+	}
+
+	var tag nostr.Tag
+	if strings.HasPrefix(text, "[") {
+		if err := json.Unmarshal([]byte(text), &tag); err != nil {
+			lists.resultLabel.SetText("invalid tag: " + err.Error())
+			return nil
+		}
+	} else {
+		tag = strings.Fields(text)
+		for i := 1; i < len(tag); i++ {
+			tag[i] = decodeTagValue(tag[i])
+		}
+	}
+	if len(tag) < 2 {
+		lists.resultLabel.SetText("an item needs a type and a value, like " + lists.selectedKind().hint)
+		return nil
+	}
+	if tag[0] == "relay" || tag[0] == "r" {
+		tag[1] = nostr.NormalizeURL(tag[1])
+	}
+
+	lists.addEdit.SetText("")
+	return tag
+}
+
+func (lists *listsVars) publish() {
+	kr := currentKeyer
+	if kr == nil {
+		lists.resultLabel.SetText("no key loaded")
+		return
+	}
+	// these replace whatever was published before, so publishing without loading would wipe it
+	if !lists.loaded {
+		lists.resultLabel.SetText("load the current lists of this kind first")
+		return
+	}
+	if len(lists.public) == 0 && len(lists.secret) == 0 && qt.QMessageBox_Question6(lists.tab, "empty list",
+		"you are about to publish an empty list. are you sure?",
+		qt.QMessageBox__Yes|qt.QMessageBox__No, qt.QMessageBox__No) != qt.QMessageBox__Yes {
+		return
+	}
+	if lists.undecryptable {
+		answer := qt.QMessageBox_Question6(lists.tab, "private items",
+			"the existing private items couldn't be decrypted and will be lost if you publish. continue?",
+			qt.QMessageBox__Yes|qt.QMessageBox__No, qt.QMessageBox__No)
+		if answer != qt.QMessageBox__Yes {
+			return
+		}
+	}
+
+	lk := lists.selectedKind()
+	evt := nostr.Event{
+		Kind:      lk.kind,
+		CreatedAt: nostr.Now(),
+		Tags:      make(nostr.Tags, 0, len(lists.meta)+len(lists.public)+2),
+	}
+	if lk.kind.IsAddressable() {
+		d := strings.TrimSpace(lists.dEdit.Text())
+		if d == "" {
+			lists.resultLabel.SetText("sets need an identifier")
+			return
+		}
+		evt.Tags = append(evt.Tags, nostr.Tag{"d", d})
+		if title := strings.TrimSpace(lists.titleEdit.Text()); title != "" {
+			evt.Tags = append(evt.Tags, nostr.Tag{"title", title})
+		}
+		for _, tag := range lists.meta {
+			if tag[0] != "d" && tag[0] != "title" {
+				evt.Tags = append(evt.Tags, tag)
+			}
+		}
+	} else {
+		evt.Tags = append(evt.Tags, lists.meta...)
+	}
+	evt.Tags = append(evt.Tags, lists.public...)
+
+	secret := lists.secret
+	lists.resultLabel.SetText("encrypting...")
+	go func() {
+		encryptCtx, cancel := context.WithTimeout(ctx, signer.signTimeout)
+		defer cancel()
+
+		pk, err := kr.GetPublicKey(encryptCtx)
+		if err == nil && len(secret) > 0 {
+			plaintext, _ := json.Marshal(secret)
+			evt.Content, err = kr.Encrypt(encryptCtx, string(plaintext), pk)
+		}
+		relays := append(slices.Clone(sys.RelayListRelays.URLs), sys.FetchWriteRelays(encryptCtx, pk)...)
+
+		mainthread.Wait(func() {
+			if err != nil {
+				lists.resultLabel.SetText("failed to encrypt private items: " + err.Error())
+				return
+			}
+			if pk != lists.pubkey {
+				lists.resultLabel.SetText("the loaded list belongs to another key, load it again")
+				return
+			}
+
+			lists.resultLabel.SetText("signing...")
+			signer.sign("lists tab", evt, func(signed nostr.Event) {
+				results := make([]string, 0, len(relays))
+				publishTo(parseRelays(strings.Join(relays, " ")), signed, func(url string, err error) {
+					if err != nil {
+						results = append(results, niceRelayURL(url)+": "+err.Error())
+					} else {
+						results = append(results, niceRelayURL(url)+": ok")
+					}
+					lists.resultLabel.SetText(strings.Join(results, "\n"))
+				})
+
+				// replace the old version in the combo
+				d := signed.Tags.GetD()
+				if idx := slices.IndexFunc(lists.events, func(evt nostr.Event) bool { return evt.Tags.GetD() == d }); idx != -1 {
+					lists.events[idx] = signed
+				} else {
+					lists.events = append([]nostr.Event{signed}, lists.events...)
+				}
+			})
+		})
+	}()
+}
@@ -26,10 +26,22 @@ var (
 	currentSec   nostr.SecretKey
 	currentKeyer nostr.Keyer
 	tabIndexes   struct {
-		event int
-		req   int
-		paste int
-		serve int
+		event    int
+		req      int
+		paste    int
+		serve    int
+		bunker   int
+		profile  int
+		follows  int
+		relays   int
+		lists    int
+		blossom  int
+		git      int
+		articles int
+		zap      int
+		httpAuth int
+		dvm      int
+		nwc      int
 	}
 	statusLabel *qt.QLabel
 
@@ -96,6 +108,12 @@ func main() {
 	secHBox.AddWidget(secEdit.QWidget)
 	generateButton := qt.NewQPushButton5("generate", centralWidget)
 	secHBox.AddWidget(generateButton.QWidget)
+	vanityButton := qt.NewQPushButton5("vanity", centralWidget)
+	secHBox.AddWidget(vanityButton.QWidget)
+	nostrConnectButton := qt.NewQPushButton5("nostrconnect", centralWidget)
+	secHBox.AddWidget(nostrConnectButton.QWidget)
+	exportButton := qt.NewQPushButton5("export", centralWidget)
+	secHBox.AddWidget(exportButton.QWidget)
 
 	// password input
 	passwordHBox := qt.NewQHBoxLayout2()
@@ -111,6 +129,8 @@ func main() {
 	passwordHBox.AddWidget(secPasswordEdit.QWidget)
 	keyChanged := func(text string) {
 		text = strings.TrimSpace(text)
+		secEdit.SetPlaceholderText("")
+		signer.cancelConnect()
 
 		var sk nostr.SecretKey
 		var keyer nostr.Keyer
@@ -138,9 +158,22 @@ func main() {
 			passwordWidget.SetVisible(false)
 		}
 
-		sk, keyer, err = handleSecretKeyOrBunker(text)
+		if strings.HasPrefix(text, "bunker://") {
+			// connecting may take a while, so it happens in the background
+			currentSec = nostr.SecretKey{}
+			currentKeyer = nil
+			statusLabel.SetText("")
+			signer.connectBunker(text, func(keyer nostr.Keyer) {
+				currentKeyer = keyer
+				event.updateEvent()
+			})
+			return
+		}
+
+		sk, keyer, err = handleSecretKey(text)
 		if err != nil {
 			statusLabel.SetText(err.Error())
+			signer.setStatus("invalid key")
 			currentSec = nostr.SecretKey{}
 			currentKeyer = nil
 			return
@@ -148,6 +181,7 @@ func main() {
 
 		currentSec = sk
 		currentKeyer = keyer
+		signer.setStatus("local key")
 		statusLabel.SetText("")
 		event.updateEvent()
 		return
@@ -155,6 +189,7 @@ func main() {
 	empty:
 		currentSec = nostr.SecretKey{}
 		currentKeyer = nil
+		signer.setStatus("no key")
 		statusLabel.SetText("")
 		return
 	}
@@ -166,6 +201,31 @@ func main() {
 		secEdit.SetText(nsec)
 		keyChanged(nsec)
 	})
+	vanityButton.OnClicked(func() {
+		vanity.open(func(sk nostr.SecretKey) {
+			nsec := nip19.EncodeNsec(sk)
+			secEdit.SetText(nsec)
+			keyChanged(nsec)
+		})
+	})
+	exportButton.OnClicked(openExportDialog)
+	nostrConnectButton.OnClicked(func() {
+		nostrConnect.open(func(keyer nostr.Keyer, pubkey nostr.PubKey, cancel context.CancelFunc) {
+			secEdit.BlockSignals(true)
+			secEdit.SetText("")
+			secEdit.BlockSignals(false)
+			secEdit.SetPlaceholderText("connected to remote signer for " + nip19.EncodeNpub(pubkey))
+			passwordWidget.SetVisible(false)
+			signer.cancelConnect()
+			signer.bunkerCancel = cancel
+			signer.setStatus("remote signer connected")
+
+			currentSec = nostr.SecretKey{}
+			currentKeyer = keyer
+			statusLabel.SetText("")
+			event.updateEvent()
+		})
+	})
 
 	tabWidget = qt.NewQTabWidget(centralWidget)
 
@@ -173,6 +233,18 @@ func main() {
 	reqTab := setupReqTab()
 	pasteTab := setupPasteTab()
 	serveTab := setupServeTab()
+	bunkerTab := setupBunkerTab()
+	profileTab := setupProfileTab()
+	followsTab := setupFollowsTab()
+	relayListsTab := setupRelayListsTab()
+	listsTab := setupListsTab()
+	blossomTab := setupBlossomClientTab()
+	gitTab := setupGitTab()
+	articlesTab := setupArticlesTab()
+	zapTab := setupZapTab()
+	httpAuthTab := setupHTTPAuthTab()
+	dvmTab := setupDVMTab()
+	nwcTab := setupNWCTab()
 
 	tabWidget.AddTab(eventTab, "event")
 	tabIndexes.event = 0
@@ -186,6 +258,42 @@ func main() {
 	tabWidget.AddTab(serveTab, "serve")
 	tabIndexes.serve = 3
 
+	tabWidget.AddTab(bunkerTab, "bunker")
+	tabIndexes.bunker = 4
+
+	tabWidget.AddTab(profileTab, "profile")
+	tabIndexes.profile = 5
+
+	tabWidget.AddTab(followsTab, "follows")
+	tabIndexes.follows = 6
+
+	tabWidget.AddTab(relayListsTab, "relays")
+	tabIndexes.relays = 7
+
+	tabWidget.AddTab(listsTab, "lists")
+	tabIndexes.lists = 8
+
+	tabWidget.AddTab(blossomTab, "blossom")
+	tabIndexes.blossom = 9
+
+	tabWidget.AddTab(gitTab, "git")
+	tabIndexes.git = 10
+
+	tabWidget.AddTab(articlesTab, "articles")
+	tabIndexes.articles = 11
+
+	tabWidget.AddTab(zapTab, "zap")
+	tabIndexes.zap = 12
+
+	tabWidget.AddTab(httpAuthTab, "http auth")
+	tabIndexes.httpAuth = 13
+
+	tabWidget.AddTab(dvmTab, "dvm")
+	tabIndexes.dvm = 14
+
+	tabWidget.AddTab(nwcTab, "nwc")
+	tabIndexes.nwc = 15
+
 	switch *initialTab {
 	case "event":
 		tabWidget.SetCurrentIndex(tabIndexes.event)
@@ -195,14 +303,42 @@ func main() {
 		tabWidget.SetCurrentIndex(tabIndexes.paste)
 	case "serve":
 		tabWidget.SetCurrentIndex(tabIndexes.serve)
+	case "bunker":
+		tabWidget.SetCurrentIndex(tabIndexes.bunker)
+	case "profile":
+		tabWidget.SetCurrentIndex(tabIndexes.profile)
+	case "follows":
+		tabWidget.SetCurrentIndex(tabIndexes.follows)
+	case "relays":
+		tabWidget.SetCurrentIndex(tabIndexes.relays)
+	case "lists":
+		tabWidget.SetCurrentIndex(tabIndexes.lists)
+	case "blossom":
+		tabWidget.SetCurrentIndex(tabIndexes.blossom)
+	case "git":
+		tabWidget.SetCurrentIndex(tabIndexes.git)
+	case "articles":
+		tabWidget.SetCurrentIndex(tabIndexes.articles)
+	case "zap":
+		tabWidget.SetCurrentIndex(tabIndexes.zap)
+	case "http-auth":
+		tabWidget.SetCurrentIndex(tabIndexes.httpAuth)
+	case "dvm":
+		tabWidget.SetCurrentIndex(tabIndexes.dvm)
+	case "nwc":
+		tabWidget.SetCurrentIndex(tabIndexes.nwc)
 	default:
 		tabWidget.SetCurrentIndex(0)
 	}
 
 	mainLayout.AddWidget(tabWidget.QWidget)
 
+	statusHBox := qt.NewQHBoxLayout2()
+	mainLayout.AddLayout(statusHBox.QLayout)
 	statusLabel = qt.NewQLabel2()
-	mainLayout.AddWidget(statusLabel.QWidget)
+	statusHBox.AddWidget(statusLabel.QWidget)
+	statusHBox.AddStretch()
+	statusHBox.AddWidget(signer.setupStatusButton(centralWidget).QWidget)
 
 	// initial render
 	event.updateEvent()
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+
+	"fiatjaf.com/nostr"
+	"fiatjaf.com/nostr/nip49"
+	"github.com/btcsuite/btcd/btcutil/bech32"
+	qt "github.com/mappu/miqt/qt6"
+	"github.com/mappu/miqt/qt6/mainthread"
+)
+
+var keySecurityByteNames = []string{
+	"0x00: known to have been handled insecurely",
+	"0x01: not known to have been handled insecurely",
+	"0x02: client does not track this data",
+}
+
+type ncryptsecParams struct {
+	version     byte
+	logN        uint8
+	salt        []byte
+	nonce       []byte
+	keySecurity nip49.KeySecurityByte
+}
+
+func parseNcryptsec(ncryptsec string) (ncryptsecParams, error) {
+	prefix, bits5, err := bech32.DecodeNoLimit(ncryptsec)
+	if err != nil {
+		return ncryptsecParams{}, err
+	}
+	if prefix != "ncryptsec" {
+		return ncryptsecParams{}, fmt.Errorf("expected prefix ncryptsec1")
+	}
+	data, err := bech32.ConvertBits(bits5, 5, 8, false)
+	if err != nil {
+		return ncryptsecParams{}, fmt.Errorf("failed translating data into 8 bits: %w", err)
+	}
+	if len(data) != 91 {
+		return ncryptsecParams{}, fmt.Errorf("expected 91 bytes, got %d", len(data))
+	}
+
+	return ncryptsecParams{
+		version:     data[0],
+		logN:        data[1],
+		salt:        data[2 : 2+16],
+		nonce:       data[2+16 : 2+16+24],
+		keySecurity: nip49.KeySecurityByte(data[2+16+24]),
+	}, nil
+}
+
+func (params ncryptsecParams) keySecurityName() string {
+	if int(params.keySecurity) < len(keySecurityByteNames) {
+		return keySecurityByteNames[params.keySecurity]
+	}
+	return fmt.Sprintf("0x%02x: unknown", byte(params.keySecurity))
+}
+
+func openExportDialog() {
+	if currentSec == [32]byte{} {
+		statusLabel.SetText("no secret key loaded to export")
+		return
+	}
+	sk := currentSec
+
+	dialog := qt.NewQDialog(window.QWidget)
+	dialog.SetWindowTitle("export ncryptsec")
+	dialog.SetMinimumWidth(500)
+	layout := qt.NewQVBoxLayout2()
+	dialog.SetLayout(layout.QLayout)
+
+	// password
+	passwordLabel := qt.NewQLabel2()
+	passwordLabel.SetText("password:")
+	layout.AddWidget(passwordLabel.QWidget)
+	passwordEdit := qt.NewQLineEdit(dialog.QWidget)
+	passwordEdit.SetEchoMode(qt.QLineEdit__Password)
+	layout.AddWidget(passwordEdit.QWidget)
+	confirmLabel := qt.NewQLabel2()
+	confirmLabel.SetText("confirm password:")
+	layout.AddWidget(confirmLabel.QWidget)
+	confirmEdit := qt.NewQLineEdit(dialog.QWidget)
+	confirmEdit.SetEchoMode(qt.QLineEdit__Password)
+	layout.AddWidget(confirmEdit.QWidget)
+
+	// log_n
+	lognHBox := qt.NewQHBoxLayout2()
+	layout.AddLayout(lognHBox.QLayout)
+	lognLabel := qt.NewQLabel2()
+	lognLabel.SetText("scrypt log_n:")
+	lognHBox.AddWidget(lognLabel.QWidget)
+	lognSpin := qt.NewQSpinBox(dialog.QWidget)
+	// scrypt uses 1KiB per 2^log_n with r=8, anything above 22 (4GiB) would likely just kill us
+	lognSpin.SetRange(1, 22)
+	lognSpin.SetValue(16)
+	lognHBox.AddWidget(lognSpin.QWidget)
+	memoryLabel := qt.NewQLabel2()
+	lognHBox.AddWidget(memoryLabel.QWidget)
+	updateMemory := func(logn int) {
+		memoryLabel.SetText(fmt.Sprintf("(~%d MiB of memory)", (1<<logn)/1024))
+	}
+	updateMemory(lognSpin.Value())
+	lognSpin.OnValueChanged(updateMemory)
+
+	// key security byte
+	ksbHBox := qt.NewQHBoxLayout2()
+	layout.AddLayout(ksbHBox.QLayout)
+	ksbLabel := qt.NewQLabel2()
+	ksbLabel.SetText("key security:")
+	ksbHBox.AddWidget(ksbLabel.QWidget)
+	ksbCombo := qt.NewQComboBox(dialog.QWidget)
+	ksbCombo.AddItems(keySecurityByteNames)
+	ksbCombo.SetCurrentIndex(int(nip49.ClientDoesNotTrackThisData))
+	ksbHBox.AddWidget(ksbCombo.QWidget)
+
+	encryptButton := qt.NewQPushButton5("encrypt", dialog.QWidget)
+	layout.AddWidget(encryptButton.QWidget)
+
+	// output
+	outputHBox := qt.NewQHBoxLayout2()
+	layout.AddLayout(outputHBox.QLayout)
+	outputEdit := qt.NewQLineEdit(dialog.QWidget)
+	outputEdit.SetReadOnly(true)
+	outputHBox.AddWidget(outputEdit.QWidget)
+	copyButton := qt.NewQPushButton5("copy", dialog.QWidget)
+	outputHBox.AddWidget(copyButton.QWidget)
+	copyButton.OnClicked(func() {
+		qt.QGuiApplication_Clipboard().SetText(outputEdit.Text())
+	})
+
+	resultLabel := qt.NewQLabel2()
+	layout.AddWidget(resultLabel.QWidget)
+
+	encryptButton.OnClicked(func() {
+		password := passwordEdit.Text()
+		if password == "" {
+			resultLabel.SetText("password is empty")
+			return
+		}
+		if password != confirmEdit.Text() {
+			resultLabel.SetText("passwords don't match")
+			return
+		}
+
+		logn := uint8(lognSpin.Value())
+		ksb := nip49.KeySecurityByte(ksbCombo.CurrentIndex())
+		encryptButton.SetEnabled(false)
+		resultLabel.SetText("encrypting...")
+		go func() {
+			ncryptsec, err := nip49.Encrypt(sk, password, logn, ksb)
+			mainthread.Wait(func() {
+				encryptButton.SetEnabled(true)
+				if err != nil {
+					resultLabel.SetText("failed to encrypt: " + err.Error())
+					return
+				}
+				outputEdit.SetText(ncryptsec)
+				resultLabel.SetText(fmt.Sprintf("encrypted with log_n %d, key security %s", logn, keySecurityByteNames[ksb]))
+			})
+		}()
+	})
+
+	closeButton := qt.NewQPushButton5("close", dialog.QWidget)
+	closeButton.OnClicked(func() { dialog.Close() })
+	layout.AddWidget(closeButton.QWidget)
+
+	dialog.Exec()
+}
+
+func (p *pasteVars) displayNcryptsec(ncryptsec string) {
+	params, err := parseNcryptsec(ncryptsec)
+	if err != nil {
+		errorLabel := qt.NewQLabel2()
+		errorLabel.SetText("invalid ncryptsec: " + err.Error())
+		p.outputVBox.AddWidget(errorLabel.QWidget)
+		return
+	}
+
+	for _, field := range []struct {
+		label string
+		value string
+	}{
+		{"version:", fmt.Sprintf("0x%02x", params.version)},
+		{"scrypt log_n:", fmt.Sprintf("%d (N = %d, ~%d MiB of memory)", params.logN, uint64(1)<<params.logN, (uint64(1)<<params.logN)/1024)},
+		{"key security:", params.keySecurityName()},
+		{"salt:", nostr.HexEncodeToString(params.salt)},
+		{"nonce:", nostr.HexEncodeToString(params.nonce)},
+	} {
+		label := qt.NewQLabel2()
+		label.SetText(field.label)
+		p.outputVBox.AddWidget(label.QWidget)
+		edit := qt.NewQLineEdit(window.QWidget)
+		edit.SetText(field.value)
+		edit.SetReadOnly(true)
+		p.outputVBox.AddWidget(edit.QWidget)
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"fiatjaf.com/nostr"
+	"fiatjaf.com/nostr/keyer"
+	"fiatjaf.com/nostr/nip19"
+	"fiatjaf.com/nostr/nip44"
+	"fiatjaf.com/nostr/nip46"
+	qt "github.com/mappu/miqt/qt6"
+	"github.com/mappu/miqt/qt6/mainthread"
+	"github.com/skip2/go-qrcode"
+)
+
+type nostrConnectVars struct {
+	dialog      *qt.QDialog
+	relaysEdit  *qt.QLineEdit
+	permsEdit   *qt.QLineEdit
+	secretEdit  *qt.QLineEdit
+	uriEdit     *qt.QLineEdit
+	qrLabel     *qt.QLabel
+	statusText  *qt.QLabel
+	startButton *qt.QPushButton
+
+	onConnected func(nostr.Keyer, nostr.PubKey, context.CancelFunc)
+	cancel      context.CancelFunc
+}
+
+var nostrConnect = &nostrConnectVars{}
+
+// open shows the dialog, onConnected gets the keyer along with the function that stops it,
+// which must be called once it is replaced.
+func (nc *nostrConnectVars) open(onConnected func(nostr.Keyer, nostr.PubKey, context.CancelFunc)) {
+	nc.onConnected = onConnected
+
+	if nc.dialog != nil {
+		nc.dialog.Show()
+		nc.dialog.ActivateWindow()
+		return
+	}
+
+	nc.dialog = qt.NewQDialog(window.QWidget)
+	nc.dialog.SetWindowTitle("nostrconnect")
+	nc.dialog.SetMinimumWidth(500)
+	layout := qt.NewQVBoxLayout2()
+	nc.dialog.SetLayout(layout.QLayout)
+
+	// relays
+	relaysLabel := qt.NewQLabel2()
+	relaysLabel.SetText("relays (space-separated):")
+	layout.AddWidget(relaysLabel.QWidget)
+	nc.relaysEdit = qt.NewQLineEdit(nc.dialog.QWidget)
+	nc.relaysEdit.SetText("wss://relay.nsec.app")
+	layout.AddWidget(nc.relaysEdit.QWidget)
+
+	// permissions
+	permsLabel := qt.NewQLabel2()
+	permsLabel.SetText("permissions (comma-separated, like sign_event:1,nip44_encrypt):")
+	layout.AddWidget(permsLabel.QWidget)
+	nc.permsEdit = qt.NewQLineEdit(nc.dialog.QWidget)
+	nc.permsEdit.SetText("sign_event,nip44_encrypt,nip44_decrypt,nip04_encrypt,nip04_decrypt")
+	layout.AddWidget(nc.permsEdit.QWidget)
+
+	// secret
+	secretLabel := qt.NewQLabel2()
+	secretLabel.SetText("secret:")
+	layout.AddWidget(secretLabel.QWidget)
+	secretHBox := qt.NewQHBoxLayout2()
+	layout.AddLayout(secretHBox.QLayout)
+	nc.secretEdit = qt.NewQLineEdit(nc.dialog.QWidget)
+	nc.secretEdit.SetText(randomSecret())
+	secretHBox.AddWidget(nc.secretEdit.QWidget)
+	newSecretButton := qt.NewQPushButton5("new", nc.dialog.QWidget)
+	secretHBox.AddWidget(newSecretButton.QWidget)
+	newSecretButton.OnClicked(func() {
+		nc.secretEdit.SetText(randomSecret())
+	})
+
+	nc.startButton = qt.NewQPushButton5("generate and wait", nc.dialog.QWidget)
+	layout.AddWidget(nc.startButton.QWidget)
+
+	// uri and qr code
+	uriHBox := qt.NewQHBoxLayout2()
+	layout.AddLayout(uriHBox.QLayout)
+	nc.uriEdit = qt.NewQLineEdit(nc.dialog.QWidget)
+	nc.uriEdit.SetReadOnly(true)
+	uriHBox.AddWidget(nc.uriEdit.QWidget)
+	copyButton := qt.NewQPushButton5("copy", nc.dialog.QWidget)
+	uriHBox.AddWidget(copyButton.QWidget)
+	copyButton.OnClicked(func() {
+		qt.QGuiApplication_Clipboard().SetText(nc.uriEdit.Text())
+	})
+	nc.qrLabel = qt.NewQLabel2()
+	nc.qrLabel.SetAlignment(qt.AlignCenter)
+	layout.AddWidget(nc.qrLabel.QWidget)
+
+	nc.statusText = qt.NewQLabel2()
+	nc.statusText.SetWordWrap(true)
+	layout.AddWidget(nc.statusText.QWidget)
+
+	nc.startButton.OnClicked(func() {
+		if nc.cancel != nil {
+			nc.cancel()
+			return
+		}
+		nc.start()
+	})
+
+	nc.dialog.OnFinished(func(int) {
+		if nc.cancel != nil {
+			nc.cancel()
+		}
+	})
+
+	nc.dialog.Show()
+}
+
+func (nc *nostrConnectVars) start() {
+	relays := make([]string, 0, 2)
+	for _, r := range strings.Fields(nc.relaysEdit.Text()) {
+		relays = append(relays, nostr.NormalizeURL(r))
+	}
+	if len(relays) == 0 {
+		nc.statusText.SetText("no relays specified")
+		return
+	}
+	secret := strings.TrimSpace(nc.secretEdit.Text())
+	if secret == "" {
+		nc.statusText.SetText("a secret is required")
+		return
+	}
+	perms := strings.ReplaceAll(nc.permsEdit.Text(), " ", "")
+
+	clientKey := nostr.Generate()
+	clientPubKey := nostr.GetPublicKey(clientKey)
+
+	qs := url.Values{}
+	for _, r := range relays {
+		qs.Add("relay", r)
+	}
+	qs.Set("secret", secret)
+	if perms != "" {
+		qs.Set("perms", perms)
+	}
+	qs.Set("name", "vnak")
+	uri := "nostrconnect://" + clientPubKey.Hex() + "?" + strings.ReplaceAll(qs.Encode(), "+", "%20")
+
+	nc.uriEdit.SetText(uri)
+	if png, err := qrcode.Encode(uri, qrcode.Medium, 300); err == nil {
+		pixmap := qt.NewQPixmap()
+		pixmap.LoadFromDataWithData(png)
+		nc.qrLabel.SetPixmap(pixmap)
+	}
+
+	waitCtx, cancel := context.WithCancel(ctx)
+	nc.cancel = cancel
+	nc.startButton.SetText("cancel")
+	nc.relaysEdit.SetEnabled(false)
+	nc.permsEdit.SetEnabled(false)
+	nc.secretEdit.SetEnabled(false)
+	nc.statusText.SetText("waiting for the remote signer on " + strings.Join(niceRelayURLs(relays), ", ") + "...")
+
+	go func() {
+		defer cancel()
+
+		bunker, bunkerCancel, err := waitNostrConnect(waitCtx, clientKey, relays, secret)
+		if err == nil {
+			mainthread.Wait(func() {
+				nc.statusText.SetText("signer connected, fetching public key...")
+			})
+		}
+
+		var pubkey nostr.PubKey
+		if err == nil {
+			pubkey, err = bunker.GetPublicKey(waitCtx)
+		}
+
+		mainthread.Wait(func() {
+			nc.cancel = nil
+			nc.startButton.SetText("generate and wait")
+			nc.relaysEdit.SetEnabled(true)
+			nc.permsEdit.SetEnabled(true)
+			nc.secretEdit.SetEnabled(true)
+
+			if err != nil {
+				if bunkerCancel != nil {
+					bunkerCancel()
+				}
+				if waitCtx.Err() != nil {
+					nc.statusText.SetText("canceled")
+				} else {
+					nc.statusText.SetText("failed: " + err.Error())
+				}
+				return
+			}
+
+			granted := perms
+			if granted == "" {
+				granted = "(none requested, signer will decide on each call)"
+			}
+			nc.statusText.SetText(fmt.Sprintf("connected as %s\npermissions granted: %s (the signer may still restrict these)",
+				nip19.EncodeNpub(pubkey), strings.ReplaceAll(granted, ",", ", ")))
+			nc.secretEdit.SetText(randomSecret())
+
+			if nc.onConnected != nil {
+				nc.onConnected(keyer.NewBunkerSignerFromBunkerClient(bunker), pubkey, bunkerCancel)
+			} else {
+				bunkerCancel()
+			}
+		})
+	}()
+}
+
+// waitNostrConnect listens on the given relays for the "connect" response a remote signer sends
+// after scanning a nostrconnect:// URI and returns a bunker client bound to that signer, which keeps
+// listening until the returned cancel function is called.
+func waitNostrConnect(
+	waitCtx context.Context,
+	clientKey nostr.SecretKey,
+	relays []string,
+	secret string,
+) (*nip46.BunkerClient, context.CancelFunc, error) {
+	clientPubKey := nostr.GetPublicKey(clientKey)
+
+	subCtx, cancel := context.WithCancel(waitCtx)
+	defer cancel()
+
+	for ie := range sys.Pool.SubscribeMany(subCtx, relays, nostr.Filter{
+		Kinds: []nostr.Kind{nostr.KindNostrConnect},
+		Tags:  nostr.TagMap{"p": []string{clientPubKey.Hex()}},
+		Since: nostr.Now() - 5,
+	}, nostr.SubscriptionOptions{
+		Label: "vnak-nostrconnect",
+	}) {
+		ck, err := nip44.GenerateConversationKey(ie.PubKey, clientKey)
+		if err != nil {
+			continue
+		}
+		plain, err := nip44.Decrypt(ie.Content, ck)
+		if err != nil {
+			continue
+		}
+		var resp nip46.Response
+		if err := json.Unmarshal([]byte(plain), &resp); err != nil {
+			continue
+		}
+		if resp.Result != secret {
+			continue
+		}
+
+		// the bunker client must outlive the wait, so it isn't derived from waitCtx
+		bunkerCtx, bunkerCancel := context.WithCancel(ctx)
+		return nip46.NewBunker(bunkerCtx, clientKey, ie.PubKey, relays, sys.Pool, func(authURL string) {
+			mainthread.Start(func() {
+				statusLabel.SetText("signer requires auth at " + authURL)
+			})
+		}), bunkerCancel, nil
+	}
+
+	if err := waitCtx.Err(); err != nil {
+		return nil, nil, err
+	}
+	return nil, nil, fmt.Errorf("subscription ended before the signer connected")
+}
+
+func randomSecret() string {
+	sk := nostr.Generate()
+	return hex.EncodeToString(sk[0:8])
+}
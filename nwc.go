@@ -0,0 +1,340 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"fiatjaf.com/nostr"
+	"fiatjaf.com/nostr/nip04"
+	"fiatjaf.com/nostr/nip19"
+	"fiatjaf.com/nostr/nip44"
+	qt "github.com/mappu/miqt/qt6"
+	"github.com/mappu/miqt/qt6/mainthread"
+)
+
+type nwcConnection struct {
+	wallet nostr.PubKey
+	relays []string
+	secret nostr.SecretKey
+	lud16  string
+}
+
+func parseNWC(uri string) (nwcConnection, error) {
+	var conn nwcConnection
+	u, err := url.Parse(strings.TrimSpace(uri))
+	if err != nil {
+		return conn, err
+	}
+	if u.Scheme != "nostr+walletconnect" && u.Scheme != "nostrwalletconnect" {
+		return conn, fmt.Errorf("not a nostr+walletconnect uri")
+	}
+	host := u.Host
+	if host == "" {
+		host = strings.TrimPrefix(u.Opaque, "//")
+	}
+	conn.wallet, err = nostr.PubKeyFromHex(host)
+	if err != nil {
+		return conn, fmt.Errorf("invalid wallet pubkey: %w", err)
+	}
+	query := u.Query()
+	conn.relays = query["relay"]
+	if len(conn.relays) == 0 {
+		return conn, fmt.Errorf("missing relay")
+	}
+	conn.secret, err = nostr.SecretKeyFromHex(query.Get("secret"))
+	if err != nil {
+		return conn, fmt.Errorf("invalid secret: %w", err)
+	}
+	conn.lud16 = query.Get("lud16")
+	return conn, nil
+}
+
+func (conn nwcConnection) URI() string {
+	query := url.Values{"relay": conn.relays, "secret": []string{conn.secret.Hex()}}
+	if conn.lud16 != "" {
+		query.Set("lud16", conn.lud16)
+	}
+	return "nostr+walletconnect://" + conn.wallet.Hex() + "?" + query.Encode()
+}
+
+// nwcEncrypt uses nip04 unless both sides agreed on nip44_v2.
+func nwcEncrypt(encryption string, sk nostr.SecretKey, pk nostr.PubKey, plaintext string) (string, error) {
+	if encryption == "nip44_v2" {
+		key, err := nip44.GenerateConversationKey(pk, sk)
+		if err != nil {
+			return "", err
+		}
+		return nip44.Encrypt(plaintext, key)
+	}
+	shared, err := nip04.ComputeSharedSecret(pk, sk)
+	if err != nil {
+		return "", err
+	}
+	return nip04.Encrypt(plaintext, shared)
+}
+
+func nwcDecrypt(sk nostr.SecretKey, pk nostr.PubKey, ciphertext string) (string, error) {
+	if strings.Contains(ciphertext, "?iv=") {
+		shared, err := nip04.ComputeSharedSecret(pk, sk)
+		if err != nil {
+			return "", err
+		}
+		return nip04.Decrypt(ciphertext, shared)
+	}
+	key, err := nip44.GenerateConversationKey(pk, sk)
+	if err != nil {
+		return "", err
+	}
+	return nip44.Decrypt(ciphertext, key)
+}
+
+var nwcMethodTemplates = map[string]string{
+	"get_info":          `{}`,
+	"get_balance":       `{}`,
+	"make_invoice":      `{"amount": 21000, "description": "test invoice"}`,
+	"pay_invoice":       `{"invoice": ""}`,
+	"list_transactions": `{"limit": 10}`,
+}
+
+type nwcVars struct {
+	tab *qt.QWidget
+
+	uriEdit      *qt.QLineEdit
+	infoLabel    *qt.QLabel
+	methodCombo  *qt.QComboBox
+	paramsEdit   *qt.QTextEdit
+	requestEdit  *qt.QTextEdit
+	responseEdit *qt.QTextEdit
+	resultLabel  *qt.QLabel
+
+	conn       *nwcConnection
+	encryption string
+}
+
+var nwc = &nwcVars{}
+
+func setupNWCTab() *qt.QWidget {
+	nwc.tab = qt.NewQWidget(window.QWidget)
+	layout := qt.NewQVBoxLayout2()
+	nwc.tab.SetLayout(layout.QLayout)
+
+	uriHBox := qt.NewQHBoxLayout2()
+	layout.AddLayout(uriHBox.QLayout)
+	nwc.uriEdit = qt.NewQLineEdit(nwc.tab)
+	nwc.uriEdit.SetPlaceholderText("nostr+walletconnect://...")
+	uriHBox.AddWidget(nwc.uriEdit.QWidget)
+	connectButton := qt.NewQPushButton5("connect", nwc.tab)
+	uriHBox.AddWidget(connectButton.QWidget)
+	connectButton.OnClicked(nwc.connect)
+
+	nwc.infoLabel = qt.NewQLabel2()
+	nwc.infoLabel.SetWordWrap(true)
+	nwc.infoLabel.SetTextInteractionFlags(qt.TextSelectableByMouse)
+	layout.AddWidget(nwc.infoLabel.QWidget)
+
+	methodHBox := qt.NewQHBoxLayout2()
+	layout.AddLayout(methodHBox.QLayout)
+	nwc.methodCombo = qt.NewQComboBox(nwc.tab)
+	for _, method := range []string{"get_info", "get_balance", "make_invoice", "pay_invoice", "list_transactions"} {
+		nwc.methodCombo.AddItem(method)
+	}
+	methodHBox.AddWidget(nwc.methodCombo.QWidget)
+	sendButton := qt.NewQPushButton5("send", nwc.tab)
+	methodHBox.AddWidget(sendButton.QWidget)
+	sendButton.OnClicked(nwc.send)
+	methodHBox.AddStretch()
+
+	nwc.paramsEdit = qt.NewQTextEdit(nwc.tab)
+	nwc.paramsEdit.SetAcceptRichText(false)
+	nwc.paramsEdit.SetMaximumHeight(100)
+	nwc.paramsEdit.SetPlainText(nwcMethodTemplates["get_info"])
+	layout.AddWidget(nwc.paramsEdit.QWidget)
+	nwc.methodCombo.OnCurrentTextChanged(func(method string) {
+		nwc.paramsEdit.SetPlainText(nwcMethodTemplates[method])
+	})
+
+	// raw events
+	splitter := qt.NewQSplitter3(qt.Horizontal)
+	layout.AddWidget(splitter.QWidget)
+	nwc.requestEdit = qt.NewQTextEdit(nwc.tab)
+	nwc.requestEdit.SetReadOnly(true)
+	nwc.requestEdit.SetPlaceholderText("request event (kind 23194)")
+	splitter.AddWidget(nwc.requestEdit.QWidget)
+	nwc.responseEdit = qt.NewQTextEdit(nwc.tab)
+	nwc.responseEdit.SetReadOnly(true)
+	nwc.responseEdit.SetPlaceholderText("response event (kind 23195)")
+	splitter.AddWidget(nwc.responseEdit.QWidget)
+
+	nwc.resultLabel = qt.NewQLabel2()
+	nwc.resultLabel.SetWordWrap(true)
+	layout.AddWidget(nwc.resultLabel.QWidget)
+
+	return nwc.tab
+}
+
+func (nwc *nwcVars) connect() {
+	conn, err := parseNWC(nwc.uriEdit.Text())
+	if err != nil {
+		nwc.infoLabel.SetText(err.Error())
+		return
+	}
+	nwc.conn = &conn
+	nwc.encryption = "nip04"
+	nwc.infoLabel.SetText("fetching wallet info...")
+
+	go func() {
+		fetchCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+		defer cancel()
+
+		ie := sys.Pool.QuerySingle(fetchCtx, conn.relays, nostr.Filter{
+			Kinds:   []nostr.Kind{13194},
+			Authors: []nostr.PubKey{conn.wallet},
+		}, nostr.SubscriptionOptions{Label: "vnak-nwc"})
+
+		mainthread.Wait(func() {
+			if nwc.conn == nil || nwc.conn.wallet != conn.wallet {
+				return
+			}
+			lines := []string{
+				"wallet: " + nip19.EncodeNpub(conn.wallet),
+				"client: " + nip19.EncodeNpub(conn.secret.Public()),
+				"relays: " + strings.Join(niceRelayURLs(conn.relays), ", "),
+			}
+			if conn.lud16 != "" {
+				lines = append(lines, "lightning address: "+conn.lud16)
+			}
+			if ie == nil {
+				lines = append(lines, "no info event (kind 13194) found, will use nip04")
+			} else {
+				lines = append(lines, "supported methods: "+ie.Event.Content)
+				if tag := ie.Event.Tags.Find("encryption"); tag != nil {
+					lines = append(lines, "encryption: "+tag[1])
+					if strings.Contains(tag[1], "nip44_v2") {
+						nwc.encryption = "nip44_v2"
+					}
+				}
+				if tag := ie.Event.Tags.Find("notifications"); tag != nil {
+					lines = append(lines, "notifications: "+tag[1])
+				}
+			}
+			lines = append(lines, "using "+nwc.encryption)
+			nwc.infoLabel.SetText(strings.Join(lines, "\n"))
+		})
+	}()
+}
+
+func (nwc *nwcVars) send() {
+	if nwc.conn == nil {
+		nwc.resultLabel.SetText("connect to a wallet first")
+		return
+	}
+	conn := *nwc.conn
+	encryption := nwc.encryption
+
+	var params json.RawMessage
+	if err := json.Unmarshal([]byte(nwc.paramsEdit.ToPlainText()), &params); err != nil {
+		nwc.resultLabel.SetText("invalid params: " + err.Error())
+		return
+	}
+	payload, _ := json.Marshal(struct {
+		Method string          `json:"method"`
+		Params json.RawMessage `json:"params"`
+	}{nwc.methodCombo.CurrentText(), params})
+
+	content, err := nwcEncrypt(encryption, conn.secret, conn.wallet, string(payload))
+	if err != nil {
+		nwc.resultLabel.SetText("failed to encrypt: " + err.Error())
+		return
+	}
+	request := nostr.Event{
+		Kind:      23194,
+		CreatedAt: nostr.Now(),
+		Content:   content,
+		Tags:      nostr.Tags{{"p", conn.wallet.Hex()}},
+	}
+	if encryption == "nip44_v2" {
+		request.Tags = append(request.Tags, nostr.Tag{"encryption", "nip44_v2"})
+	}
+	if err := request.Sign(conn.secret); err != nil {
+		nwc.resultLabel.SetText("failed to sign: " + err.Error())
+		return
+	}
+
+	pretty, _ := json.MarshalIndent(request, "", "  ")
+	nwc.requestEdit.SetPlainText(string(pretty) + "\n\ndecrypted content:\n" + string(payload))
+	nwc.responseEdit.SetPlainText("")
+	nwc.resultLabel.SetText("waiting for response...")
+
+	go func() {
+		subCtx, cancel := context.WithTimeout(ctx, time.Second*60)
+		defer cancel()
+
+		// responses are ephemeral, so only publish once the relays have our subscription
+		eose := make(chan struct{})
+		responses := sys.Pool.SubscribeManyNotifyEOSE(subCtx, conn.relays, nostr.Filter{
+			Kinds:   []nostr.Kind{23195},
+			Authors: []nostr.PubKey{conn.wallet},
+			Tags:    nostr.TagMap{"e": []string{request.ID.Hex()}},
+		}, eose, nostr.SubscriptionOptions{Label: "vnak-nwc"})
+		select {
+		case <-eose:
+		case <-time.After(time.Second * 5):
+		}
+
+		mainthread.Wait(func() {
+			publishTo(conn.relays, request, func(url string, err error) {
+				if err != nil {
+					nwc.resultLabel.SetText(niceRelayURL(url) + ": " + err.Error())
+				}
+			})
+		})
+
+		ie, ok := <-responses
+		mainthread.Wait(func() {
+			if !ok {
+				nwc.resultLabel.SetText("no response from the wallet")
+				return
+			}
+			pretty, _ := json.MarshalIndent(ie.Event, "", "  ")
+			text := string(pretty)
+			if plaintext, err := nwcDecrypt(conn.secret, conn.wallet, ie.Event.Content); err != nil {
+				text += "\n\nfailed to decrypt: " + err.Error()
+			} else {
+				var indented json.RawMessage
+				if json.Unmarshal([]byte(plaintext), &indented) == nil {
+					if b, err := json.MarshalIndent(indented, "", "  "); err == nil {
+						plaintext = string(b)
+					}
+				}
+				text += "\n\ndecrypted content:\n" + plaintext
+			}
+			nwc.responseEdit.SetPlainText(text)
+			nwc.resultLabel.SetText("got response from " + niceRelayURL(ie.Relay.URL))
+		})
+	}()
+}
+
+func (p *pasteVars) displayNWC(conn nwcConnection) {
+	label := qt.NewQLabel2()
+	label.SetWordWrap(true)
+	label.SetTextInteractionFlags(qt.TextSelectableByMouse)
+	text := fmt.Sprintf("wallet connect uri\nwallet: %s\nclient: %s\nrelays: %s",
+		nip19.EncodeNpub(conn.wallet), nip19.EncodeNpub(conn.secret.Public()), strings.Join(conn.relays, ", "))
+	if conn.lud16 != "" {
+		text += "\nlightning address: " + conn.lud16
+	}
+	label.SetText(text)
+	p.outputVBox.AddWidget(label.QWidget)
+
+	button := qt.NewQPushButton5("nwc ➡️", window.QWidget)
+	button.OnClicked(func() {
+		nwc.uriEdit.SetText(conn.URI())
+		tabWidget.SetCurrentIndex(tabIndexes.nwc)
+		nwc.connect()
+	})
+	p.outputVBox.AddWidget(button.QWidget)
+}
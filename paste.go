@@ -22,6 +22,7 @@ type pasteVars struct {
 
 	nip05ctxCancel context.CancelFunc
 	nip05ctxAbort  error
+	lookupCancel   context.CancelFunc
 }
 
 var paste = &pasteVars{
@@ -35,7 +36,7 @@ func setupPasteTab() *qt.QWidget {
 
 	// input
 	inputLabel := qt.NewQLabel2()
-	inputLabel.SetText("paste an event, nevent, npub, nip05, filter, naddr or other things:")
+	inputLabel.SetText("paste an event, nevent, npub, nip05, filter, naddr, ncryptsec or other things:")
 	layout.AddWidget(inputLabel.QWidget)
 	paste.inputEdit = qt.NewQTextEdit(tab)
 	layout.AddWidget(paste.inputEdit.QWidget)
@@ -62,6 +63,11 @@ func deleteLayoutRecursively(layout *qt.QLayout) {
 }
 
 func (paste *pasteVars) updatePaste() {
+	if paste.lookupCancel != nil {
+		paste.lookupCancel()
+		paste.lookupCancel = nil
+	}
+
 	// clear previous output
 	for paste.outputVBox.Count() > 0 {
 		item := paste.outputVBox.ItemAt(0)
@@ -79,6 +85,31 @@ func (paste *pasteVars) updatePaste() {
 		return
 	}
 
+	// try ncryptsec
+	if strings.HasPrefix(text, "ncryptsec1") {
+		paste.displayNcryptsec(text)
+		return
+	}
+
+	// try nwc uri
+	if strings.HasPrefix(text, "nostr+walletconnect:") {
+		if conn, err := parseNWC(text); err == nil {
+			paste.displayNWC(conn)
+		} else {
+			errorLabel := qt.NewQLabel2()
+			errorLabel.SetText("invalid wallet connect uri: " + err.Error())
+			paste.outputVBox.AddWidget(errorLabel.QWidget)
+		}
+		return
+	}
+
+	// try nip98 authorization header
+	if evt, ok := decodeHTTPAuth(text); ok {
+		paste.displayHTTPAuth(evt)
+		paste.displayEventButton(evt)
+		return
+	}
+
 	// try nip19 decode
 	if prefix, decoded, err := nip19.Decode(text); err == nil {
 		paste.displayNip19Decoded(prefix, decoded)
@@ -98,7 +129,13 @@ func (paste *pasteVars) updatePaste() {
 	// try JSON event
 	var event nostr.Event
 	if err := json.Unmarshal([]byte(text), &event); err == nil && (event.ID != nostr.ZeroID || event.Kind != 0 || event.CreatedAt != 0 || event.Content != "" || event.Tags != nil || event.PubKey != nostr.ZeroPK) {
+		if event.Kind == 9735 {
+			paste.displayZapReceipt(event)
+		}
 		paste.displayEventButton(event)
+		actionsHBox := qt.NewQHBoxLayout2()
+		paste.outputVBox.AddLayout(actionsHBox.QLayout)
+		addEventActions(actionsHBox, window.QWidget, func() (nostr.Event, bool) { return event, event.ID != nostr.ZeroID })
 		return
 	}
 
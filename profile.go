@@ -0,0 +1,383 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"fiatjaf.com/nostr"
+	"fiatjaf.com/nostr/nip05"
+	qt "github.com/mappu/miqt/qt6"
+	"github.com/mappu/miqt/qt6/mainthread"
+)
+
+var lud16Regex = regexp.MustCompile(`^[a-z0-9\-_.+]+@[a-z0-9\-_.]+\.[a-z]{2,}$`)
+
+type profileVars struct {
+	tab *qt.QWidget
+
+	pubkeyLabel      *qt.QLabel
+	nameEdit         *qt.QLineEdit
+	displayNameEdit  *qt.QLineEdit
+	aboutEdit        *qt.QTextEdit
+	pictureEdit      *qt.QLineEdit
+	bannerEdit       *qt.QLineEdit
+	nip05Edit        *qt.QLineEdit
+	lud16Edit        *qt.QLineEdit
+	websiteEdit      *qt.QLineEdit
+	botCheck         *qt.QCheckBox
+	validationLabels map[string]*qt.QLabel
+	previewLabel     *qt.QLabel
+	contentPreview   *qt.QTextEdit
+	relaysEdit       *qt.QLineEdit
+	publishButton    *qt.QPushButton
+	resultsLabel     *qt.QLabel
+
+	pubkey        nostr.PubKey
+	loaded        bool // whether a load for pubkey finished
+	found         bool // and whether it found an existing kind 0
+	original      map[string]any
+	nip05Verified string
+}
+
+var profile = &profileVars{}
+
+func setupProfileTab() *qt.QWidget {
+	profile.tab = qt.NewQWidget(window.QWidget)
+	layout := qt.NewQHBoxLayout2()
+	profile.tab.SetLayout(layout.QLayout)
+
+	// form
+	formVBox := qt.NewQVBoxLayout2()
+	layout.AddLayout(formVBox.QLayout)
+
+	loadHBox := qt.NewQHBoxLayout2()
+	formVBox.AddLayout(loadHBox.QLayout)
+	loadButton := qt.NewQPushButton5("load current profile", profile.tab)
+	loadHBox.AddWidget(loadButton.QWidget)
+	profile.pubkeyLabel = qt.NewQLabel2()
+	loadHBox.AddWidget(profile.pubkeyLabel.QWidget)
+	loadHBox.AddStretch()
+	loadButton.OnClicked(profile.load)
+
+	profile.validationLabels = make(map[string]*qt.QLabel)
+	addField := func(name string) *qt.QLineEdit {
+		hbox := qt.NewQHBoxLayout2()
+		formVBox.AddLayout(hbox.QLayout)
+		label := qt.NewQLabel2()
+		label.SetText(name + ":")
+		label.SetMinimumWidth(90)
+		hbox.AddWidget(label.QWidget)
+		edit := qt.NewQLineEdit(profile.tab)
+		hbox.AddWidget(edit.QWidget)
+		validation := qt.NewQLabel2()
+		hbox.AddWidget(validation.QWidget)
+		profile.validationLabels[name] = validation
+		edit.OnTextChanged(func(string) { profile.updatePreview() })
+		return edit
+	}
+
+	profile.nameEdit = addField("name")
+	profile.displayNameEdit = addField("display_name")
+	profile.pictureEdit = addField("picture")
+	profile.bannerEdit = addField("banner")
+	profile.nip05Edit = addField("nip05")
+	profile.lud16Edit = addField("lud16")
+	profile.websiteEdit = addField("website")
+
+	profile.nip05Edit.OnEditingFinished(profile.validateNip05)
+
+	aboutLabel := qt.NewQLabel2()
+	aboutLabel.SetText("about:")
+	formVBox.AddWidget(aboutLabel.QWidget)
+	profile.aboutEdit = qt.NewQTextEdit(profile.tab)
+	profile.aboutEdit.SetMaximumHeight(120)
+	profile.aboutEdit.OnTextChanged(profile.updatePreview)
+	formVBox.AddWidget(profile.aboutEdit.QWidget)
+
+	profile.botCheck = qt.NewQCheckBox3("bot")
+	profile.botCheck.OnStateChanged(func(int) { profile.updatePreview() })
+	formVBox.AddWidget(profile.botCheck.QWidget)
+
+	// relays and publish
+	relaysLabel := qt.NewQLabel2()
+	relaysLabel.SetText("publish to relays:")
+	formVBox.AddWidget(relaysLabel.QWidget)
+	profile.relaysEdit = qt.NewQLineEdit(profile.tab)
+	profile.relaysEdit.SetPlaceholderText("space-separated relay urls, filled with your write relays on load")
+	formVBox.AddWidget(profile.relaysEdit.QWidget)
+	profile.publishButton = qt.NewQPushButton5("publish", profile.tab)
+	formVBox.AddWidget(profile.publishButton.QWidget)
+	profile.publishButton.OnClicked(profile.publish)
+	profile.resultsLabel = qt.NewQLabel2()
+	profile.resultsLabel.SetWordWrap(true)
+	formVBox.AddWidget(profile.resultsLabel.QWidget)
+	formVBox.AddStretch()
+
+	// preview
+	previewVBox := qt.NewQVBoxLayout2()
+	layout.AddLayout(previewVBox.QLayout)
+	previewTitle := qt.NewQLabel2()
+	previewTitle.SetText("preview:")
+	previewVBox.AddWidget(previewTitle.QWidget)
+	profile.previewLabel = qt.NewQLabel2()
+	profile.previewLabel.SetTextFormat(qt.RichText)
+	profile.previewLabel.SetWordWrap(true)
+	profile.previewLabel.SetMinimumWidth(300)
+	previewVBox.AddWidget(profile.previewLabel.QWidget)
+	contentTitle := qt.NewQLabel2()
+	contentTitle.SetText("content:")
+	previewVBox.AddWidget(contentTitle.QWidget)
+	profile.contentPreview = qt.NewQTextEdit(profile.tab)
+	profile.contentPreview.SetReadOnly(true)
+	previewVBox.AddWidget(profile.contentPreview.QWidget)
+
+	profile.original = make(map[string]any)
+	profile.updatePreview()
+
+	return profile.tab
+}
+
+func (profile *profileVars) load() {
+	withCurrentPubKey(func(pk nostr.PubKey) {
+		if pk != profile.pubkey {
+			profile.nip05Verified = ""
+		}
+		profile.pubkey = pk
+		profile.loaded = false
+		profile.pubkeyLabel.SetText("loading " + pk.Hex() + "...")
+
+		go func() {
+			fetchCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+			defer cancel()
+			pm := sys.FetchProfileMetadata(fetchCtx, pk)
+			writeRelays := sys.FetchWriteRelays(fetchCtx, pk)
+
+			mainthread.Wait(func() {
+				original := make(map[string]any)
+				if pm.Event != nil {
+					json.Unmarshal([]byte(pm.Event.Content), &original)
+					profile.pubkeyLabel.SetText(fmt.Sprintf("%s, last updated %s",
+						pm.NpubShort(), pm.Event.CreatedAt.Time().Format(time.DateTime)))
+				} else {
+					profile.pubkeyLabel.SetText(pm.NpubShort() + ", no profile found")
+				}
+				profile.original = original
+				profile.loaded = true
+				profile.found = pm.Event != nil
+
+				str := func(key string) string {
+					v, _ := original[key].(string)
+					return v
+				}
+				profile.nameEdit.SetText(str("name"))
+				profile.displayNameEdit.SetText(str("display_name"))
+				profile.aboutEdit.SetPlainText(str("about"))
+				profile.pictureEdit.SetText(str("picture"))
+				profile.bannerEdit.SetText(str("banner"))
+				profile.nip05Edit.SetText(str("nip05"))
+				profile.lud16Edit.SetText(str("lud16"))
+				profile.websiteEdit.SetText(str("website"))
+				bot, _ := original["bot"].(bool)
+				profile.botCheck.SetChecked(bot)
+
+				if len(writeRelays) > 0 {
+					profile.relaysEdit.SetText(strings.Join(writeRelays, " "))
+				}
+
+				profile.validateNip05()
+				profile.updatePreview()
+			})
+		}()
+	})
+}
+
+// merged returns the original metadata with the form fields applied on top, so unknown fields are kept.
+func (profile *profileVars) merged() map[string]any {
+	metadata := make(map[string]any, len(profile.original)+9)
+	for k, v := range profile.original {
+		metadata[k] = v
+	}
+
+	for key, value := range map[string]string{
+		"name":         profile.nameEdit.Text(),
+		"display_name": profile.displayNameEdit.Text(),
+		"about":        profile.aboutEdit.ToPlainText(),
+		"picture":      profile.pictureEdit.Text(),
+		"banner":       profile.bannerEdit.Text(),
+		"nip05":        profile.nip05Edit.Text(),
+		"lud16":        profile.lud16Edit.Text(),
+		"website":      profile.websiteEdit.Text(),
+	} {
+		if value = strings.TrimSpace(value); value != "" {
+			metadata[key] = value
+		} else {
+			delete(metadata, key)
+		}
+	}
+
+	if profile.botCheck.IsChecked() {
+		metadata["bot"] = true
+	} else {
+		delete(metadata, "bot")
+	}
+
+	return metadata
+}
+
+// validate checks the format of the fields and returns a list of problems, a nip05 that doesn't
+// resolve (yet) is only shown as a warning.
+func (profile *profileVars) validate() []string {
+	problems := make([]string, 0, 4)
+	setValidation := func(field string, problem string) {
+		if problem != "" {
+			profile.validationLabels[field].SetText("⚠️")
+			profile.validationLabels[field].SetToolTip(problem)
+			problems = append(problems, field+": "+problem)
+		} else {
+			profile.validationLabels[field].SetText("")
+			profile.validationLabels[field].SetToolTip("")
+		}
+	}
+
+	for field, edit := range map[string]*qt.QLineEdit{
+		"picture": profile.pictureEdit,
+		"banner":  profile.bannerEdit,
+		"website": profile.websiteEdit,
+	} {
+		problem := ""
+		if text := strings.TrimSpace(edit.Text()); text != "" {
+			if u, err := url.Parse(text); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				problem = "not a valid http(s) url"
+			}
+		}
+		setValidation(field, problem)
+	}
+
+	lud16Problem := ""
+	if lud16 := strings.TrimSpace(profile.lud16Edit.Text()); lud16 != "" && !lud16Regex.MatchString(strings.ToLower(lud16)) {
+		lud16Problem = "must look like name@domain.com"
+	}
+	setValidation("lud16", lud16Problem)
+
+	nip05Problem := ""
+	identifier := strings.TrimSpace(profile.nip05Edit.Text())
+	if identifier != "" && !nip05.IsValidIdentifier(identifier) {
+		nip05Problem = "not a valid nip05 identifier"
+	}
+	setValidation("nip05", nip05Problem)
+	if identifier != "" && nip05Problem == "" {
+		if identifier == profile.nip05Verified {
+			profile.validationLabels["nip05"].SetText("✅")
+		} else {
+			profile.validationLabels["nip05"].SetText("⚠️")
+			profile.validationLabels["nip05"].SetToolTip("doesn't resolve to this pubkey (yet)")
+		}
+	}
+
+	return problems
+}
+
+func (profile *profileVars) validateNip05() {
+	identifier := strings.TrimSpace(profile.nip05Edit.Text())
+	if identifier == "" || !nip05.IsValidIdentifier(identifier) || identifier == profile.nip05Verified {
+		return
+	}
+
+	profile.validationLabels["nip05"].SetText("⏳")
+	pubkey := profile.pubkey
+	go func() {
+		queryCtx, cancel := context.WithTimeout(ctx, time.Second*5)
+		defer cancel()
+		pp, err := nip05.QueryIdentifier(queryCtx, identifier)
+		mainthread.Wait(func() {
+			if err == nil && pp.PublicKey == pubkey {
+				profile.nip05Verified = identifier
+			}
+			profile.validate()
+		})
+	}()
+}
+
+func (profile *profileVars) updatePreview() {
+	metadata := profile.merged()
+	content, _ := json.MarshalIndent(metadata, "", "  ")
+	profile.contentPreview.SetPlainText(string(content))
+
+	str := func(key string) string {
+		v, _ := metadata[key].(string)
+		return html.EscapeString(v)
+	}
+	preview := fmt.Sprintf("<h2>%s</h2><p><i>@%s</i></p><p>%s</p>",
+		str("display_name"), str("name"), strings.ReplaceAll(str("about"), "\n", "<br>"))
+	if nip05 := str("nip05"); nip05 != "" {
+		preview += "<p>✔ " + nip05 + "</p>"
+	}
+	if lud16 := str("lud16"); lud16 != "" {
+		preview += "<p>⚡ " + lud16 + "</p>"
+	}
+	if website := str("website"); website != "" {
+		preview += fmt.Sprintf(`<p>🔗 <a href="%s">%s</a></p>`, website, website)
+	}
+	if bot, _ := metadata["bot"].(bool); bot {
+		preview += "<p>🤖 bot</p>"
+	}
+	profile.previewLabel.SetText(preview)
+
+	profile.validate()
+}
+
+func (profile *profileVars) publish() {
+	if problems := profile.validate(); len(problems) > 0 {
+		profile.resultsLabel.SetText("fix these first:\n" + strings.Join(problems, "\n"))
+		return
+	}
+	relays := parseRelays(profile.relaysEdit.Text())
+	if len(relays) == 0 {
+		profile.resultsLabel.SetText("no relays specified")
+		return
+	}
+
+	// publishing without the current profile would drop every field we don't have in the form
+	if !profile.loaded {
+		profile.resultsLabel.SetText("load the current profile first so nothing in it gets lost")
+		return
+	}
+	if !profile.found && qt.QMessageBox_Question6(window.QWidget, "publish profile",
+		"no existing profile was found for this key, publish a new one from scratch?",
+		qt.QMessageBox__Yes|qt.QMessageBox__No, qt.QMessageBox__No) != qt.QMessageBox__Yes {
+		return
+	}
+
+	content, _ := json.Marshal(profile.merged())
+	evt := nostr.Event{
+		Kind:      0,
+		Content:   string(content),
+		CreatedAt: nostr.Now(),
+		Tags:      nostr.Tags{},
+	}
+
+	profile.resultsLabel.SetText("signing...")
+	signer.sign("profile tab", evt, func(signed nostr.Event) {
+		if signed.PubKey != profile.pubkey {
+			profile.resultsLabel.SetText("the loaded profile belongs to another key, load it again")
+			return
+		}
+
+		results := make([]string, 0, len(relays))
+		profile.resultsLabel.SetText("publishing...")
+		publishTo(relays, signed, func(url string, err error) {
+			if err != nil {
+				results = append(results, niceRelayURL(url)+": "+err.Error())
+			} else {
+				results = append(results, niceRelayURL(url)+": ok")
+			}
+			profile.resultsLabel.SetText(strings.Join(results, "\n"))
+		})
+	})
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"fiatjaf.com/nostr"
+	"fiatjaf.com/nostr/nip11"
+	qt "github.com/mappu/miqt/qt6"
+	"github.com/mappu/miqt/qt6/mainthread"
+)
+
+type relayListsVars struct {
+	tab       *qt.QWidget
+	infoLabel *qt.QLabel
+
+	pubkey  nostr.PubKey
+	loaded  bool // whether a load for pubkey finished
+	general *relayListEditor
+	dm      *relayListEditor
+}
+
+type relayListEditor struct {
+	kind       nostr.Kind
+	list       *qt.QListWidget
+	addEdit    *qt.QLineEdit
+	readCheck  *qt.QCheckBox
+	writeCheck *qt.QCheckBox
+	resultText *qt.QLabel
+
+	entries []relayListEntry
+	loaded  *nostr.Event
+}
+
+type relayListEntry struct {
+	url   string
+	read  bool
+	write bool
+	test  string
+}
+
+var relayLists = &relayListsVars{}
+
+func setupRelayListsTab() *qt.QWidget {
+	relayLists.tab = qt.NewQWidget(window.QWidget)
+	layout := qt.NewQVBoxLayout2()
+	relayLists.tab.SetLayout(layout.QLayout)
+
+	loadHBox := qt.NewQHBoxLayout2()
+	layout.AddLayout(loadHBox.QLayout)
+	loadButton := qt.NewQPushButton5("load current relay lists", relayLists.tab)
+	loadHBox.AddWidget(loadButton.QWidget)
+	relayLists.infoLabel = qt.NewQLabel2()
+	loadHBox.AddWidget(relayLists.infoLabel.QWidget)
+	loadHBox.AddStretch()
+	loadButton.OnClicked(relayLists.load)
+
+	relayLists.general = &relayListEditor{kind: 10002}
+	layout.AddWidget(relayLists.general.setup("relay list (kind 10002)").QWidget)
+	relayLists.dm = &relayListEditor{kind: 10050}
+	layout.AddWidget(relayLists.dm.setup("dm relays (kind 10050)").QWidget)
+
+	return relayLists.tab
+}
+
+func (rle *relayListEditor) setup(title string) *qt.QGroupBox {
+	box := qt.NewQGroupBox4(title, relayLists.tab)
+	layout := qt.NewQVBoxLayout2()
+	box.SetLayout(layout.QLayout)
+
+	rle.list = qt.NewQListWidget(box.QWidget)
+	layout.AddWidget(rle.list.QWidget)
+
+	// add
+	addHBox := qt.NewQHBoxLayout2()
+	layout.AddLayout(addHBox.QLayout)
+	rle.addEdit = qt.NewQLineEdit(box.QWidget)
+	rle.addEdit.SetPlaceholderText("wss://relay.example.com")
+	addHBox.AddWidget(rle.addEdit.QWidget)
+	addButton := qt.NewQPushButton5("add", box.QWidget)
+	addHBox.AddWidget(addButton.QWidget)
+	addButton.OnClicked(rle.add)
+	rle.addEdit.OnReturnPressed(rle.add)
+	removeButton := qt.NewQPushButton5("remove", box.QWidget)
+	addHBox.AddWidget(removeButton.QWidget)
+	removeButton.OnClicked(func() {
+		if row := rle.list.CurrentRow(); row >= 0 && row < len(rle.entries) {
+			rle.entries = slices.Delete(rle.entries, row, row+1)
+			rle.render()
+		}
+	})
+
+	// read/write markers only exist in kind 10002
+	if rle.kind == 10002 {
+		rle.readCheck = qt.NewQCheckBox3("read")
+		addHBox.AddWidget(rle.readCheck.QWidget)
+		rle.writeCheck = qt.NewQCheckBox3("write")
+		addHBox.AddWidget(rle.writeCheck.QWidget)
+		updateMarkers := func(bool) {
+			if row := rle.list.CurrentRow(); row >= 0 && row < len(rle.entries) {
+				rle.entries[row].read = rle.readCheck.IsChecked()
+				rle.entries[row].write = rle.writeCheck.IsChecked()
+				rle.list.Item(row).SetText(rle.describe(rle.entries[row]))
+			}
+		}
+		rle.readCheck.OnToggled(updateMarkers)
+		rle.writeCheck.OnToggled(updateMarkers)
+		rle.list.OnCurrentRowChanged(func(row int) {
+			if row < 0 || row >= len(rle.entries) {
+				return
+			}
+			rle.readCheck.BlockSignals(true)
+			rle.writeCheck.BlockSignals(true)
+			rle.readCheck.SetChecked(rle.entries[row].read)
+			rle.writeCheck.SetChecked(rle.entries[row].write)
+			rle.readCheck.BlockSignals(false)
+			rle.writeCheck.BlockSignals(false)
+		})
+	}
+
+	testButton := qt.NewQPushButton5("test all", box.QWidget)
+	addHBox.AddWidget(testButton.QWidget)
+	testButton.OnClicked(rle.testAll)
+	publishButton := qt.NewQPushButton5("publish", box.QWidget)
+	addHBox.AddWidget(publishButton.QWidget)
+	publishButton.OnClicked(rle.publish)
+
+	rle.resultText = qt.NewQLabel2()
+	rle.resultText.SetWordWrap(true)
+	layout.AddWidget(rle.resultText.QWidget)
+
+	return box
+}
+
+func (relayLists *relayListsVars) load() {
+	withCurrentPubKey(func(pk nostr.PubKey) {
+		relayLists.pubkey = pk
+		relayLists.loaded = false
+		relayLists.infoLabel.SetText("loading...")
+
+		go func() {
+			fetchCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+			defer cancel()
+
+			var general, dm *nostr.Event
+			if rl := sys.FetchRelayList(fetchCtx, pk); rl.Event != nil {
+				general = rl.Event
+			}
+			relays := append(slices.Clone(sys.RelayListRelays.URLs), sys.FetchWriteRelays(fetchCtx, pk)...)
+			if ie := sys.Pool.QuerySingle(fetchCtx, relays, nostr.Filter{
+				Kinds:   []nostr.Kind{10050},
+				Authors: []nostr.PubKey{pk},
+			}, nostr.SubscriptionOptions{Label: "vnak-dmrelays"}); ie != nil {
+				dm = &ie.Event
+			}
+
+			mainthread.Wait(func() {
+				relayLists.general.loadEvent(general)
+				relayLists.dm.loadEvent(dm)
+				relayLists.loaded = true
+				relayLists.infoLabel.SetText(fmt.Sprintf("%d relays, %d dm relays",
+					len(relayLists.general.entries), len(relayLists.dm.entries)))
+			})
+		}()
+	})
+}
+
+func (rle *relayListEditor) loadEvent(evt *nostr.Event) {
+	rle.loaded = evt
+	rle.entries = nil
+	if evt != nil {
+		for _, tag := range evt.Tags {
+			if len(tag) < 2 || (rle.kind == 10002 && tag[0] != "r") || (rle.kind == 10050 && tag[0] != "relay") {
+				continue
+			}
+			entry := relayListEntry{url: nostr.NormalizeURL(tag[1]), read: true, write: true}
+			if rle.kind == 10002 && len(tag) >= 3 {
+				switch tag[2] {
+				case "read":
+					entry.write = false
+				case "write":
+					entry.read = false
+				}
+			}
+			rle.entries = append(rle.entries, entry)
+		}
+	}
+	rle.resultText.SetText("")
+	rle.render()
+}
+
+func (rle *relayListEditor) describe(entry relayListEntry) string {
+	text := entry.url
+	if rle.kind == 10002 {
+		markers := make([]string, 0, 2)
+		if entry.read {
+			markers = append(markers, "read")
+		}
+		if entry.write {
+			markers = append(markers, "write")
+		}
+		text += "  [" + strings.Join(markers, ", ") + "]"
+	}
+	if entry.test != "" {
+		text += "  " + entry.test
+	}
+	return text
+}
+
+func (rle *relayListEditor) render() {
+	rle.list.Clear()
+	for _, entry := range rle.entries {
+		rle.list.AddItem(rle.describe(entry))
+	}
+}
+
+func (rle *relayListEditor) add() {
+	url := strings.TrimSpace(rle.addEdit.Text())
+	if url == "" {
+		return
+	}
+	url = nostr.NormalizeURL(url)
+	if slices.ContainsFunc(rle.entries, func(e relayListEntry) bool { return e.url == url }) {
+		rle.resultText.SetText(url + " is already in the list")
+		return
+	}
+	rle.entries = append(rle.entries, relayListEntry{url: url, read: true, write: true})
+	rle.addEdit.SetText("")
+	rle.render()
+	rle.list.SetCurrentRow(len(rle.entries) - 1)
+}
+
+// testAll connects to each relay and fetches its nip-11 document, showing the result on each row.
+func (rle *relayListEditor) testAll() {
+	for i := range rle.entries {
+		rle.entries[i].test = "testing..."
+		url := rle.entries[i].url
+
+		go func() {
+			testCtx, cancel := context.WithTimeout(ctx, time.Second*7)
+			defer cancel()
+
+			results := make([]string, 0, 2)
+			if relay, err := nostr.RelayConnect(testCtx, url, nostr.RelayOptions{}); err != nil {
+				results = append(results, "connection failed: "+err.Error())
+			} else {
+				relay.Close()
+				results = append(results, "connected")
+			}
+			if info, err := nip11.Fetch(testCtx, url); err != nil {
+				results = append(results, "no nip-11: "+err.Error())
+			} else {
+				nip11Text := "nip-11: " + info.Name
+				if info.Software != "" {
+					nip11Text += " (" + info.Software + " " + info.Version + ")"
+				}
+				if info.Limitation != nil && info.Limitation.AuthRequired {
+					nip11Text += ", auth required"
+				}
+				if info.Limitation != nil && info.Limitation.PaymentRequired {
+					nip11Text += ", payment required"
+				}
+				results = append(results, nip11Text)
+			}
+
+			mainthread.Wait(func() {
+				// the list may have changed while we were testing
+				for j, entry := range rle.entries {
+					if entry.url == url {
+						rle.entries[j].test = strings.Join(results, ", ")
+						rle.list.Item(j).SetText(rle.describe(rle.entries[j]))
+					}
+				}
+			})
+		}()
+	}
+	rle.render()
+}
+
+func (rle *relayListEditor) publish() {
+	if !relayLists.loaded {
+		rle.resultText.SetText("load the current relay lists first")
+		return
+	}
+
+	if len(rle.entries) == 0 {
+		answer := qt.QMessageBox_Question6(relayLists.tab, "empty relay list",
+			"you are about to publish an empty relay list. are you sure?",
+			qt.QMessageBox__Yes|qt.QMessageBox__No, qt.QMessageBox__No)
+		if answer != qt.QMessageBox__Yes {
+			return
+		}
+	}
+
+	if rle.kind != 10050 {
+		for _, entry := range rle.entries {
+			if !entry.read && !entry.write {
+				rle.resultText.SetText(niceRelayURL(entry.url) + " is neither read nor write, check one or remove it")
+				return
+			}
+		}
+	}
+
+	evt := nostr.Event{
+		Kind:      rle.kind,
+		CreatedAt: nostr.Now(),
+		Tags:      make(nostr.Tags, 0, len(rle.entries)),
+	}
+	for _, entry := range rle.entries {
+		if rle.kind == 10050 {
+			evt.Tags = append(evt.Tags, nostr.Tag{"relay", entry.url})
+			continue
+		}
+		switch {
+		case entry.read && entry.write:
+			evt.Tags = append(evt.Tags, nostr.Tag{"r", entry.url})
+		case entry.read:
+			evt.Tags = append(evt.Tags, nostr.Tag{"r", entry.url, "read"})
+		case entry.write:
+			evt.Tags = append(evt.Tags, nostr.Tag{"r", entry.url, "write"})
+		}
+	}
+
+	// send it to the old relays, the new relays and the indexers so the change propagates
+	targets := slices.Clone(sys.RelayListRelays.URLs)
+	if rle.loaded != nil {
+		for _, tag := range rle.loaded.Tags {
+			if len(tag) >= 2 && (tag[0] == "r" || tag[0] == "relay") {
+				targets = append(targets, tag[1])
+			}
+		}
+	}
+	for _, entry := range rle.entries {
+		targets = append(targets, entry.url)
+	}
+	if rle.kind == 10050 {
+		// dm relays are looked up on the outbox relays
+		for _, entry := range relayLists.general.entries {
+			if entry.write {
+				targets = append(targets, entry.url)
+			}
+		}
+	}
+	targets = parseRelays(strings.Join(targets, " "))
+
+	rle.resultText.SetText("signing...")
+	signer.sign(fmt.Sprintf("relay lists tab (kind %d)", rle.kind), evt, func(signed nostr.Event) {
+		if signed.PubKey != relayLists.pubkey {
+			rle.resultText.SetText("the loaded relay list belongs to another key, load it again")
+			return
+		}
+
+		results := make([]string, 0, len(targets))
+		publishTo(targets, signed, func(url string, err error) {
+			if err != nil {
+				results = append(results, niceRelayURL(url)+": "+err.Error())
+			} else {
+				results = append(results, niceRelayURL(url)+": ok")
+			}
+			rle.resultText.SetText(strings.Join(results, "\n"))
+		})
+		rle.loaded = &signed
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"fiatjaf.com/nostr"
@@ -38,6 +39,9 @@ type reqVars struct {
 
 	outputEdit  *qt.QTextEdit
 	resultsList *qt.QListWidget
+
+	seenMu sync.Mutex
+	seenOn map[nostr.ID][]string
 }
 
 type reqKindRow struct {
@@ -223,8 +227,48 @@ func setupReqTab() *qt.QWidget {
 	resultsLabel := qt.NewQLabel2()
 	resultsLabel.SetText("results:")
 	req.resultsList = qt.NewQListWidget(req.tab)
+	req.resultsList.SetSelectionMode(qt.QAbstractItemView__ExtendedSelection)
 	resultsVBox.AddWidget(resultsLabel.QWidget)
 	resultsVBox.AddWidget(req.resultsList.QWidget)
+	actionsHBox := qt.NewQHBoxLayout2()
+	resultsVBox.AddLayout(actionsHBox.QLayout)
+	addEventActions(actionsHBox, req.tab, func() (nostr.Event, bool) {
+		var evt nostr.Event
+		item := req.resultsList.CurrentItem()
+		if item == nil {
+			statusLabel.SetText("select an event in the results first")
+			return evt, false
+		}
+		return evt, json.Unmarshal([]byte(item.Text()), &evt) == nil
+	})
+	threadButton := qt.NewQPushButton5("thread", req.tab)
+	actionsHBox.AddWidget(threadButton.QWidget)
+	threadButton.OnClicked(func() {
+		var evt nostr.Event
+		if item := req.resultsList.CurrentItem(); item == nil || json.Unmarshal([]byte(item.Text()), &evt) != nil {
+			statusLabel.SetText("select an event in the results first")
+			return
+		}
+		openThread(evt, req.relays())
+	})
+	deleteButton := qt.NewQPushButton5("delete", req.tab)
+	actionsHBox.AddWidget(deleteButton.QWidget)
+	deleteButton.OnClicked(func() {
+		targets := make([]nostr.Event, 0, 4)
+		relays := make([]string, 0, 4)
+		for _, item := range req.resultsList.SelectedItems() {
+			var evt nostr.Event
+			if json.Unmarshal([]byte(item.Text()), &evt) == nil {
+				targets = append(targets, evt)
+				relays = append(relays, req.relaysSeenOn(evt.ID)...)
+			}
+		}
+		if len(relays) == 0 {
+			relays = req.relays()
+		}
+		slices.Sort(relays)
+		deleteEvents("req tab", targets, slices.Compact(relays), statusLabel.SetText)
+	})
 
 	subscribeHBox := qt.NewQHBoxLayout2()
 	layout.AddLayout(subscribeHBox.QLayout)
@@ -351,14 +395,7 @@ func (req *reqVars) updateReq() {
 }
 
 func (req *reqVars) subscribe() {
-	// collect relays
-	relays := []string{}
-	for _, edit := range req.relaysEdits {
-		url := strings.TrimSpace(edit.Text())
-		if url != "" {
-			relays = append(relays, url)
-		}
-	}
+	relays := req.relays()
 	if len(relays) == 0 {
 		statusLabel.SetText("no relays specified")
 		return
@@ -367,6 +404,7 @@ func (req *reqVars) subscribe() {
 	// subscribe
 	var eoseChan chan struct{}
 	var eventsChan chan nostr.Event
+	singleRelay := ""
 
 	if len(relays) == 1 {
 		relay, err := sys.Pool.EnsureRelay(relays[0])
@@ -396,6 +434,7 @@ func (req *reqVars) subscribe() {
 
 		eventsChan = sub.Events
 		eoseChan = sub.EndOfStoredEvents
+		singleRelay = relay.URL
 
 		go func() {
 			reason := <-sub.ClosedReason
@@ -409,10 +448,24 @@ func (req *reqVars) subscribe() {
 		eoseChan = make(chan struct{})
 		eventsChan = make(chan nostr.Event)
 
+		// dedupe only within this subscription, the seen-on relays are kept across all of them
+		var seenMu sync.Mutex
+		seen := make(map[nostr.ID]struct{})
+
 		go func() {
 			for ie := range sys.Pool.SubscribeManyNotifyEOSE(ctx, relays, req.filter, eoseChan,
 				nostr.SubscriptionOptions{
 					Label: "vnak-req",
+					CheckDuplicate: func(id nostr.ID, relay string) bool {
+						req.markSeen(id, relay)
+						seenMu.Lock()
+						defer seenMu.Unlock()
+						if _, ok := seen[id]; ok {
+							return true
+						}
+						seen[id] = struct{}{}
+						return false
+					},
 				},
 			) {
 				eventsChan <- ie.Event
@@ -424,6 +477,9 @@ func (req *reqVars) subscribe() {
 	eosed := false
 	go func() {
 		for event := range eventsChan {
+			if singleRelay != "" {
+				req.markSeen(event.ID, singleRelay)
+			}
 			jsonBytes, _ := json.Marshal(event)
 			mainthread.Wait(func() {
 				item := qt.NewQListWidgetItem2(string(jsonBytes))
@@ -444,6 +500,24 @@ func (req *reqVars) subscribe() {
 	}()
 }
 
+// markSeen records that a relay has the event.
+func (req *reqVars) markSeen(id nostr.ID, relay string) {
+	req.seenMu.Lock()
+	defer req.seenMu.Unlock()
+	if req.seenOn == nil {
+		req.seenOn = make(map[nostr.ID][]string)
+	}
+	if relays := req.seenOn[id]; !slices.Contains(relays, relay) {
+		req.seenOn[id] = append(relays, relay)
+	}
+}
+
+func (req *reqVars) relaysSeenOn(id nostr.ID) []string {
+	req.seenMu.Lock()
+	defer req.seenMu.Unlock()
+	return slices.Clone(req.seenOn[id])
+}
+
 func (req *reqVars) populate(filter nostr.Filter) {
 	// clear all authors except the first, set the first to ""
 	for _, authorEdit := range req.authorsEdits {
@@ -1,13 +1,10 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"io/fs"
-	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -17,12 +14,9 @@ import (
 	"fiatjaf.com/nostr"
 	"fiatjaf.com/nostr/eventstore/slicestore"
 	"fiatjaf.com/nostr/khatru"
-	"fiatjaf.com/nostr/khatru/blossom"
 	"fiatjaf.com/nostr/khatru/grasp"
-	"github.com/mailru/easyjson"
 	qt "github.com/mappu/miqt/qt6"
 	"github.com/mappu/miqt/qt6/mainthread"
-	"github.com/puzpuzpuz/xsync/v3"
 )
 
 type serveVars struct {
@@ -31,6 +25,8 @@ type serveVars struct {
 	graspCheck      *qt.QCheckBox
 	blossomCheck    *qt.QCheckBox
 	negentropyCheck *qt.QCheckBox
+	walletCheck     *qt.QCheckBox
+	recordCheck     *qt.QCheckBox
 
 	serverAddressInput *qt.QLineEdit
 
@@ -38,22 +34,39 @@ type serveVars struct {
 	stopButton  *qt.QPushButton
 
 	logsList         *qt.QListWidget
-	eventsList       *qt.QListWidget
+	events           serveEventsView
+	removedList      *qt.QListWidget
 	graspReposList   *serveSpecialBox
 	blossomBlobsList *serveSpecialBox
+	walletBox        *serveSpecialBox
 
 	bottomHBox *qt.QHBoxLayout
 
+	blossomOptions  *qt.QWidget
+	blobDirEdit     *qt.QLineEdit
+	blobMaxSizeSpin *qt.QSpinBox
+	blobTypesEdit   *qt.QLineEdit
+
 	relay     *khatru.Relay
 	db        *slicestore.SliceStore
-	blobStore *xsync.MapOf[string, []byte]
+	blobIndex *diskBlobIndex
+	blobRows  []diskBlob
 	repoDir   string
+	wallet    *mockWallet
+	lifecycle *eventLifecycle
+
+	sweeperCancel     context.CancelFunc
+	recorder          *sessionRecorder
+	saveSessionButton *qt.QPushButton
+
+	graspRepoNames []string
 }
 
 type serveSpecialBox struct {
 	vbox  *qt.QVBoxLayout
 	list  *qt.QListWidget
 	label *qt.QLabel
+	extra *qt.QWidget
 }
 
 var serve = &serveVars{}
@@ -63,6 +76,9 @@ func setupServeTab() *qt.QWidget {
 	layout := qt.NewQVBoxLayout2()
 	serve.tab.SetLayout(layout.QLayout)
 
+	// events can be seeded and removed before the relay ever starts
+	serve.lifecycle = newEventLifecycle()
+
 	// checkboxes
 	optionsHBox := qt.NewQHBoxLayout2()
 	layout.AddLayout(optionsHBox.QLayout)
@@ -79,10 +95,21 @@ func setupServeTab() *qt.QWidget {
 	serve.blossomCheck.SetText("blossom")
 	optionsHBox.AddWidget(serve.blossomCheck.QWidget)
 
+	serve.walletCheck = qt.NewQCheckBox(serve.tab)
+	serve.walletCheck.SetText("mock wallet")
+	optionsHBox.AddWidget(serve.walletCheck.QWidget)
+
+	serve.recordCheck = qt.NewQCheckBox(serve.tab)
+	serve.recordCheck.SetText("record session")
+	optionsHBox.AddWidget(serve.recordCheck.QWidget)
+
 	serve.serverAddressInput = qt.NewQLineEdit(serve.tab)
 	serve.serverAddressInput.SetReadOnly(true)
 	optionsHBox.AddWidget(serve.serverAddressInput.QWidget)
 
+	// blossom options, only shown when blossom is checked
+	serve.setupBlossomOptions(layout)
+
 	// buttons
 	buttonsHBox := qt.NewQHBoxLayout2()
 	layout.AddLayout(buttonsHBox.QLayout)
@@ -94,6 +121,19 @@ func setupServeTab() *qt.QWidget {
 	serve.stopButton.SetEnabled(false)
 	buttonsHBox.AddWidget(serve.stopButton.QWidget)
 
+	seedButton := qt.NewQPushButton5("seed...", serve.tab)
+	buttonsHBox.AddWidget(seedButton.QWidget)
+	seedButton.OnClicked(serve.openSeedDialog)
+
+	serve.saveSessionButton = qt.NewQPushButton5("save session...", serve.tab)
+	serve.saveSessionButton.SetEnabled(false)
+	buttonsHBox.AddWidget(serve.saveSessionButton.QWidget)
+	serve.saveSessionButton.OnClicked(serve.saveSession)
+
+	replayButton := qt.NewQPushButton5("replay session...", serve.tab)
+	buttonsHBox.AddWidget(replayButton.QWidget)
+	replayButton.OnClicked(openReplayDialog)
+
 	// logs
 	logsLabel := qt.NewQLabel2()
 	logsLabel.SetText("logs:")
@@ -107,37 +147,7 @@ func setupServeTab() *qt.QWidget {
 	layout.AddLayout(serve.bottomHBox.QLayout)
 
 	// events column
-	eventsVBox := qt.NewQVBoxLayout2()
-	eventsLabel := qt.NewQLabel2()
-	eventsLabel.SetText("events:")
-	eventsVBox.AddWidget(eventsLabel.QWidget)
-	serve.eventsList = qt.NewQListWidget(serve.tab)
-	serve.eventsList.SetMinimumHeight(200)
-	eventsVBox.AddWidget(serve.eventsList.QWidget)
-	serve.bottomHBox.AddLayout(eventsVBox.QLayout)
-
-	// double-click events
-	serve.eventsList.OnItemDoubleClicked(func(item *qt.QListWidgetItem) {
-		var event nostr.Event
-		if err := json.Unmarshal([]byte(item.Text()), &event); err != nil {
-			return
-		}
-		pretty, _ := json.MarshalIndent(event, "", "  ")
-		dialog := qt.NewQDialog(window.QWidget)
-		dialog.SetWindowTitle("event")
-		dialog.SetMinimumWidth(400)
-		dialog.SetMinimumHeight(500)
-		dlayout := qt.NewQVBoxLayout2()
-		dialog.SetLayout(dlayout.QLayout)
-		textEdit := qt.NewQTextEdit(dialog.QWidget)
-		textEdit.SetReadOnly(true)
-		textEdit.SetPlainText(string(pretty))
-		dlayout.AddWidget(textEdit.QWidget)
-		closeButton := qt.NewQPushButton5("close", dialog.QWidget)
-		closeButton.OnClicked(func() { dialog.Close() })
-		dlayout.AddWidget(closeButton.QWidget)
-		dialog.Exec()
-	})
+	serve.bottomHBox.AddLayout(serve.setupEventsColumn().QLayout)
 
 	serve.startButton.OnClicked(serve.startRelay)
 	serve.stopButton.OnClicked(serve.stopRelay)
@@ -150,9 +160,12 @@ func (serve *serveVars) startRelay() {
 	serve.stopButton.SetEnabled(true)
 	serve.negentropyCheck.SetEnabled(false)
 	serve.blossomCheck.SetEnabled(false)
+	serve.blossomOptions.SetEnabled(false)
 	serve.graspCheck.SetEnabled(false)
+	serve.walletCheck.SetEnabled(false)
+	serve.recordCheck.SetEnabled(false)
 
-	// clear blossom and grasp boxes
+	// clear blossom, grasp and wallet boxes
 	if serve.blossomBlobsList != nil {
 		serve.blossomBlobsList.vbox.RemoveWidget(serve.blossomBlobsList.label.QWidget)
 		serve.blossomBlobsList.label.DeleteLater()
@@ -160,6 +173,9 @@ func (serve *serveVars) startRelay() {
 		serve.blossomBlobsList.vbox.RemoveWidget(serve.blossomBlobsList.list.QWidget)
 		serve.blossomBlobsList.list.DeleteLater()
 
+		serve.blossomBlobsList.vbox.RemoveWidget(serve.blossomBlobsList.extra)
+		serve.blossomBlobsList.extra.DeleteLater()
+
 		serve.bottomHBox.RemoveItem(serve.blossomBlobsList.vbox.QLayoutItem)
 		serve.blossomBlobsList.vbox.DeleteLater()
 
@@ -179,6 +195,22 @@ func (serve *serveVars) startRelay() {
 		serve.graspReposList = nil
 	}
 
+	if serve.walletBox != nil {
+		serve.walletBox.vbox.RemoveWidget(serve.walletBox.label.QWidget)
+		serve.walletBox.label.DeleteLater()
+
+		serve.walletBox.vbox.RemoveWidget(serve.walletBox.list.QWidget)
+		serve.walletBox.list.DeleteLater()
+
+		serve.walletBox.vbox.RemoveWidget(serve.walletBox.extra)
+		serve.walletBox.extra.DeleteLater()
+
+		serve.bottomHBox.RemoveItem(serve.walletBox.vbox.QLayoutItem)
+		serve.walletBox.vbox.DeleteLater()
+
+		serve.walletBox = nil
+	}
+
 	// setup relay
 	if serve.db == nil {
 		serve.db = &slicestore.SliceStore{}
@@ -191,6 +223,7 @@ func (serve *serveVars) startRelay() {
 	serve.relay.Info.Version = "dev"
 
 	serve.relay.UseEventstore(serve.db, 500)
+	serve.setupEventLifecycle()
 
 	if serve.negentropyCheck.IsChecked() {
 		serve.relay.Negentropy = true
@@ -203,46 +236,9 @@ func (serve *serveVars) startRelay() {
 	port := 10547
 
 	if serve.blossomCheck.IsChecked() {
-		// setup blossom
-		if serve.blobStore == nil {
-			serve.blobStore = xsync.NewMapOf[string, []byte]()
-		}
-
-		bs := blossom.New(serve.relay, fmt.Sprintf("http://%s:%d", hostname, port))
-		bs.Store = blossom.NewMemoryBlobIndex()
-
-		bs.StoreBlob = func(ctx context.Context, sha256 string, ext string, body []byte) error {
-			serve.blobStore.Store(sha256+ext, body)
-			serve.log("blob stored: %s", sha256+ext)
-			serve.updateBlossomBlobsList()
-			return nil
-		}
-		bs.LoadBlob = func(ctx context.Context, sha256 string, ext string) (io.ReadSeeker, *url.URL, error) {
-			if body, ok := serve.blobStore.Load(sha256 + ext); ok {
-				serve.log("blob download: %s", sha256+ext)
-				return bytes.NewReader(body), nil, nil
-			}
-			return nil, nil, nil
+		if err := serve.setupBlossom(hostname, port); err != nil {
+			serve.log("failed to setup blossom: %s", err)
 		}
-		bs.DeleteBlob = func(ctx context.Context, sha256 string, ext string) error {
-			serve.blobStore.Delete(sha256 + ext)
-			serve.log("blob delete: %s", sha256+ext)
-			serve.updateBlossomBlobsList()
-			return nil
-		}
-
-		// display blossom box
-		serve.blossomBlobsList = &serveSpecialBox{
-			vbox:  qt.NewQVBoxLayout2(),
-			label: qt.NewQLabel2(),
-			list:  qt.NewQListWidget(serve.tab),
-		}
-		serve.blossomBlobsList.list.SetMinimumWidth(300)
-		serve.blossomBlobsList.label.SetText("blossom blobs:")
-		serve.blossomBlobsList.vbox.AddWidget(serve.blossomBlobsList.label.QWidget)
-		serve.blossomBlobsList.vbox.AddWidget(serve.blossomBlobsList.list.QWidget)
-		serve.bottomHBox.AddLayout(serve.blossomBlobsList.vbox.QLayout)
-		serve.updateBlossomBlobsList()
 	}
 
 	if serve.graspCheck.IsChecked() {
@@ -274,15 +270,30 @@ func (serve *serveVars) startRelay() {
 			list:  qt.NewQListWidget(serve.tab),
 		}
 		serve.graspReposList.list.SetMinimumWidth(300)
-		serve.graspReposList.label.SetText("grasp repos:")
+		serve.graspReposList.label.SetText("grasp repos (double-click to browse):")
 		serve.graspReposList.vbox.AddWidget(serve.graspReposList.label.QWidget)
 		serve.graspReposList.vbox.AddWidget(serve.graspReposList.list.QWidget)
 		serve.bottomHBox.AddLayout(serve.graspReposList.vbox.QLayout)
+		serve.graspReposList.list.OnItemDoubleClicked(func(item *qt.QListWidgetItem) {
+			if row := serve.graspReposList.list.Row(item); row >= 0 && row < len(serve.graspRepoNames) {
+				serve.openRepoBrowser(serve.graspRepoNames[row])
+			}
+		})
 		serve.updateGraspReposList()
 	}
 
+	if serve.walletCheck.IsChecked() {
+		serve.setupMockWallet(fmt.Sprintf("ws://%s:%d", hostname, port))
+	}
+
+	// when recording, khatru listens somewhere else and the recorder takes its place in front of it
+	relayPort := port
+	if serve.recordCheck.IsChecked() {
+		relayPort = 0
+	}
+
 	go func() {
-		err := serve.relay.Start(hostname, port, started)
+		err := serve.relay.Start(hostname, relayPort, started)
 		exited <- err
 	}()
 
@@ -304,11 +315,22 @@ func (serve *serveVars) startRelay() {
 
 	serve.relay.OnEvent = func(ctx context.Context, event nostr.Event) (reject bool, msg string) {
 		serve.log("event: %s", event)
+		if reject, msg := serve.lifecycle.rejectRemoved(event); reject {
+			serve.log("rejected %s: %s", event.ID.Hex(), msg)
+			return true, msg
+		}
 		return false, ""
 	}
 
 	serve.relay.OnEventSaved = func(ctx context.Context, event nostr.Event) {
-		serve.updateEventsList()
+		if event.Kind == nostr.KindDeletion {
+			serve.lifecycle.recordDeletion(event)
+		}
+		serve.lifecycle.trackExpiration(event)
+		serve.addEventRow(event)
+		if serve.graspReposList != nil && (event.Kind == nostr.KindRepositoryAnnouncement || event.Kind == nostr.KindRepositoryState) {
+			serve.updateGraspReposList()
+		}
 	}
 
 	totalConnections := atomic.Int32{}
@@ -320,10 +342,28 @@ func (serve *serveVars) startRelay() {
 		}()
 	}
 
+	sweepCtx, cancel := context.WithCancel(ctx)
+	serve.sweeperCancel = cancel
+	go serve.sweepExpired(sweepCtx)
+
 	<-started
+	if serve.recordCheck.IsChecked() {
+		serve.recorder = newSessionRecorder(serve.relay.Addr)
+		if err := serve.recorder.Start(hostname, port); err != nil {
+			serve.log("failed to start session recorder: %s", err)
+		} else {
+			serve.log("recording session")
+		}
+		serve.saveSessionButton.SetEnabled(true)
+	} else {
+		// a previous recording isn't this session
+		serve.recorder = nil
+		serve.saveSessionButton.SetEnabled(false)
+	}
 	serve.log("relay running at %s", fmt.Sprintf("ws://%s:%d", hostname, port))
 	mainthread.Start(func() {
 		serve.serverAddressInput.SetText(fmt.Sprintf("ws://%s:%d", hostname, port))
+		serve.reloadEvents()
 		if serve.graspCheck.IsChecked() {
 			serve.updateGraspReposList()
 		}
@@ -351,11 +391,23 @@ func (serve *serveVars) stopRelay() {
 	if serve.relay != nil {
 		serve.relay.Shutdown(ctx)
 	}
+	if serve.sweeperCancel != nil {
+		serve.sweeperCancel()
+		serve.sweeperCancel = nil
+	}
+	if serve.recorder != nil {
+		serve.recorder.Stop()
+		messages, connections := serve.recorder.summary()
+		serve.log("recorded %d messages from %d connections", messages, connections)
+	}
 	serve.startButton.SetEnabled(true)
 	serve.stopButton.SetEnabled(false)
 	serve.negentropyCheck.SetEnabled(true)
 	serve.blossomCheck.SetEnabled(true)
+	serve.blossomOptions.SetEnabled(true)
 	serve.graspCheck.SetEnabled(true)
+	serve.walletCheck.SetEnabled(true)
+	serve.recordCheck.SetEnabled(true)
 	serve.serverAddressInput.SetText("")
 	serve.log("relay stopped")
 }
@@ -402,6 +454,7 @@ func getHeadCommit(repoPath string) string {
 func (serve *serveVars) updateGraspReposList() {
 	mainthread.Start(func() {
 		serve.graspReposList.list.Clear()
+		serve.graspRepoNames = nil
 		if serve.repoDir == "" {
 			return
 		}
@@ -417,29 +470,35 @@ func (serve *serveVars) updateGraspReposList() {
 			repoPath := filepath.Join(serve.repoDir, d)
 			size := calculateDirSize(repoPath)
 			head := getHeadCommit(repoPath)
-			item := qt.NewQListWidgetItem2(fmt.Sprintf("d: %s\npath: %s\nsize: %d bytes\nhead: %s", d, repoPath, size, head))
+			refs := readGitRefs(repoPath)
+			text := fmt.Sprintf("d: %s\npath: %s\nsize: %d bytes\nhead: %s\n%d branches, %d tags",
+				d, repoPath, size, head, len(refs.branches), len(refs.tags))
+			if _, states := serve.repoEvents(d); len(states) == 0 {
+				text += "\nno state event"
+			} else if mismatches := stateMismatches(states, refs); len(mismatches) > 0 {
+				text += fmt.Sprintf("\n⚠ %d mismatches with the announced state", len(mismatches))
+			}
+			item := qt.NewQListWidgetItem2(text)
 			serve.graspReposList.list.AddItemWithItem(item)
+			serve.graspRepoNames = append(serve.graspRepoNames, d)
 		}
 	})
 }
 
-func (serve *serveVars) updateBlossomBlobsList() {
-	mainthread.Start(func() {
-		serve.blossomBlobsList.list.Clear()
-		for key, value := range serve.blobStore.Range {
-			item := qt.NewQListWidgetItem2(fmt.Sprintf("%s (%d bytes)", key, len(value)))
-			serve.blossomBlobsList.list.AddItemWithItem(item)
-		}
-	})
-}
-
-func (serve *serveVars) updateEventsList() {
-	mainthread.Start(func() {
-		serve.eventsList.Clear()
-		for evt := range serve.db.QueryEvents(nostr.Filter{}, 5000) {
-			evtj, _ := easyjson.Marshal(evt)
-			item := qt.NewQListWidgetItem2(string(evtj))
-			serve.eventsList.AddItemWithItem(item)
-		}
-	})
+func showEventDialog(title string, event nostr.Event) {
+	pretty, _ := json.MarshalIndent(event, "", "  ")
+	dialog := qt.NewQDialog(window.QWidget)
+	dialog.SetWindowTitle(title)
+	dialog.SetMinimumWidth(400)
+	dialog.SetMinimumHeight(500)
+	dlayout := qt.NewQVBoxLayout2()
+	dialog.SetLayout(dlayout.QLayout)
+	textEdit := qt.NewQTextEdit(dialog.QWidget)
+	textEdit.SetReadOnly(true)
+	textEdit.SetPlainText(string(pretty))
+	dlayout.AddWidget(textEdit.QWidget)
+	closeButton := qt.NewQPushButton5("close", dialog.QWidget)
+	closeButton.OnClicked(func() { dialog.Close() })
+	dlayout.AddWidget(closeButton.QWidget)
+	dialog.Exec()
 }
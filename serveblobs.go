@@ -0,0 +1,445 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"mime"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"fiatjaf.com/nostr"
+	"fiatjaf.com/nostr/khatru/blossom"
+	"fiatjaf.com/nostr/nip19"
+	qt "github.com/mappu/miqt/qt6"
+	"github.com/mappu/miqt/qt6/mainthread"
+)
+
+// diskBlobIndex keeps blob descriptors in an index.json file next to the blobs themselves,
+// so everything survives restarts.
+type diskBlobIndex struct {
+	dir   string
+	mu    sync.Mutex
+	blobs map[string]*diskBlob
+}
+
+type diskBlob struct {
+	blossom.BlobDescriptor
+	Ext    string         `json:"ext"`
+	Owners []nostr.PubKey `json:"owners"`
+}
+
+var _ blossom.BlobIndex = (*diskBlobIndex)(nil)
+
+func openDiskBlobIndex(dir string) (*diskBlobIndex, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	x := &diskBlobIndex{
+		dir:   dir,
+		blobs: make(map[string]*diskBlob),
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "index.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return x, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var blobs []*diskBlob
+	if err := json.Unmarshal(data, &blobs); err != nil {
+		return nil, fmt.Errorf("broken index.json: %w", err)
+	}
+	for _, blob := range blobs {
+		// skip entries whose file has gone away
+		if _, err := os.Stat(x.path(blob.SHA256, blob.Ext)); err == nil {
+			x.blobs[blob.SHA256] = blob
+		}
+	}
+	return x, nil
+}
+
+func (x *diskBlobIndex) path(sha256 string, ext string) string {
+	return filepath.Join(x.dir, sha256+ext)
+}
+
+// save must be called with the lock held.
+func (x *diskBlobIndex) save() error {
+	blobs := make([]*diskBlob, 0, len(x.blobs))
+	for _, blob := range x.blobs {
+		blobs = append(blobs, blob)
+	}
+	data, err := json.MarshalIndent(blobs, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(x.dir, "index.json.tmp")
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(x.dir, "index.json"))
+}
+
+func (x *diskBlobIndex) Keep(ctx context.Context, bd blossom.BlobDescriptor, pubkey nostr.PubKey) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if blob, ok := x.blobs[bd.SHA256]; ok {
+		if !slices.Contains(blob.Owners, pubkey) {
+			blob.Owners = append(blob.Owners, pubkey)
+		}
+	} else {
+		x.blobs[bd.SHA256] = &diskBlob{
+			BlobDescriptor: bd,
+			Ext:            extensionFromURL(bd.URL),
+			Owners:         []nostr.PubKey{pubkey},
+		}
+	}
+	return x.save()
+}
+
+func (x *diskBlobIndex) List(ctx context.Context, pubkey nostr.PubKey) iter.Seq[blossom.BlobDescriptor] {
+	x.mu.Lock()
+	bds := make([]blossom.BlobDescriptor, 0, len(x.blobs))
+	for _, blob := range x.blobs {
+		if slices.Contains(blob.Owners, pubkey) {
+			bd := blob.BlobDescriptor
+			bd.Owner = pubkey
+			bds = append(bds, bd)
+		}
+	}
+	x.mu.Unlock()
+	return slices.Values(bds)
+}
+
+// Get returns nil without an error when the blob isn't there, which is what the server
+// expects before deleting the file.
+func (x *diskBlobIndex) Get(ctx context.Context, sha256 string) (*blossom.BlobDescriptor, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if blob, ok := x.blobs[sha256]; ok {
+		bd := blob.BlobDescriptor
+		bd.Owner = blob.Owners[0]
+		return &bd, nil
+	}
+	return nil, nil
+}
+
+func (x *diskBlobIndex) Delete(ctx context.Context, sha256 string, pubkey nostr.PubKey) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	blob, ok := x.blobs[sha256]
+	if !ok {
+		return nil
+	}
+	idx := slices.Index(blob.Owners, pubkey)
+	if idx == -1 {
+		return fmt.Errorf("blob not owned by %s", pubkey.Hex())
+	}
+	blob.Owners = slices.Delete(blob.Owners, idx, idx+1)
+	if len(blob.Owners) == 0 {
+		delete(x.blobs, sha256)
+	}
+	return x.save()
+}
+
+// remove drops the blob and its file regardless of who owns it.
+func (x *diskBlobIndex) remove(sha256 string) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	blob, ok := x.blobs[sha256]
+	if !ok {
+		return nil
+	}
+	delete(x.blobs, sha256)
+	if err := os.Remove(x.path(sha256, blob.Ext)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return x.save()
+}
+
+func (x *diskBlobIndex) all() []diskBlob {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	blobs := make([]diskBlob, 0, len(x.blobs))
+	for _, blob := range x.blobs {
+		blobs = append(blobs, *blob)
+	}
+	slices.SortFunc(blobs, func(a, b diskBlob) int { return int(b.Uploaded - a.Uploaded) })
+	return blobs
+}
+
+func defaultBlobDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "vnak", "blossom")
+}
+
+func (serve *serveVars) setupBlossomOptions(layout *qt.QVBoxLayout) {
+	serve.blossomOptions = qt.NewQWidget(serve.tab)
+	optionsHBox := qt.NewQHBoxLayout2()
+	optionsHBox.SetContentsMargins(0, 0, 0, 0)
+	serve.blossomOptions.SetLayout(optionsHBox.QLayout)
+	layout.AddWidget(serve.blossomOptions)
+
+	dirLabel := qt.NewQLabel2()
+	dirLabel.SetText("blob directory:")
+	optionsHBox.AddWidget(dirLabel.QWidget)
+	serve.blobDirEdit = qt.NewQLineEdit(serve.tab)
+	serve.blobDirEdit.SetText(defaultBlobDir())
+	optionsHBox.AddWidget(serve.blobDirEdit.QWidget)
+	browseButton := qt.NewQPushButton5("browse", serve.tab)
+	optionsHBox.AddWidget(browseButton.QWidget)
+	browseButton.OnClicked(func() {
+		if dir := qt.QFileDialog_GetExistingDirectory3(window.QWidget, "blob directory", serve.blobDirEdit.Text()); dir != "" {
+			serve.blobDirEdit.SetText(dir)
+		}
+	})
+
+	maxSizeLabel := qt.NewQLabel2()
+	maxSizeLabel.SetText("max size:")
+	optionsHBox.AddWidget(maxSizeLabel.QWidget)
+	serve.blobMaxSizeSpin = qt.NewQSpinBox(serve.tab)
+	serve.blobMaxSizeSpin.SetRange(0, 100000)
+	serve.blobMaxSizeSpin.SetValue(100)
+	serve.blobMaxSizeSpin.SetSuffix(" MB")
+	serve.blobMaxSizeSpin.SetSpecialValueText("unlimited")
+	optionsHBox.AddWidget(serve.blobMaxSizeSpin.QWidget)
+
+	typesLabel := qt.NewQLabel2()
+	typesLabel.SetText("allowed types:")
+	optionsHBox.AddWidget(typesLabel.QWidget)
+	serve.blobTypesEdit = qt.NewQLineEdit(serve.tab)
+	serve.blobTypesEdit.SetPlaceholderText("all, or e.g. image/*, text/plain")
+	optionsHBox.AddWidget(serve.blobTypesEdit.QWidget)
+
+	serve.blossomOptions.SetVisible(false)
+	serve.blossomCheck.OnToggled(serve.blossomOptions.SetVisible)
+}
+
+func mimeTypeAllowed(mimetype string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, pattern := range allowed {
+		if pattern == mimetype {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok && strings.HasPrefix(mimetype, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (serve *serveVars) setupBlossom(hostname string, port int) error {
+	index, err := openDiskBlobIndex(serve.blobDirEdit.Text())
+	if err != nil {
+		return err
+	}
+	serve.blobIndex = index
+
+	maxSize := serve.blobMaxSizeSpin.Value() * 1024 * 1024
+	allowed := make([]string, 0, 4)
+	for _, pattern := range strings.Split(serve.blobTypesEdit.Text(), ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			allowed = append(allowed, pattern)
+		}
+	}
+
+	bs := blossom.New(serve.relay, fmt.Sprintf("http://%s:%d", hostname, port))
+	bs.Store = index
+
+	bs.RejectUpload = func(ctx context.Context, auth *nostr.Event, size int, ext string) (bool, string, int) {
+		if maxSize > 0 && size > maxSize {
+			serve.log("blob rejected: %d bytes is over the limit", size)
+			return true, fmt.Sprintf("blob too large, limit is %d bytes", maxSize), 413
+		}
+		mimetype := mime.TypeByExtension(ext)
+		if mimetype == "" {
+			mimetype = "application/octet-stream"
+		}
+		if mediaType, _, _ := strings.Cut(mimetype, ";"); !mimeTypeAllowed(mediaType, allowed) {
+			serve.log("blob rejected: type %s not allowed", mediaType)
+			return true, fmt.Sprintf("type %s not allowed", mediaType), 415
+		}
+		return false, "", 0
+	}
+	bs.StoreBlob = func(ctx context.Context, sha256 string, ext string, body []byte) error {
+		if err := os.WriteFile(index.path(sha256, ext), body, 0o644); err != nil {
+			return err
+		}
+		serve.log("blob stored: %s", sha256+ext)
+		serve.updateBlossomBlobsList()
+		return nil
+	}
+	bs.LoadBlob = func(ctx context.Context, sha256 string, ext string) (io.ReadSeeker, *url.URL, error) {
+		if bd, _ := index.Get(ctx, sha256); bd != nil {
+			ext = extensionFromURL(bd.URL)
+		}
+		file, err := os.Open(index.path(sha256, ext))
+		if err != nil {
+			return nil, nil, nil
+		}
+		serve.log("blob download: %s", sha256+ext)
+		go func() {
+			<-ctx.Done()
+			file.Close()
+		}()
+		return file, nil, nil
+	}
+	bs.DeleteBlob = func(ctx context.Context, sha256 string, ext string) error {
+		matches, _ := filepath.Glob(filepath.Join(index.dir, sha256+"*"))
+		for _, match := range matches {
+			os.Remove(match)
+		}
+		serve.log("blob delete: %s", sha256+ext)
+		serve.updateBlossomBlobsList()
+		return nil
+	}
+
+	// display blossom box
+	serve.blossomBlobsList = &serveSpecialBox{
+		vbox:  qt.NewQVBoxLayout2(),
+		label: qt.NewQLabel2(),
+		list:  qt.NewQListWidget(serve.tab),
+		extra: qt.NewQWidget(serve.tab),
+	}
+	serve.blossomBlobsList.list.SetMinimumWidth(300)
+	serve.blossomBlobsList.label.SetText("blossom blobs:")
+	serve.blossomBlobsList.vbox.AddWidget(serve.blossomBlobsList.label.QWidget)
+	serve.blossomBlobsList.vbox.AddWidget(serve.blossomBlobsList.list.QWidget)
+	serve.blossomBlobsList.vbox.AddWidget(serve.blossomBlobsList.extra)
+	serve.bottomHBox.AddLayout(serve.blossomBlobsList.vbox.QLayout)
+
+	// details, preview and delete
+	extraVBox := qt.NewQVBoxLayout2()
+	extraVBox.SetContentsMargins(0, 0, 0, 0)
+	serve.blossomBlobsList.extra.SetLayout(extraVBox.QLayout)
+	infoLabel := qt.NewQLabel2()
+	infoLabel.SetWordWrap(true)
+	infoLabel.SetTextInteractionFlags(qt.TextSelectableByMouse)
+	extraVBox.AddWidget(infoLabel.QWidget)
+	previewLabel := qt.NewQLabel2()
+	previewLabel.SetAlignment(qt.AlignCenter)
+	previewLabel.SetMaximumHeight(200)
+	previewLabel.SetWordWrap(true)
+	extraVBox.AddWidget(previewLabel.QWidget)
+	deleteButton := qt.NewQPushButton5("delete blob", serve.tab)
+	extraVBox.AddWidget(deleteButton.QWidget)
+
+	serve.blossomBlobsList.list.OnCurrentRowChanged(func(row int) {
+		infoLabel.SetText("")
+		previewLabel.Clear()
+		if row < 0 || row >= len(serve.blobRows) {
+			return
+		}
+		blob := serve.blobRows[row]
+
+		uploaders := make([]string, len(blob.Owners))
+		for i, pk := range blob.Owners {
+			uploaders[i] = nip19.EncodeNpub(pk)
+		}
+		infoLabel.SetText(fmt.Sprintf("%s\ntype: %s\nuploaded: %s\nby: %s",
+			blob.URL, blob.Type, blob.Uploaded.Time().Format(time.DateTime), strings.Join(uploaders, ", ")))
+
+		isImage := strings.HasPrefix(blob.Type, "image/")
+		isText := strings.HasPrefix(blob.Type, "text/") || blob.Type == "application/json"
+		if !isImage && !isText {
+			previewLabel.SetText("(no preview)")
+			return
+		}
+		if isImage && blob.Size > 10_000_000 {
+			previewLabel.SetText("(too large to preview)")
+			return
+		}
+
+		// images need the whole file, text only the beginning
+		limit := 2000
+		if isImage {
+			limit = blob.Size
+		}
+		path := index.path(blob.SHA256, blob.Ext)
+		go func() {
+			data, err := readHead(path, limit)
+			mainthread.Wait(func() {
+				if row := serve.blossomBlobsList.list.CurrentRow(); row < 0 || row >= len(serve.blobRows) || serve.blobRows[row].SHA256 != blob.SHA256 {
+					return
+				}
+				switch {
+				case err != nil:
+					previewLabel.SetText("failed to read blob: " + err.Error())
+				case isImage:
+					pixmap := qt.NewQPixmap()
+					if pixmap.LoadFromDataWithData(data) {
+						previewLabel.SetPixmap(pixmap.Scaled3(300, 200, qt.KeepAspectRatio, qt.SmoothTransformation))
+					} else {
+						previewLabel.SetText("(can't preview this image)")
+					}
+				default:
+					text := string(data)
+					if blob.Size > len(data) {
+						text += "\n..."
+					}
+					previewLabel.SetText(text)
+				}
+			})
+		}()
+	})
+
+	deleteButton.OnClicked(func() {
+		row := serve.blossomBlobsList.list.CurrentRow()
+		if row < 0 || row >= len(serve.blobRows) {
+			return
+		}
+		hash := serve.blobRows[row].SHA256
+		if err := index.remove(hash); err != nil {
+			serve.log("failed to delete blob %s: %s", hash, err)
+			return
+		}
+		serve.log("blob deleted from the ui: %s", hash)
+		serve.updateBlossomBlobsList()
+	})
+
+	serve.updateBlossomBlobsList()
+	serve.log("blossom blobs stored at %s", index.dir)
+	return nil
+}
+
+func (serve *serveVars) updateBlossomBlobsList() {
+	mainthread.Start(func() {
+		if serve.blossomBlobsList == nil {
+			return
+		}
+		serve.blobRows = serve.blobIndex.all()
+		serve.blossomBlobsList.list.Clear()
+		for _, blob := range serve.blobRows {
+			item := qt.NewQListWidgetItem2(fmt.Sprintf("%s (%d bytes, %s)", blob.SHA256+blob.Ext, blob.Size, blob.Type))
+			serve.blossomBlobsList.list.AddItemWithItem(item)
+		}
+	})
+}
+
+// readHead reads at most limit bytes from the start of the file at path.
+func readHead(path string, limit int) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(io.LimitReader(file, int64(limit)))
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"fiatjaf.com/nostr"
+	"github.com/mailru/easyjson"
+	qt "github.com/mappu/miqt/qt6"
+	"github.com/mappu/miqt/qt6/mainthread"
+)
+
+const serveEventsPageSize = 500
+
+// serveEventsView keeps the events list in sync with the store without re-listing everything,
+// eventRows mirrors the rows currently in the list and is only touched from the main thread.
+type serveEventsView struct {
+	filterEdit *qt.QLineEdit
+	list       *qt.QListWidget
+	pageLabel  *qt.QLabel
+	newerBtn   *qt.QPushButton
+	olderBtn   *qt.QPushButton
+
+	filter nostr.Filter
+	page   int
+	total  int
+	rows   []nostr.Event
+}
+
+func (serve *serveVars) setupEventsColumn() *qt.QVBoxLayout {
+	v := &serve.events
+	eventsVBox := qt.NewQVBoxLayout2()
+
+	eventsLabel := qt.NewQLabel2()
+	eventsLabel.SetText("events:")
+	eventsVBox.AddWidget(eventsLabel.QWidget)
+	v.filterEdit = qt.NewQLineEdit(serve.tab)
+	v.filterEdit.SetPlaceholderText(`filter, like {"kinds": [1], "authors": ["..."]}`)
+	eventsVBox.AddWidget(v.filterEdit.QWidget)
+	v.filterEdit.OnTextChanged(func(text string) {
+		debounced.Call(func() {
+			mainthread.Wait(func() {
+				if v.filterEdit.Text() == text {
+					serve.applyEventsFilter()
+				}
+			})
+		})
+	})
+
+	v.list = qt.NewQListWidget(serve.tab)
+	v.list.SetMinimumHeight(200)
+	v.list.SetSelectionMode(qt.QAbstractItemView__ExtendedSelection)
+	eventsVBox.AddWidget(v.list.QWidget)
+	v.list.OnItemDoubleClicked(func(item *qt.QListWidgetItem) {
+		if row := v.list.Row(item); row >= 0 && row < len(v.rows) {
+			showEventDialog("event", v.rows[row])
+		}
+	})
+
+	// paging and actions
+	controlsHBox := qt.NewQHBoxLayout2()
+	eventsVBox.AddLayout(controlsHBox.QLayout)
+	v.newerBtn = qt.NewQPushButton5("◀ newer", serve.tab)
+	controlsHBox.AddWidget(v.newerBtn.QWidget)
+	v.newerBtn.OnClicked(func() {
+		if v.page > 0 {
+			v.page--
+			serve.reloadEvents()
+		}
+	})
+	v.pageLabel = qt.NewQLabel2()
+	controlsHBox.AddWidget(v.pageLabel.QWidget)
+	v.olderBtn = qt.NewQPushButton5("older ▶", serve.tab)
+	controlsHBox.AddWidget(v.olderBtn.QWidget)
+	v.olderBtn.OnClicked(func() {
+		if (v.page+1)*serveEventsPageSize < v.total {
+			v.page++
+			serve.reloadEvents()
+		}
+	})
+	controlsHBox.AddStretch()
+	editButton := qt.NewQPushButton5("edit", serve.tab)
+	controlsHBox.AddWidget(editButton.QWidget)
+	editButton.OnClicked(func() {
+		if row := v.list.CurrentRow(); row >= 0 && row < len(v.rows) {
+			serve.editStoredEvent(v.rows[row])
+		}
+	})
+	deleteButton := qt.NewQPushButton5("delete", serve.tab)
+	controlsHBox.AddWidget(deleteButton.QWidget)
+	deleteButton.OnClicked(serve.deleteSelectedEvents)
+
+	removedLabel := qt.NewQLabel2()
+	removedLabel.SetText("replaced, deleted or expired:")
+	eventsVBox.AddWidget(removedLabel.QWidget)
+	serve.removedList = qt.NewQListWidget(serve.tab)
+	serve.removedList.SetMaximumHeight(150)
+	eventsVBox.AddWidget(serve.removedList.QWidget)
+	serve.removedList.OnItemDoubleClicked(func(item *qt.QListWidgetItem) {
+		reason, j, _ := strings.Cut(strings.TrimPrefix(item.Text(), "["), "] ")
+		var event nostr.Event
+		if err := json.Unmarshal([]byte(j), &event); err != nil {
+			return
+		}
+		showEventDialog(reason, event)
+	})
+
+	serve.updatePageLabel()
+	return eventsVBox
+}
+
+func (serve *serveVars) applyEventsFilter() {
+	v := &serve.events
+	text := strings.TrimSpace(v.filterEdit.Text())
+	filter := nostr.Filter{}
+	if text != "" {
+		if err := json.Unmarshal([]byte(text), &filter); err != nil {
+			v.pageLabel.SetText("invalid filter: " + err.Error())
+			return
+		}
+	}
+	// paging takes care of this
+	filter.Limit = 0
+	filter.LimitZero = false
+
+	v.filter = filter
+	v.page = 0
+	serve.reloadEvents()
+}
+
+// reloadEvents lists the current page from the store, only needed when the filter or page changes.
+func (serve *serveVars) reloadEvents() {
+	v := &serve.events
+	v.list.Clear()
+	v.rows = v.rows[:0]
+	v.total = 0
+	if serve.db == nil {
+		serve.updatePageLabel()
+		return
+	}
+
+	count, _ := serve.db.CountEvents(v.filter)
+	v.total = int(count)
+
+	filter := v.filter
+	offset := v.page * serveEventsPageSize
+	filter.Limit = offset + serveEventsPageSize
+	i := 0
+	for evt := range serve.db.QueryEvents(filter, filter.Limit) {
+		if i >= offset {
+			v.rows = append(v.rows, evt)
+			evtj, _ := easyjson.Marshal(evt)
+			v.list.AddItem(string(evtj))
+		}
+		i++
+	}
+	serve.updatePageLabel()
+}
+
+func (serve *serveVars) updatePageLabel() {
+	v := &serve.events
+	if v.total == 0 {
+		v.pageLabel.SetText("no events")
+	} else {
+		first := v.page*serveEventsPageSize + 1
+		v.pageLabel.SetText(fmt.Sprintf("%d-%d of %d", first, first+len(v.rows)-1, v.total))
+	}
+	v.newerBtn.SetEnabled(v.page > 0)
+	v.olderBtn.SetEnabled((v.page+1)*serveEventsPageSize < v.total)
+}
+
+// addEventRow shows a newly saved event at the top if we're looking at the first page.
+func (serve *serveVars) addEventRow(evt nostr.Event) {
+	mainthread.Start(func() {
+		v := &serve.events
+		if !v.filter.Matches(evt) {
+			return
+		}
+		v.total++
+		if v.page == 0 {
+			evtj, _ := easyjson.Marshal(evt)
+			v.list.InsertItem(0, qt.NewQListWidgetItem2(string(evtj)))
+			v.rows = slices.Insert(v.rows, 0, evt)
+			if len(v.rows) > serveEventsPageSize {
+				v.rows = v.rows[0:serveEventsPageSize]
+				v.list.TakeItem(serveEventsPageSize).Delete()
+			}
+		}
+		serve.updatePageLabel()
+	})
+}
+
+func (serve *serveVars) removeEventRow(id nostr.ID) {
+	mainthread.Start(func() {
+		v := &serve.events
+		idx := slices.IndexFunc(v.rows, func(evt nostr.Event) bool { return evt.ID == id })
+		if idx == -1 {
+			// not on this page, but it may still have been counted
+			if count, err := serve.db.CountEvents(v.filter); err == nil {
+				v.total = int(count)
+			}
+		} else {
+			v.rows = slices.Delete(v.rows, idx, idx+1)
+			v.list.TakeItem(idx).Delete()
+			v.total--
+		}
+		serve.updatePageLabel()
+	})
+}
+
+func (serve *serveVars) addRemovedRow(r removedEvent) {
+	mainthread.Start(func() {
+		evtj, _ := easyjson.Marshal(r.event)
+		item := qt.NewQListWidgetItem2(fmt.Sprintf("[%s] %s", r.reason, evtj))
+		item.SetToolTip(r.at.Format(time.DateTime))
+		serve.removedList.InsertItem(0, item)
+		for serve.removedList.Count() > maxRemovedEvents {
+			serve.removedList.TakeItem(serve.removedList.Count() - 1).Delete()
+		}
+	})
+}
+
+func (serve *serveVars) deleteSelectedEvents() {
+	v := &serve.events
+	targets := make([]nostr.Event, 0, 4)
+	for _, item := range v.list.SelectedItems() {
+		if row := v.list.Row(item); row >= 0 && row < len(v.rows) {
+			targets = append(targets, v.rows[row])
+		}
+	}
+	if len(targets) == 0 {
+		return
+	}
+	if qt.QMessageBox_Question6(window.QWidget, "delete events",
+		fmt.Sprintf("remove %d events from the local store?", len(targets)),
+		qt.QMessageBox__Yes|qt.QMessageBox__No, qt.QMessageBox__No) != qt.QMessageBox__Yes {
+		return
+	}
+	for _, evt := range targets {
+		if err := serve.db.DeleteEvent(evt.ID); err != nil {
+			serve.log("failed to delete %s: %s", evt.ID.Hex(), err)
+			continue
+		}
+		serve.eventRemoved(evt, "deleted from the serve tab")
+	}
+}
+
+// editStoredEvent lets the raw event be changed in the store directly, without any validation,
+// which is useful for seeing how clients deal with broken events.
+func (serve *serveVars) editStoredEvent(original nostr.Event) {
+	pretty, _ := json.MarshalIndent(original, "", "  ")
+	dialog := qt.NewQDialog(window.QWidget)
+	dialog.SetWindowTitle("edit stored event")
+	dialog.SetMinimumWidth(500)
+	dialog.SetMinimumHeight(500)
+	layout := qt.NewQVBoxLayout2()
+	dialog.SetLayout(layout.QLayout)
+
+	textEdit := qt.NewQTextEdit(dialog.QWidget)
+	textEdit.SetAcceptRichText(false)
+	textEdit.SetPlainText(string(pretty))
+	layout.AddWidget(textEdit.QWidget)
+	checkLabel := qt.NewQLabel2()
+	layout.AddWidget(checkLabel.QWidget)
+
+	var edited nostr.Event
+	var parseErr error
+	check := func() {
+		edited = nostr.Event{}
+		parseErr = json.Unmarshal([]byte(textEdit.ToPlainText()), &edited)
+		switch {
+		case parseErr != nil:
+			checkLabel.SetText("invalid JSON: " + parseErr.Error())
+		case !edited.CheckID():
+			checkLabel.SetText("⚠ id doesn't match the contents, it will be stored anyway")
+		case !edited.VerifySignature():
+			checkLabel.SetText("⚠ signature is invalid, it will be stored anyway")
+		default:
+			checkLabel.SetText("✓ valid event")
+		}
+	}
+	textEdit.OnTextChanged(check)
+	check()
+
+	buttonsHBox := qt.NewQHBoxLayout2()
+	layout.AddLayout(buttonsHBox.QLayout)
+	fixIDButton := qt.NewQPushButton5("recompute id", dialog.QWidget)
+	buttonsHBox.AddWidget(fixIDButton.QWidget)
+	fixIDButton.OnClicked(func() {
+		if parseErr == nil {
+			edited.ID = edited.GetID()
+			j, _ := json.MarshalIndent(edited, "", "  ")
+			textEdit.SetPlainText(string(j))
+		}
+	})
+	saveButton := qt.NewQPushButton5("save to store", dialog.QWidget)
+	buttonsHBox.AddWidget(saveButton.QWidget)
+	saveButton.OnClicked(func() {
+		if parseErr != nil {
+			return
+		}
+		if err := serve.db.DeleteEvent(original.ID); err != nil {
+			checkLabel.SetText("failed to remove the original: " + err.Error())
+			return
+		}
+		if err := serve.db.SaveEvent(edited); err != nil {
+			checkLabel.SetText("failed to save: " + err.Error())
+			serve.db.SaveEvent(original)
+			return
+		}
+		serve.log("event %s edited into %s", original.ID.Hex(), edited.ID.Hex())
+		serve.lifecycle.trackExpiration(edited)
+		serve.removeEventRow(original.ID)
+		serve.addEventRow(edited)
+		dialog.Close()
+	})
+	cancelButton := qt.NewQPushButton5("cancel", dialog.QWidget)
+	buttonsHBox.AddWidget(cancelButton.QWidget)
+	cancelButton.OnClicked(func() { dialog.Close() })
+
+	dialog.Exec()
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"fiatjaf.com/nostr"
+	"fiatjaf.com/nostr/nip19"
+	"fiatjaf.com/nostr/nip34"
+	qt "github.com/mappu/miqt/qt6"
+)
+
+type gitRefs struct {
+	head     string
+	branches map[string]string
+	// tags may be annotated, in which case we keep both the tag object and the commit it points to
+	tags map[string][]string
+}
+
+func readGitRefs(repoPath string) gitRefs {
+	refs := gitRefs{
+		branches: make(map[string]string),
+		tags:     make(map[string][]string),
+	}
+
+	cmd := exec.Command("git", "for-each-ref", "--format=%(refname) %(objectname) %(*objectname)")
+	cmd.Dir = repoPath
+	if out, err := cmd.Output(); err == nil {
+		for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) < 2 {
+				continue
+			}
+			if name, ok := strings.CutPrefix(fields[0], "refs/heads/"); ok {
+				refs.branches[name] = fields[1]
+			} else if name, ok := strings.CutPrefix(fields[0], "refs/tags/"); ok {
+				refs.tags[name] = fields[1:]
+			}
+		}
+	}
+
+	cmd = exec.Command("git", "symbolic-ref", "HEAD")
+	cmd.Dir = repoPath
+	if out, err := cmd.Output(); err == nil {
+		refs.head = strings.TrimPrefix(strings.TrimSpace(string(out)), "refs/heads/")
+	}
+
+	return refs
+}
+
+func readGitLog(repoPath string, n int) []string {
+	cmd := exec.Command("git", "log", "--all", fmt.Sprintf("-%d", n), "--date=short", "--format=%h %ad %an: %s")
+	cmd.Dir = repoPath
+	out, err := cmd.Output()
+	if err != nil || len(out) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSpace(string(out)), "\n")
+}
+
+// stateMismatches compares each author's latest state (states come newest first) with refs.
+func stateMismatches(states []nostr.Event, refs gitRefs) []string {
+	mismatches := make([]string, 0, 4)
+	seen := make([]nostr.PubKey, 0, len(states))
+	for _, evt := range states {
+		if slices.Contains(seen, evt.PubKey) {
+			continue
+		}
+		seen = append(seen, evt.PubKey)
+		for _, mismatch := range compareRefs(nip34.ParseRepositoryState(evt), refs) {
+			mismatches = append(mismatches, nip19.EncodeNpub(evt.PubKey)[0:16]+"…: "+mismatch)
+		}
+	}
+	return mismatches
+}
+
+// compareRefs lists the differences between what a kind 30618 event announces and what is actually in git.
+func compareRefs(state nip34.RepositoryState, refs gitRefs) []string {
+	mismatches := make([]string, 0, 4)
+
+	if state.HEAD != "" && state.HEAD != refs.head {
+		mismatches = append(mismatches, fmt.Sprintf("HEAD: announced %s, actual %s", state.HEAD, refs.head))
+	}
+	for name, commit := range state.Branches {
+		if actual, ok := refs.branches[name]; !ok {
+			mismatches = append(mismatches, fmt.Sprintf("branch %s: announced at %s, missing in git", name, short(commit)))
+		} else if actual != commit {
+			mismatches = append(mismatches, fmt.Sprintf("branch %s: announced at %s, actual %s", name, short(commit), short(actual)))
+		}
+	}
+	for name, actual := range refs.branches {
+		if _, ok := state.Branches[name]; !ok {
+			mismatches = append(mismatches, fmt.Sprintf("branch %s: at %s in git, not announced", name, short(actual)))
+		}
+	}
+	for name, commit := range state.Tags {
+		if actual, ok := refs.tags[name]; !ok {
+			mismatches = append(mismatches, fmt.Sprintf("tag %s: announced at %s, missing in git", name, short(commit)))
+		} else if !slices.Contains(actual, commit) {
+			mismatches = append(mismatches, fmt.Sprintf("tag %s: announced at %s, actual %s", name, short(commit), short(actual[0])))
+		}
+	}
+	for name, actual := range refs.tags {
+		if _, ok := state.Tags[name]; !ok {
+			mismatches = append(mismatches, fmt.Sprintf("tag %s: at %s in git, not announced", name, short(actual[0])))
+		}
+	}
+
+	slices.Sort(mismatches)
+	return mismatches
+}
+
+func short(commit string) string {
+	if len(commit) > 10 {
+		return commit[:10]
+	}
+	return commit
+}
+
+// repoEvents gets the announcements and states for a repository from the local relay, latest first.
+func (serve *serveVars) repoEvents(d string) (announcements []nostr.Event, states []nostr.Event) {
+	for evt := range serve.db.QueryEvents(nostr.Filter{
+		Kinds: []nostr.Kind{nostr.KindRepositoryAnnouncement, nostr.KindRepositoryState},
+		Tags:  nostr.TagMap{"d": []string{d}},
+	}, 500) {
+		if evt.Kind == nostr.KindRepositoryAnnouncement {
+			announcements = append(announcements, evt)
+		} else {
+			states = append(states, evt)
+		}
+	}
+	byDate := func(a, b nostr.Event) int { return int(b.CreatedAt - a.CreatedAt) }
+	slices.SortFunc(announcements, byDate)
+	slices.SortFunc(states, byDate)
+	return announcements, states
+}
+
+func (serve *serveVars) openRepoBrowser(d string) {
+	repoPath := filepath.Join(serve.repoDir, d)
+	refs := readGitRefs(repoPath)
+	commits := readGitLog(repoPath, 50)
+	announcements, states := serve.repoEvents(d)
+
+	dialog := qt.NewQDialog(window.QWidget)
+	dialog.SetWindowTitle("repository " + d)
+	dialog.SetMinimumWidth(800)
+	dialog.SetMinimumHeight(600)
+	layout := qt.NewQVBoxLayout2()
+	dialog.SetLayout(layout.QLayout)
+
+	pathLabel := qt.NewQLabel2()
+	pathLabel.SetText(fmt.Sprintf("path: %s\nsize: %d bytes\nHEAD: %s", repoPath, calculateDirSize(repoPath), refs.head))
+	pathLabel.SetTextInteractionFlags(qt.TextSelectableByMouse)
+	layout.AddWidget(pathLabel.QWidget)
+
+	tabs := qt.NewQTabWidget(dialog.QWidget)
+	layout.AddWidget(tabs.QWidget)
+
+	addListTab := func(title string, lines []string) {
+		list := qt.NewQListWidget(dialog.QWidget)
+		for _, line := range lines {
+			list.AddItem(line)
+		}
+		tabs.AddTab(list.QWidget, fmt.Sprintf("%s (%d)", title, len(lines)))
+	}
+
+	// refs
+	branches := make([]string, 0, len(refs.branches))
+	for name, commit := range refs.branches {
+		branches = append(branches, name+"  "+short(commit))
+	}
+	slices.Sort(branches)
+	addListTab("branches", branches)
+	tags := make([]string, 0, len(refs.tags))
+	for name, commits := range refs.tags {
+		tags = append(tags, name+"  "+short(commits[len(commits)-1]))
+	}
+	slices.Sort(tags)
+	addListTab("tags", tags)
+	addListTab("commits", commits)
+
+	mismatches := stateMismatches(states, refs)
+	if len(states) == 0 {
+		mismatches = append(mismatches, "no state event (kind 30618) found for this repository")
+	}
+	addListTab("mismatches", mismatches)
+
+	// events
+	eventsEdit := qt.NewQTextEdit(dialog.QWidget)
+	eventsEdit.SetReadOnly(true)
+	texts := make([]string, 0, len(announcements)+len(states))
+	for _, evt := range slices.Concat(announcements, states) {
+		texts = append(texts, fmt.Sprintf("kind %d from %s at %s:\n%s",
+			evt.Kind, nip19.EncodeNpub(evt.PubKey), evt.CreatedAt.Time().Format(time.DateTime), evt.String()))
+	}
+	eventsEdit.SetPlainText(strings.Join(texts, "\n\n"))
+	tabs.AddTab(eventsEdit.QWidget, fmt.Sprintf("events (%d)", len(texts)))
+
+	closeButton := qt.NewQPushButton5("close", dialog.QWidget)
+	closeButton.OnClicked(func() { dialog.Close() })
+	layout.AddWidget(closeButton.QWidget)
+
+	dialog.Exec()
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"iter"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"fiatjaf.com/nostr"
+	"fiatjaf.com/nostr/eventstore"
+	"fiatjaf.com/nostr/nip40"
+)
+
+// removedEvent is an event that left the local relay, with what caused it.
+type removedEvent struct {
+	event  nostr.Event
+	reason string
+	at     time.Time
+}
+
+type eventLifecycle struct {
+	mu sync.Mutex
+
+	removed []removedEvent
+
+	// ids and addresses targeted by deletions we've seen, pointing to the kind 5 that targeted them
+	deletedIDs       map[nostr.ID]nostr.Event
+	deletedAddresses map[string]nostr.Event
+
+	// when stored events are due to expire, soonest first
+	expirations expirationHeap
+}
+
+type expiration struct {
+	id nostr.ID
+	at nostr.Timestamp
+}
+
+type expirationHeap []expiration
+
+func (h expirationHeap) Len() int           { return len(h) }
+func (h expirationHeap) Less(i, j int) bool { return h[i].at < h[j].at }
+func (h expirationHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *expirationHeap) Push(x any)        { *h = append(*h, x.(expiration)) }
+func (h *expirationHeap) Pop() any {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
+
+const maxRemovedEvents = 1000
+
+func newEventLifecycle() *eventLifecycle {
+	return &eventLifecycle{
+		deletedIDs:       make(map[nostr.ID]nostr.Event),
+		deletedAddresses: make(map[string]nostr.Event),
+	}
+}
+
+func (lc *eventLifecycle) remember(evt nostr.Event, reason string) removedEvent {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	r := removedEvent{event: evt, reason: reason, at: time.Now()}
+	lc.removed = append(lc.removed, r)
+	if len(lc.removed) > maxRemovedEvents {
+		lc.removed = lc.removed[len(lc.removed)-maxRemovedEvents:]
+	}
+	return r
+}
+
+// trackExpiration schedules a stored event to be swept, if it has an expiration.
+func (lc *eventLifecycle) trackExpiration(evt nostr.Event) {
+	at := nip40.GetExpiration(evt.Tags)
+	if at == -1 {
+		return
+	}
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	heap.Push(&lc.expirations, expiration{id: evt.ID, at: at})
+}
+
+func (lc *eventLifecycle) popExpired(now nostr.Timestamp) []nostr.ID {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	ids := make([]nostr.ID, 0, 4)
+	for len(lc.expirations) > 0 && lc.expirations[0].at <= now {
+		ids = append(ids, heap.Pop(&lc.expirations).(expiration).id)
+	}
+	return ids
+}
+
+func isExpired(evt nostr.Event, now nostr.Timestamp) bool {
+	expiration := nip40.GetExpiration(evt.Tags)
+	return expiration != -1 && expiration <= now
+}
+
+// replaceableAddress is like address() but also covers plain replaceable events, which have an empty d.
+func replaceableAddress(evt nostr.Event) string {
+	if evt.Kind.IsReplaceable() {
+		return fmt.Sprintf("%d:%s:", evt.Kind, evt.PubKey.Hex())
+	}
+	return address(evt)
+}
+
+// setupEventLifecycle wraps the eventstore hooks so deletions, replacements and expirations are
+// applied strictly and remembered, must be called after UseEventstore.
+func (serve *serveVars) setupEventLifecycle() {
+	lc := serve.lifecycle
+
+	// we run our own sweeper, khatru's only runs every hour
+	serve.relay.DisableExpirationManager()
+	serve.relay.Info.AddSupportedNIP(9)
+	serve.relay.Info.AddSupportedNIP(40)
+
+	queryStored := serve.relay.QueryStored
+	serve.relay.QueryStored = func(ctx context.Context, filter nostr.Filter) iter.Seq[nostr.Event] {
+		return func(yield func(nostr.Event) bool) {
+			now := nostr.Now()
+			for evt := range queryStored(ctx, filter) {
+				if isExpired(evt, now) {
+					continue
+				}
+				if !yield(evt) {
+					return
+				}
+			}
+		}
+	}
+
+	serve.relay.ReplaceEvent = func(ctx context.Context, evt nostr.Event) error {
+		return serve.replaceStored(evt)
+	}
+
+	serve.relay.DeleteEvent = func(ctx context.Context, id nostr.ID) error {
+		return serve.deleteStored(id)
+	}
+
+	// whatever was stored before this start may still need to expire
+	lc.mu.Lock()
+	lc.expirations = lc.expirations[:0]
+	lc.mu.Unlock()
+	for evt := range serve.db.QueryEvents(nostr.Filter{}, 1_000_000) {
+		lc.trackExpiration(evt)
+	}
+}
+
+// replaceStored saves a replaceable or addressable event unless something newer is there already,
+// taking note of the versions it replaces.
+func (serve *serveVars) replaceStored(evt nostr.Event) error {
+	filter := nostr.Filter{Kinds: []nostr.Kind{evt.Kind}, Authors: []nostr.PubKey{evt.PubKey}}
+	if evt.Kind.IsAddressable() {
+		filter.Tags = nostr.TagMap{"d": []string{evt.Tags.GetD()}}
+	}
+	previous := make([]nostr.Event, 0, 1)
+	for prev := range serve.db.QueryEvents(filter, 10) {
+		if prev.CreatedAt > evt.CreatedAt || (prev.CreatedAt == evt.CreatedAt && prev.ID.Hex() < evt.ID.Hex()) {
+			// we already have something newer, act as if we had this one
+			return eventstore.ErrDupEvent
+		}
+		previous = append(previous, prev)
+	}
+	if err := serve.db.ReplaceEvent(evt); err != nil {
+		return err
+	}
+	for _, prev := range previous {
+		if prev.ID != evt.ID {
+			serve.eventRemoved(prev, "replaced by "+evt.ID.Hex())
+		}
+	}
+	return nil
+}
+
+// deleteStored removes an event from the store and says why, this is what the relay's DeleteEvent
+// does so deletions, expirations and seeding all end up here.
+func (serve *serveVars) deleteStored(id nostr.ID) error {
+	lc := serve.lifecycle
+	var target *nostr.Event
+	for evt := range serve.db.QueryEvents(nostr.Filter{IDs: []nostr.ID{id}}, 1) {
+		target = &evt
+	}
+	if target == nil {
+		return nil
+	}
+	if err := serve.db.DeleteEvent(id); err != nil {
+		return err
+	}
+
+	reason := "deleted"
+	lc.mu.Lock()
+	deletion, ok := lc.deletedIDs[id]
+	if !ok {
+		deletion, ok = lc.deletedAddresses[replaceableAddress(*target)]
+	}
+	lc.mu.Unlock()
+	if ok {
+		reason = "deleted by " + deletion.ID.Hex()
+	} else if isExpired(*target, nostr.Now()) {
+		reason = "expired at " + nip40.GetExpiration(target.Tags).Time().Format(time.DateTime)
+	}
+	serve.eventRemoved(*target, reason)
+	return nil
+}
+
+// recordDeletion takes note of what a kind 5 targets before khatru applies it, so it can't come back.
+func (lc *eventLifecycle) recordDeletion(deletion nostr.Event) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	for _, tag := range deletion.Tags {
+		if len(tag) < 2 {
+			continue
+		}
+		switch tag[0] {
+		case "e":
+			if id, err := nostr.IDFromHex(tag[1]); err == nil {
+				lc.deletedIDs[id] = deletion
+			}
+		case "a":
+			if spl := strings.SplitN(tag[1], ":", 3); len(spl) == 3 && spl[1] == deletion.PubKey.Hex() {
+				lc.deletedAddresses[tag[1]] = deletion
+			}
+		}
+	}
+}
+
+// applyDeletion removes what a kind 5 targets from the store, like khatru does for the ones it receives.
+func (serve *serveVars) applyDeletion(deletion nostr.Event) {
+	targets := make([]nostr.ID, 0, len(deletion.Tags))
+	for _, tag := range deletion.Tags {
+		if len(tag) < 2 {
+			continue
+		}
+		var filter nostr.Filter
+		switch tag[0] {
+		case "e":
+			id, err := nostr.IDFromHex(tag[1])
+			if err != nil {
+				continue
+			}
+			filter = nostr.Filter{IDs: []nostr.ID{id}}
+		case "a":
+			spl := strings.SplitN(tag[1], ":", 3)
+			if len(spl) != 3 || spl[1] != deletion.PubKey.Hex() {
+				continue
+			}
+			kind, err := strconv.Atoi(spl[0])
+			if err != nil {
+				continue
+			}
+			filter = nostr.Filter{
+				Kinds:   []nostr.Kind{nostr.Kind(kind)},
+				Authors: []nostr.PubKey{deletion.PubKey},
+				Tags:    nostr.TagMap{"d": []string{spl[2]}},
+				Until:   deletion.CreatedAt,
+			}
+		default:
+			continue
+		}
+		for target := range serve.db.QueryEvents(filter, 10) {
+			if target.PubKey == deletion.PubKey {
+				targets = append(targets, target.ID)
+			}
+		}
+	}
+
+	for _, id := range targets {
+		if err := serve.deleteStored(id); err != nil {
+			serve.log("failed to apply deletion %s to %s: %s", deletion.ID.Hex(), id.Hex(), err)
+		}
+	}
+}
+
+// rejectRemoved refuses events that are already expired or that were deleted before.
+func (lc *eventLifecycle) rejectRemoved(evt nostr.Event) (reject bool, msg string) {
+	if isExpired(evt, nostr.Now()) {
+		return true, "invalid: event is expired"
+	}
+
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	if deletion, ok := lc.deletedIDs[evt.ID]; ok && deletion.PubKey == evt.PubKey {
+		return true, "blocked: this event was deleted by " + deletion.ID.Hex()
+	}
+	if addr := replaceableAddress(evt); addr != "" {
+		if deletion, ok := lc.deletedAddresses[addr]; ok && evt.CreatedAt <= deletion.CreatedAt {
+			return true, "blocked: this address was deleted at " + strconv.FormatInt(int64(deletion.CreatedAt), 10)
+		}
+	}
+	return false, ""
+}
+
+// sweepExpired removes events as their expirations come due, until ctx is done.
+func (serve *serveVars) sweepExpired(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		now := nostr.Now()
+		for _, id := range serve.lifecycle.popExpired(now) {
+			// it may have been deleted, replaced or edited since
+			stillExpired := false
+			for evt := range serve.db.QueryEvents(nostr.Filter{IDs: []nostr.ID{id}}, 1) {
+				stillExpired = isExpired(evt, now)
+			}
+			if !stillExpired {
+				continue
+			}
+			if err := serve.relay.DeleteEvent(ctx, id); err != nil {
+				serve.log("failed to remove expired %s: %s", id.Hex(), err)
+			} else {
+				serve.log("event %s expired", id.Hex())
+			}
+		}
+	}
+}
+
+// eventRemoved takes note of an event that left the store and updates both lists.
+func (serve *serveVars) eventRemoved(evt nostr.Event, reason string) {
+	r := serve.lifecycle.remember(evt, reason)
+	serve.removeEventRow(evt.ID)
+	serve.addRemovedRow(r)
+}
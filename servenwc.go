@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"fiatjaf.com/nostr"
+	"github.com/btcsuite/btcd/btcutil/bech32"
+	qt "github.com/mappu/miqt/qt6"
+	"github.com/mappu/miqt/qt6/mainthread"
+)
+
+var mockWalletMethods = []string{"get_info", "get_balance", "make_invoice", "pay_invoice", "list_transactions"}
+
+// mockWallet is a fake nip47 wallet service that answers through the local relay, all amounts in msats.
+type mockWallet struct {
+	mu sync.Mutex
+
+	walletKey    nostr.SecretKey
+	clientKey    nostr.SecretKey
+	balance      int64
+	transactions []mockTransaction
+}
+
+type mockTransaction struct {
+	Type        string `json:"type"`
+	State       string `json:"state"`
+	Invoice     string `json:"invoice"`
+	Description string `json:"description"`
+	PaymentHash string `json:"payment_hash"`
+	Preimage    string `json:"preimage,omitempty"`
+	Amount      int64  `json:"amount"`
+	FeesPaid    int64  `json:"fees_paid"`
+	CreatedAt   int64  `json:"created_at"`
+	ExpiresAt   int64  `json:"expires_at"`
+	SettledAt   *int64 `json:"settled_at,omitempty"`
+}
+
+type nwcError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func newMockWallet() *mockWallet {
+	return &mockWallet{
+		walletKey: nostr.Generate(),
+		clientKey: nostr.Generate(),
+		balance:   1_000_000_000,
+	}
+}
+
+func (w *mockWallet) connection(relayURL string) nwcConnection {
+	return nwcConnection{
+		wallet: w.walletKey.Public(),
+		relays: []string{relayURL},
+		secret: w.clientKey,
+	}
+}
+
+func (w *mockWallet) infoEvent() nostr.Event {
+	info := nostr.Event{
+		Kind:      13194,
+		CreatedAt: nostr.Now(),
+		Content:   "get_info get_balance make_invoice pay_invoice list_transactions",
+		Tags:      nostr.Tags{{"encryption", "nip44_v2 nip04"}},
+	}
+	info.Sign(w.walletKey)
+	return info
+}
+
+// mockBolt11 builds an invoice that parseBolt11 understands, with an empty signature.
+func mockBolt11(msats int64, description string, paymentHash []byte) string {
+	data := make([]byte, 0, 200)
+	now := time.Now().Unix()
+	for i := 6; i >= 0; i-- {
+		data = append(data, byte(now>>(5*i))&31)
+	}
+	addField := func(kind byte, value []byte) {
+		groups, _ := bech32.ConvertBits(value, 8, 5, true)
+		data = append(data, kind, byte(len(groups)>>5), byte(len(groups)&31))
+		data = append(data, groups...)
+	}
+	addField(1, paymentHash)
+	if len(description) > 600 {
+		description = description[0:600]
+	}
+	addField(13, []byte(description))
+	data = append(data, make([]byte, 104)...)
+
+	invoice, _ := bech32.Encode("lnbcrt"+strconv.FormatInt(msats*10, 10)+"p", data)
+	return invoice
+}
+
+func (w *mockWallet) handle(method string, params json.RawMessage) (any, *nwcError) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	switch method {
+	case "get_info":
+		return map[string]any{
+			"alias":         "vnak mock wallet",
+			"network":       "regtest",
+			"pubkey":        w.walletKey.Public().Hex(),
+			"methods":       mockWalletMethods,
+			"notifications": []string{},
+		}, nil
+	case "get_balance":
+		return map[string]any{"balance": w.balance}, nil
+	case "make_invoice":
+		var p struct {
+			Amount      int64  `json:"amount"`
+			Description string `json:"description"`
+			Expiry      int64  `json:"expiry"`
+		}
+		if err := json.Unmarshal(params, &p); err != nil || p.Amount <= 0 {
+			return nil, &nwcError{"OTHER", "amount is required"}
+		}
+		if p.Expiry == 0 {
+			p.Expiry = 3600
+		}
+		preimage := make([]byte, 32)
+		rand.Read(preimage)
+		hash := sha256.Sum256(preimage)
+		now := time.Now().Unix()
+		tx := mockTransaction{
+			Type:        "incoming",
+			State:       "pending",
+			Invoice:     mockBolt11(p.Amount, p.Description, hash[:]),
+			Description: p.Description,
+			PaymentHash: hex.EncodeToString(hash[:]),
+			Preimage:    hex.EncodeToString(preimage),
+			Amount:      p.Amount,
+			CreatedAt:   now,
+			ExpiresAt:   now + p.Expiry,
+		}
+		w.transactions = append(w.transactions, tx)
+		tx.Preimage = ""
+		return tx, nil
+	case "pay_invoice":
+		var p struct {
+			Invoice string `json:"invoice"`
+			Amount  int64  `json:"amount"`
+		}
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, &nwcError{"OTHER", err.Error()}
+		}
+		inv, err := parseBolt11(p.Invoice)
+		if err != nil {
+			return nil, &nwcError{"OTHER", "invalid invoice: " + err.Error()}
+		}
+		amount := int64(inv.msats)
+		if !inv.hasAmount {
+			amount = p.Amount
+		}
+		if amount <= 0 {
+			return nil, &nwcError{"OTHER", "amount is required for invoices without one"}
+		}
+		if amount > w.balance {
+			return nil, &nwcError{"INSUFFICIENT_BALANCE", fmt.Sprintf("balance is %d msats", w.balance)}
+		}
+		now := time.Now().Unix()
+
+		// paying one of our own invoices settles it, everything else just leaves
+		preimage := make([]byte, 32)
+		rand.Read(preimage)
+		preimageHex := hex.EncodeToString(preimage)
+		if idx := slices.IndexFunc(w.transactions, func(tx mockTransaction) bool {
+			return tx.Type == "incoming" && tx.PaymentHash == inv.paymentHash
+		}); idx != -1 {
+			if w.transactions[idx].State != "pending" {
+				return nil, &nwcError{"OTHER", "invoice already " + w.transactions[idx].State}
+			}
+			w.transactions[idx].State = "settled"
+			w.transactions[idx].SettledAt = &now
+			w.balance += amount
+			preimageHex = w.transactions[idx].Preimage
+		}
+		w.balance -= amount
+		w.transactions = append(w.transactions, mockTransaction{
+			Type:        "outgoing",
+			State:       "settled",
+			Invoice:     p.Invoice,
+			Description: inv.description,
+			PaymentHash: inv.paymentHash,
+			Preimage:    preimageHex,
+			Amount:      amount,
+			CreatedAt:   now,
+			SettledAt:   &now,
+		})
+		return map[string]any{"preimage": preimageHex, "fees_paid": 0}, nil
+	case "list_transactions":
+		var p struct {
+			Limit  int    `json:"limit"`
+			Offset int    `json:"offset"`
+			Type   string `json:"type"`
+		}
+		json.Unmarshal(params, &p)
+		list := make([]mockTransaction, 0, len(w.transactions))
+		for i := len(w.transactions) - 1; i >= 0; i-- {
+			if p.Type == "" || w.transactions[i].Type == p.Type {
+				list = append(list, w.transactions[i])
+			}
+		}
+		list = list[min(p.Offset, len(list)):]
+		if p.Limit > 0 && p.Limit < len(list) {
+			list = list[0:p.Limit]
+		}
+		return map[string]any{"transactions": list}, nil
+	default:
+		return nil, &nwcError{"NOT_IMPLEMENTED", method + " is not supported"}
+	}
+}
+
+// respond answers a kind 23194 request, returning nil if it wasn't for this wallet.
+func (w *mockWallet) respond(request nostr.Event) *nostr.Event {
+	if tag := request.Tags.Find("p"); tag == nil || tag[1] != w.walletKey.Public().Hex() {
+		return nil
+	}
+
+	encryption := "nip04"
+	if tag := request.Tags.Find("encryption"); tag != nil && tag[1] == "nip44_v2" {
+		encryption = "nip44_v2"
+	}
+
+	var payload struct {
+		Method string          `json:"method"`
+		Params json.RawMessage `json:"params"`
+	}
+	var result any
+	var nwcErr *nwcError
+	if request.PubKey != w.clientKey.Public() {
+		nwcErr = &nwcError{"UNAUTHORIZED", "unknown client"}
+	} else if plaintext, err := nwcDecrypt(w.walletKey, request.PubKey, request.Content); err != nil {
+		nwcErr = &nwcError{"OTHER", "failed to decrypt: " + err.Error()}
+	} else if err := json.Unmarshal([]byte(plaintext), &payload); err != nil {
+		nwcErr = &nwcError{"OTHER", "invalid request: " + err.Error()}
+	} else {
+		result, nwcErr = w.handle(payload.Method, payload.Params)
+	}
+
+	j, _ := json.Marshal(struct {
+		ResultType string    `json:"result_type"`
+		Error      *nwcError `json:"error"`
+		Result     any       `json:"result"`
+	}{payload.Method, nwcErr, result})
+	content, err := nwcEncrypt(encryption, w.walletKey, request.PubKey, string(j))
+	if err != nil {
+		return nil
+	}
+
+	response := nostr.Event{
+		Kind:      23195,
+		CreatedAt: nostr.Now(),
+		Content:   content,
+		Tags:      nostr.Tags{{"p", request.PubKey.Hex()}, {"e", request.ID.Hex()}},
+	}
+	if encryption == "nip44_v2" {
+		response.Tags = append(response.Tags, nostr.Tag{"encryption", "nip44_v2"})
+	}
+	response.Sign(w.walletKey)
+	return &response
+}
+
+func (serve *serveVars) setupMockWallet(relayURL string) {
+	if serve.wallet == nil {
+		serve.wallet = newMockWallet()
+	}
+	serve.db.SaveEvent(serve.wallet.infoEvent())
+	conn := serve.wallet.connection(relayURL)
+
+	serve.relay.OnEphemeralEvent = func(ctx context.Context, event nostr.Event) {
+		if event.Kind != 23194 {
+			return
+		}
+		if response := serve.wallet.respond(event); response != nil {
+			serve.log("mock wallet answered request %s", event.ID.Hex())
+			serve.relay.BroadcastEvent(*response)
+			serve.updateMockWalletBox()
+		}
+	}
+
+	// display wallet box
+	serve.walletBox = &serveSpecialBox{
+		vbox:  qt.NewQVBoxLayout2(),
+		label: qt.NewQLabel2(),
+		list:  qt.NewQListWidget(serve.tab),
+		extra: qt.NewQWidget(serve.tab),
+	}
+	serve.walletBox.list.SetMinimumWidth(300)
+	serve.walletBox.vbox.AddWidget(serve.walletBox.label.QWidget)
+	serve.walletBox.vbox.AddWidget(serve.walletBox.list.QWidget)
+	extraLayout := qt.NewQHBoxLayout2()
+	serve.walletBox.extra.SetLayout(extraLayout.QLayout)
+	copyButton := qt.NewQPushButton5("copy connection uri", serve.walletBox.extra)
+	extraLayout.AddWidget(copyButton.QWidget)
+	copyButton.OnClicked(func() {
+		qt.QGuiApplication_Clipboard().SetText(conn.URI())
+	})
+	openButton := qt.NewQPushButton5("nwc ➡️", serve.walletBox.extra)
+	extraLayout.AddWidget(openButton.QWidget)
+	openButton.OnClicked(func() {
+		nwc.uriEdit.SetText(conn.URI())
+		tabWidget.SetCurrentIndex(tabIndexes.nwc)
+		nwc.connect()
+	})
+	serve.walletBox.vbox.AddWidget(serve.walletBox.extra)
+	serve.bottomHBox.AddLayout(serve.walletBox.vbox.QLayout)
+	serve.updateMockWalletBox()
+}
+
+func (serve *serveVars) updateMockWalletBox() {
+	mainthread.Start(func() {
+		if serve.walletBox == nil {
+			return
+		}
+		serve.wallet.mu.Lock()
+		defer serve.wallet.mu.Unlock()
+
+		serve.walletBox.label.SetText(fmt.Sprintf("mock wallet (nwc), balance: %d sats", serve.wallet.balance/1000))
+		serve.walletBox.list.Clear()
+		for i := len(serve.wallet.transactions) - 1; i >= 0; i-- {
+			tx := serve.wallet.transactions[i]
+			serve.walletBox.list.AddItem(fmt.Sprintf("%s %s %d sats %s\n%s",
+				time.Unix(tx.CreatedAt, 0).Format(time.TimeOnly), tx.Type, tx.Amount/1000, tx.State, tx.Description))
+		}
+	})
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"strings"
+	"time"
+
+	"fiatjaf.com/nostr"
+	"fiatjaf.com/nostr/eventstore"
+	"fiatjaf.com/nostr/eventstore/slicestore"
+	qt "github.com/mappu/miqt/qt6"
+	"github.com/mappu/miqt/qt6/mainthread"
+)
+
+type seedResult struct {
+	saved     int
+	duplicate int
+	invalid   int
+	rejected  int
+	failed    int
+}
+
+func (r seedResult) String() string {
+	return fmt.Sprintf("%d saved, %d already there, %d with invalid signatures, %d expired or deleted, %d failed",
+		r.saved, r.duplicate, r.invalid, r.rejected, r.failed)
+}
+
+// seedEvents inserts events straight into the store, going through the same replacement, deletion
+// and expiration rules the relay uses so the store stays consistent.
+func (serve *serveVars) seedEvents(events []nostr.Event, verify bool) seedResult {
+	var result seedResult
+	for _, evt := range events {
+		if verify && !evt.VerifySignature() {
+			result.invalid++
+			continue
+		}
+		if reject, _ := serve.lifecycle.rejectRemoved(evt); reject {
+			result.rejected++
+			continue
+		}
+
+		var err error
+		if evt.Kind.IsReplaceable() || evt.Kind.IsAddressable() {
+			err = serve.replaceStored(evt)
+		} else {
+			err = serve.db.SaveEvent(evt)
+		}
+
+		switch {
+		case errors.Is(err, eventstore.ErrDupEvent):
+			result.duplicate++
+		case err != nil:
+			result.failed++
+		default:
+			result.saved++
+			serve.lifecycle.trackExpiration(evt)
+			if evt.Kind == nostr.KindDeletion {
+				serve.lifecycle.recordDeletion(evt)
+				serve.applyDeletion(evt)
+			}
+		}
+	}
+	return result
+}
+
+func readJSONL(path string) ([]nostr.Event, int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+
+	events := make([]nostr.Event, 0, 100)
+	broken := 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var evt nostr.Event
+		if err := json.Unmarshal([]byte(line), &evt); err != nil {
+			broken++
+			continue
+		}
+		events = append(events, evt)
+	}
+	return events, broken, scanner.Err()
+}
+
+func (serve *serveVars) openSeedDialog() {
+	dialog := qt.NewQDialog(window.QWidget)
+	dialog.SetWindowTitle("seed the local relay")
+	dialog.SetMinimumWidth(600)
+	layout := qt.NewQVBoxLayout2()
+	dialog.SetLayout(layout.QLayout)
+
+	verifyCheck := qt.NewQCheckBox3("skip events with invalid signatures")
+	verifyCheck.SetChecked(true)
+	layout.AddWidget(verifyCheck.QWidget)
+
+	resultLabel := qt.NewQLabel2()
+	resultLabel.SetWordWrap(true)
+
+	var buttons []*qt.QPushButton
+	run := func(what string, load func() ([]nostr.Event, error)) {
+		// the relay may not have been started yet, startRelay will use this same store
+		if serve.db == nil {
+			serve.db = &slicestore.SliceStore{}
+		}
+		for _, button := range buttons {
+			button.SetEnabled(false)
+		}
+		resultLabel.SetText(what + "...")
+		verify := verifyCheck.IsChecked()
+		go func() {
+			events, err := load()
+			result := serve.seedEvents(events, verify)
+			serve.log("seeded from %s: %s", what, result)
+			mainthread.Wait(func() {
+				for _, button := range buttons {
+					button.SetEnabled(true)
+				}
+				if err != nil {
+					resultLabel.SetText(fmt.Sprintf("%s: %s (%s)", what, err, result))
+				} else {
+					resultLabel.SetText(fmt.Sprintf("%s: %s", what, result))
+				}
+				serve.reloadEvents()
+			})
+		}()
+	}
+
+	// from files
+	filesBox := qt.NewQGroupBox4("from JSONL files", dialog.QWidget)
+	filesLayout := qt.NewQHBoxLayout2()
+	filesBox.SetLayout(filesLayout.QLayout)
+	layout.AddWidget(filesBox.QWidget)
+	filesButton := qt.NewQPushButton5("choose files...", dialog.QWidget)
+	filesLayout.AddWidget(filesButton.QWidget)
+	buttons = append(buttons, filesButton)
+	filesButton.OnClicked(func() {
+		paths := qt.QFileDialog_GetOpenFileNames4(dialog.QWidget, "events to load", "", "JSONL files (*.jsonl *.json *.txt);;all files (*)")
+		if len(paths) == 0 {
+			return
+		}
+		run(fmt.Sprintf("%d files", len(paths)), func() ([]nostr.Event, error) {
+			events := make([]nostr.Event, 0, 100)
+			broken := 0
+			for _, path := range paths {
+				fileEvents, fileBroken, err := readJSONL(path)
+				if err != nil {
+					return events, fmt.Errorf("failed to read %s: %w", path, err)
+				}
+				events = append(events, fileEvents...)
+				broken += fileBroken
+			}
+			if broken > 0 {
+				return events, fmt.Errorf("%d lines weren't events", broken)
+			}
+			return events, nil
+		})
+	})
+
+	// from remote relays
+	remoteBox := qt.NewQGroupBox4("from remote relays", dialog.QWidget)
+	remoteLayout := qt.NewQVBoxLayout2()
+	remoteBox.SetLayout(remoteLayout.QLayout)
+	layout.AddWidget(remoteBox.QWidget)
+	filterEdit := qt.NewQLineEdit(dialog.QWidget)
+	filterEdit.SetPlaceholderText(`filter, like {"kinds": [1], "limit": 200}`)
+	remoteLayout.AddWidget(filterEdit.QWidget)
+	relaysEdit := qt.NewQLineEdit(dialog.QWidget)
+	relaysEdit.SetPlaceholderText("relays to fetch from")
+	remoteLayout.AddWidget(relaysEdit.QWidget)
+	fetchButton := qt.NewQPushButton5("fetch and seed", dialog.QWidget)
+	remoteLayout.AddWidget(fetchButton.QWidget)
+	buttons = append(buttons, fetchButton)
+	fetchButton.OnClicked(func() {
+		var filter nostr.Filter
+		if err := json.Unmarshal([]byte(filterEdit.Text()), &filter); err != nil {
+			resultLabel.SetText("invalid filter: " + err.Error())
+			return
+		}
+		relays := parseRelays(relaysEdit.Text())
+		if len(relays) == 0 {
+			resultLabel.SetText("no relays specified")
+			return
+		}
+		run(strings.Join(niceRelayURLs(relays), ", "), func() ([]nostr.Event, error) {
+			fetchCtx, cancel := context.WithTimeout(ctx, time.Second*30)
+			defer cancel()
+			events := make([]nostr.Event, 0, max(filter.Limit, 100))
+			for ie := range sys.Pool.FetchMany(fetchCtx, relays, filter, nostr.SubscriptionOptions{Label: "vnak-seed"}) {
+				events = append(events, ie.Event)
+			}
+			return events, nil
+		})
+	})
+
+	// synthetic
+	syntheticBox := qt.NewQGroupBox4("generate synthetic data", dialog.QWidget)
+	syntheticForm := qt.NewQFormLayout2()
+	syntheticBox.SetLayout(syntheticForm.QLayout)
+	layout.AddWidget(syntheticBox.QWidget)
+	usersSpin := qt.NewQSpinBox(dialog.QWidget)
+	usersSpin.SetRange(1, 1000)
+	usersSpin.SetValue(20)
+	syntheticForm.AddRow3("users:", usersSpin.QWidget)
+	notesSpin := qt.NewQSpinBox(dialog.QWidget)
+	notesSpin.SetRange(0, 500)
+	notesSpin.SetValue(10)
+	syntheticForm.AddRow3("notes per user:", notesSpin.QWidget)
+	generateButton := qt.NewQPushButton5("generate", dialog.QWidget)
+	syntheticForm.AddRowWithWidget(generateButton.QWidget)
+	buttons = append(buttons, generateButton)
+	generateButton.OnClicked(func() {
+		users := usersSpin.Value()
+		notes := notesSpin.Value()
+		relayURL := serve.serverAddressInput.Text()
+		run(fmt.Sprintf("%d synthetic users", users), func() ([]nostr.Event, error) {
+			return generateSyntheticEvents(users, notes, relayURL), nil
+		})
+	})
+
+	layout.AddWidget(resultLabel.QWidget)
+	closeButton := qt.NewQPushButton5("close", dialog.QWidget)
+	closeButton.OnClicked(func() { dialog.Close() })
+	layout.AddWidget(closeButton.QWidget)
+
+	dialog.Exec()
+}
+
+var syntheticWords = strings.Fields(`
+	nostr relay note zap bitcoin lightning key signature event client protocol censorship
+	freedom coffee morning build ship test bug fix release thread reply today tomorrow
+	weather music book movie garden city ocean mountain train walk think write read
+	simple small fast slow great weird interesting new old good bad open`)
+
+func syntheticText(r *rand.Rand, words int) string {
+	parts := make([]string, words)
+	for i := range parts {
+		parts[i] = syntheticWords[r.IntN(len(syntheticWords))]
+	}
+	return strings.Join(parts, " ")
+}
+
+// generateSyntheticEvents creates throwaway users with profiles, follows, notes, threads and reactions,
+// all properly signed and spread over the last month.
+func generateSyntheticEvents(users int, notesPerUser int, relayURL string) []nostr.Event {
+	r := rand.New(rand.NewPCG(uint64(time.Now().UnixNano()), 0))
+	now := nostr.Now()
+	month := nostr.Timestamp(30 * 24 * 60 * 60)
+
+	keys := make([]nostr.SecretKey, users)
+	for i := range keys {
+		keys[i] = nostr.Generate()
+	}
+
+	events := make([]nostr.Event, 0, users*(notesPerUser*3+3))
+	sign := func(sk nostr.SecretKey, evt nostr.Event) nostr.Event {
+		evt.Sign(sk)
+		events = append(events, evt)
+		return evt
+	}
+
+	notes := make([]nostr.Event, 0, users*notesPerUser)
+	for i, sk := range keys {
+		name := fmt.Sprintf("%s%d", syntheticWords[r.IntN(len(syntheticWords))], i)
+		metadata, _ := json.Marshal(map[string]string{
+			"name":    name,
+			"about":   syntheticText(r, 8),
+			"picture": "https://robohash.org/" + name,
+		})
+		sign(sk, nostr.Event{Kind: 0, CreatedAt: now - month, Content: string(metadata)})
+
+		follows := nostr.Event{Kind: 3, CreatedAt: now - month}
+		for j, other := range keys {
+			if j != i && r.IntN(3) == 0 {
+				follows.Tags = append(follows.Tags, nostr.Tag{"p", other.Public().Hex()})
+			}
+		}
+		sign(sk, follows)
+
+		if relayURL != "" {
+			sign(sk, nostr.Event{Kind: 10002, CreatedAt: now - month, Tags: nostr.Tags{{"r", relayURL}}})
+		}
+
+		for range notesPerUser {
+			notes = append(notes, sign(sk, nostr.Event{
+				Kind:      1,
+				CreatedAt: now - month + nostr.Timestamp(r.Int64N(int64(month))),
+				Content:   syntheticText(r, 5+r.IntN(30)),
+			}))
+		}
+	}
+
+	// replies and reactions from random users, some replying to replies to make deeper threads
+	for range len(notes) {
+		target := notes[r.IntN(len(notes))]
+		sk := keys[r.IntN(len(keys))]
+		after := target.CreatedAt + nostr.Timestamp(1+r.IntN(3600))
+		if after > now {
+			after = now
+		}
+
+		if r.IntN(2) == 0 {
+			reply := buildReply(target, relayURL)
+			reply.CreatedAt = after
+			reply.Content = syntheticText(r, 3+r.IntN(15))
+			notes = append(notes, sign(sk, reply))
+		} else {
+			reaction := buildReaction(target, relayURL)
+			reaction.CreatedAt = after
+			sign(sk, reaction)
+		}
+	}
+
+	return events
+}
@@ -0,0 +1,512 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fasthttp/websocket"
+	qt "github.com/mappu/miqt/qt6"
+	"github.com/mappu/miqt/qt6/mainthread"
+)
+
+// sessionEntry is one line of a session file, times are in milliseconds since the recording started.
+type sessionEntry struct {
+	Time    int64           `json:"t"`
+	Conn    int             `json:"conn"`
+	Dir     string          `json:"dir"` // "connect", "in" (client to relay), "out" (relay to client) or "disconnect"
+	Message json.RawMessage `json:"msg,omitempty"`
+	Raw     string          `json:"raw,omitempty"` // for messages that aren't valid JSON
+}
+
+func (entry sessionEntry) payload() []byte {
+	if entry.Message != nil {
+		return entry.Message
+	}
+	return []byte(entry.Raw)
+}
+
+var wsUpgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// sessionRecorder sits in front of the khatru relay and records every websocket message that goes through it,
+// everything else is just proxied.
+type sessionRecorder struct {
+	mu       sync.Mutex
+	start    time.Time
+	entries  []sessionEntry
+	nextConn int
+	conns    []*websocket.Conn
+
+	upstream string
+	proxy    *httputil.ReverseProxy
+	server   *http.Server
+}
+
+func newSessionRecorder(upstreamAddr string) *sessionRecorder {
+	return &sessionRecorder{
+		start:    time.Now(),
+		upstream: "ws://" + upstreamAddr,
+		proxy:    httputil.NewSingleHostReverseProxy(&url.URL{Scheme: "http", Host: upstreamAddr}),
+	}
+}
+
+func (rec *sessionRecorder) record(conn int, dir string, msg []byte) {
+	entry := sessionEntry{Conn: conn, Dir: dir}
+	if json.Valid(msg) {
+		entry.Message = append(json.RawMessage(nil), msg...)
+	} else {
+		entry.Raw = string(msg)
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	entry.Time = time.Since(rec.start).Milliseconds()
+	rec.entries = append(rec.entries, entry)
+}
+
+func (rec *sessionRecorder) Start(host string, port int) error {
+	ln, err := net.Listen("tcp", net.JoinHostPort(host, fmt.Sprint(port)))
+	if err != nil {
+		return err
+	}
+	rec.server = &http.Server{Handler: rec}
+	go rec.server.Serve(ln)
+	return nil
+}
+
+func (rec *sessionRecorder) Stop() {
+	if rec.server != nil {
+		rec.server.Shutdown(ctx)
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	for _, conn := range rec.conns {
+		conn.Close()
+	}
+	rec.conns = nil
+}
+
+func (rec *sessionRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !websocket.IsWebSocketUpgrade(r) {
+		rec.proxy.ServeHTTP(w, r)
+		return
+	}
+
+	// keep the original host so things like nip42 auth still see the address the client used
+	header := http.Header{"Host": {r.Host}, "X-Forwarded-For": {r.RemoteAddr}}
+	upstream, _, err := websocket.DefaultDialer.DialContext(r.Context(), rec.upstream+r.URL.RequestURI(), header)
+	if err != nil {
+		http.Error(w, "relay unavailable", http.StatusBadGateway)
+		return
+	}
+	client, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		upstream.Close()
+		return
+	}
+
+	rec.mu.Lock()
+	rec.nextConn++
+	id := rec.nextConn
+	rec.conns = append(rec.conns, client, upstream)
+	rec.mu.Unlock()
+
+	addr, _ := json.Marshal(r.RemoteAddr)
+	rec.record(id, "connect", addr)
+
+	var once sync.Once
+	done := func() {
+		once.Do(func() {
+			client.Close()
+			upstream.Close()
+			rec.record(id, "disconnect", nil)
+		})
+	}
+	pump := func(from, to *websocket.Conn, dir string) {
+		defer done()
+		for {
+			typ, msg, err := from.ReadMessage()
+			if err != nil {
+				return
+			}
+			rec.record(id, dir, msg)
+			if err := to.WriteMessage(typ, msg); err != nil {
+				return
+			}
+		}
+	}
+	go pump(client, upstream, "in")
+	go pump(upstream, client, "out")
+}
+
+func (rec *sessionRecorder) summary() (messages int, connections int) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	for _, entry := range rec.entries {
+		if entry.Dir == "in" || entry.Dir == "out" {
+			messages++
+		}
+	}
+	return messages, rec.nextConn
+}
+
+func (rec *sessionRecorder) save(path string) error {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	enc := json.NewEncoder(file)
+	for _, entry := range rec.entries {
+		if err := enc.Encode(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readSession(path string) ([]sessionEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	entries := make([]sessionEntry, 0, 100)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var entry sessionEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// sessionConnections groups entries by connection, in the order connections were opened.
+func sessionConnections(entries []sessionEntry) [][]sessionEntry {
+	order := make([]int, 0, 4)
+	byConn := make(map[int][]sessionEntry)
+	for _, entry := range entries {
+		if _, ok := byConn[entry.Conn]; !ok {
+			order = append(order, entry.Conn)
+		}
+		byConn[entry.Conn] = append(byConn[entry.Conn], entry)
+	}
+	conns := make([][]sessionEntry, len(order))
+	for i, id := range order {
+		conns[i] = byConn[id]
+	}
+	return conns
+}
+
+// sleepUntil waits until offset milliseconds after start, returning false if ctx is done first.
+func sleepUntil(ctx context.Context, start time.Time, offset int64) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(time.Until(start.Add(time.Duration(offset) * time.Millisecond))):
+		return true
+	}
+}
+
+// replayAsClient sends the recorded client messages to relayURL with the recorded timing and reports what comes back.
+func replayAsClient(ctx context.Context, entries []sessionEntry, relayURL string, report func(string)) {
+	start := time.Now()
+	var wg sync.WaitGroup
+	for _, conn := range sessionConnections(entries) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			id := conn[0].Conn
+			if !sleepUntil(ctx, start, conn[0].Time) {
+				return
+			}
+
+			ws, _, err := websocket.DefaultDialer.DialContext(ctx, relayURL, nil)
+			if err != nil {
+				report(fmt.Sprintf("conn %d: failed to connect: %s", id, err))
+				return
+			}
+			defer ws.Close()
+			report(fmt.Sprintf("conn %d: connected", id))
+
+			recorded := 0
+			received := atomic.Int32{}
+			go func() {
+				for {
+					_, msg, err := ws.ReadMessage()
+					if err != nil {
+						return
+					}
+					received.Add(1)
+					report(fmt.Sprintf("%6.2fs conn %d ⬅️ %s", time.Since(start).Seconds(), id, msg))
+				}
+			}()
+
+			for _, entry := range conn {
+				switch entry.Dir {
+				case "out":
+					recorded++
+				case "in":
+					if !sleepUntil(ctx, start, entry.Time) {
+						return
+					}
+					if err := ws.WriteMessage(websocket.TextMessage, entry.payload()); err != nil {
+						report(fmt.Sprintf("conn %d: failed to send: %s", id, err))
+						return
+					}
+					report(fmt.Sprintf("%6.2fs conn %d ➡️ %s", time.Since(start).Seconds(), id, entry.payload()))
+				case "disconnect":
+					if !sleepUntil(ctx, start, entry.Time) {
+						return
+					}
+				}
+			}
+
+			// give the relay some time to answer the last messages
+			sleepUntil(ctx, time.Now(), 2000)
+			report(fmt.Sprintf("conn %d: done, received %d messages, %d were recorded", id, received.Load(), recorded))
+		}()
+	}
+	wg.Wait()
+}
+
+// replayAsRelay listens on addr and answers each client connection, in order, with the messages recorded
+// for the corresponding connection, flagging when the client sends something different from what was recorded.
+func replayAsRelay(ctx context.Context, entries []sessionEntry, addr string, report func(string)) error {
+	conns := sessionConnections(entries)
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	var mu sync.Mutex
+	next := 0
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !websocket.IsWebSocketUpgrade(r) {
+			http.Error(w, "this is a replayed relay session", http.StatusNotFound)
+			return
+		}
+
+		mu.Lock()
+		if next >= len(conns) {
+			mu.Unlock()
+			report("a client connected but there are no more recorded connections")
+			http.Error(w, "no more recorded connections", http.StatusServiceUnavailable)
+			return
+		}
+		conn := conns[next]
+		next++
+		mu.Unlock()
+
+		ws, err := wsUpgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+
+		id := conn[0].Conn
+		base := conn[0].Time
+		start := time.Now()
+		report(fmt.Sprintf("conn %d: client connected from %s", id, r.RemoteAddr))
+
+		expected := make([][]byte, 0, len(conn))
+		for _, entry := range conn {
+			if entry.Dir == "in" {
+				expected = append(expected, entry.payload())
+			}
+		}
+		connCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go func() {
+			defer cancel()
+			for i := 0; ; i++ {
+				_, msg, err := ws.ReadMessage()
+				if err != nil {
+					return
+				}
+				status := "✓"
+				if i >= len(expected) {
+					status = "✗ unexpected"
+				} else if string(expected[i]) != string(msg) {
+					status = "✗ recorded " + string(expected[i])
+				}
+				report(fmt.Sprintf("%6.2fs conn %d ➡️ %s %s", time.Since(start).Seconds(), id, msg, status))
+			}
+		}()
+
+		for _, entry := range conn {
+			switch entry.Dir {
+			case "out":
+				if !sleepUntil(connCtx, start, entry.Time-base) {
+					return
+				}
+				if err := ws.WriteMessage(websocket.TextMessage, entry.payload()); err != nil {
+					return
+				}
+				report(fmt.Sprintf("%6.2fs conn %d ⬅️ %s", time.Since(start).Seconds(), id, entry.payload()))
+			case "disconnect":
+				if !sleepUntil(connCtx, start, entry.Time-base) {
+					return
+				}
+				report(fmt.Sprintf("conn %d: closing as recorded", id))
+				ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+				return
+			}
+		}
+		<-connCtx.Done()
+	})}
+
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	if err := server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (serve *serveVars) saveSession() {
+	if serve.recorder == nil {
+		return
+	}
+	path := qt.QFileDialog_GetSaveFileName3(window.QWidget, "save session", "session.jsonl")
+	if path == "" {
+		return
+	}
+	if err := serve.recorder.save(path); err != nil {
+		serve.log("failed to save session: %s", err)
+		return
+	}
+	messages, connections := serve.recorder.summary()
+	serve.log("saved %d messages from %d connections to %s", messages, connections, path)
+}
+
+func openReplayDialog() {
+	dialog := qt.NewQDialog(window.QWidget)
+	dialog.SetWindowTitle("replay session")
+	dialog.SetMinimumWidth(800)
+	dialog.SetMinimumHeight(500)
+	layout := qt.NewQVBoxLayout2()
+	dialog.SetLayout(layout.QLayout)
+
+	form := qt.NewQFormLayout2()
+	layout.AddLayout(form.QLayout)
+
+	fileHBox := qt.NewQHBoxLayout2()
+	fileEdit := qt.NewQLineEdit(dialog.QWidget)
+	fileEdit.SetPlaceholderText("session file")
+	fileHBox.AddWidget(fileEdit.QWidget)
+	browseButton := qt.NewQPushButton5("browse...", dialog.QWidget)
+	fileHBox.AddWidget(browseButton.QWidget)
+	browseButton.OnClicked(func() {
+		if path := qt.QFileDialog_GetOpenFileName4(dialog.QWidget, "session file", "", "sessions (*.jsonl);;all files (*)"); path != "" {
+			fileEdit.SetText(path)
+		}
+	})
+	form.AddRow4("file:", fileHBox.QLayout)
+
+	modeCombo := qt.NewQComboBox(dialog.QWidget)
+	modeCombo.AddItem("as a client against a relay")
+	modeCombo.AddItem("as a relay for a client")
+	form.AddRow3("replay:", modeCombo.QWidget)
+
+	targetLabel := qt.NewQLabel2()
+	targetLabel.SetText("relay:")
+	targetEdit := qt.NewQLineEdit(dialog.QWidget)
+	targetEdit.SetPlaceholderText("ws://localhost:10547")
+	form.AddRow(targetLabel.QWidget, targetEdit.QWidget)
+	modeCombo.OnCurrentIndexChanged(func(index int) {
+		if index == 0 {
+			targetLabel.SetText("relay:")
+			targetEdit.SetPlaceholderText("ws://localhost:10547")
+		} else {
+			targetLabel.SetText("listen at:")
+			targetEdit.SetPlaceholderText("localhost:10548")
+		}
+	})
+
+	logList := qt.NewQListWidget(dialog.QWidget)
+	layout.AddWidget(logList.QWidget)
+	report := func(text string) {
+		mainthread.Start(func() {
+			logList.AddItem(text)
+			logList.ScrollToBottom()
+		})
+	}
+
+	buttonsHBox := qt.NewQHBoxLayout2()
+	layout.AddLayout(buttonsHBox.QLayout)
+	startButton := qt.NewQPushButton5("start", dialog.QWidget)
+	buttonsHBox.AddWidget(startButton.QWidget)
+	stopButton := qt.NewQPushButton5("stop", dialog.QWidget)
+	stopButton.SetEnabled(false)
+	buttonsHBox.AddWidget(stopButton.QWidget)
+	closeButton := qt.NewQPushButton5("close", dialog.QWidget)
+	buttonsHBox.AddWidget(closeButton.QWidget)
+
+	var cancel context.CancelFunc = func() {}
+	stopButton.OnClicked(func() { cancel() })
+	closeButton.OnClicked(func() { dialog.Close() })
+	startButton.OnClicked(func() {
+		entries, err := readSession(fileEdit.Text())
+		if err != nil {
+			report("failed to read session: " + err.Error())
+			return
+		}
+		target := strings.TrimSpace(targetEdit.Text())
+		if target == "" {
+			target = targetEdit.PlaceholderText()
+		}
+		asClient := modeCombo.CurrentIndex() == 0
+
+		logList.Clear()
+		report(fmt.Sprintf("replaying %d entries from %d connections", len(entries), len(sessionConnections(entries))))
+		startButton.SetEnabled(false)
+		stopButton.SetEnabled(true)
+
+		var replayCtx context.Context
+		replayCtx, cancel = context.WithCancel(ctx)
+		go func() {
+			if asClient {
+				replayAsClient(replayCtx, entries, target, report)
+			} else {
+				report("listening at ws://" + target)
+				if err := replayAsRelay(replayCtx, entries, target, report); err != nil {
+					report("failed: " + err.Error())
+				}
+			}
+			report("replay finished")
+			mainthread.Wait(func() {
+				startButton.SetEnabled(true)
+				stopButton.SetEnabled(false)
+			})
+		}()
+	})
+
+	dialog.Exec()
+	cancel()
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"fiatjaf.com/nostr"
+	qt "github.com/mappu/miqt/qt6"
+	"github.com/mappu/miqt/qt6/mainthread"
+)
+
+type signerVars struct {
+	statusButton *qt.QPushButton
+
+	dialog             *qt.QDialog
+	connectTimeoutSpin *qt.QSpinBox
+	signTimeoutSpin    *qt.QSpinBox
+	queueList          *qt.QListWidget
+
+	connectTimeout time.Duration
+	signTimeout    time.Duration
+	connectCancel  context.CancelFunc
+	connectAttempt int
+	bunkerCancel   context.CancelFunc
+	status         string
+	queue          []*signRequest
+	serial         int
+}
+
+type signRequest struct {
+	id      int
+	source  string
+	event   nostr.Event
+	started time.Time
+	status  string
+	cancel  context.CancelFunc
+}
+
+var signer = &signerVars{
+	connectTimeout: 15 * time.Second,
+	signTimeout:    60 * time.Second,
+}
+
+func (signer *signerVars) setupStatusButton(parent *qt.QWidget) *qt.QPushButton {
+	signer.statusButton = qt.NewQPushButton5("", parent)
+	signer.statusButton.SetFlat(true)
+	signer.statusButton.OnClicked(signer.openDialog)
+	signer.setStatus("no key")
+	return signer.statusButton
+}
+
+func (signer *signerVars) setStatus(status string) {
+	signer.status = status
+	signer.refresh()
+}
+
+// refresh updates the status indicator and the queue dialog, must be called from the main thread.
+func (signer *signerVars) refresh() {
+	pending := 0
+	for _, sr := range signer.queue {
+		if sr.status == "awaiting approval" {
+			pending++
+		}
+	}
+
+	text := "signer: " + signer.status
+	if pending > 0 {
+		text += fmt.Sprintf(" (awaiting approval: %d)", pending)
+	}
+	signer.statusButton.SetText(text)
+
+	if signer.queueList != nil {
+		row := signer.queueList.CurrentRow()
+		signer.queueList.Clear()
+		for _, sr := range signer.queue {
+			signer.queueList.AddItem(fmt.Sprintf("#%d [%s] kind %d from %s, %s ago",
+				sr.id, sr.status, sr.event.Kind, sr.source, time.Since(sr.started).Round(time.Second)))
+		}
+		if row < signer.queueList.Count() {
+			signer.queueList.SetCurrentRow(row)
+		}
+	}
+}
+
+// connectBunker connects to a bunker in the background, calling onConnected on the main thread
+// if that works. any previous connection attempt is canceled.
+func (signer *signerVars) connectBunker(bunkerURL string, onConnected func(nostr.Keyer)) {
+	signer.cancelConnect()
+	attempt := signer.connectAttempt
+
+	connectCtx, cancel := context.WithTimeoutCause(ctx, signer.connectTimeout,
+		fmt.Errorf("timed out after %s", signer.connectTimeout))
+	signer.connectCancel = cancel
+	signer.setStatus("connecting to bunker...")
+
+	go func() {
+		defer cancel()
+		kr, bunkerCancel, err := connectBunker(connectCtx, bunkerURL)
+		if cause := context.Cause(connectCtx); err != nil && cause != nil && cause != context.Canceled {
+			err = cause
+		}
+
+		mainthread.Wait(func() {
+			if attempt != signer.connectAttempt {
+				// superseded by another key or connection attempt
+				if bunkerCancel != nil {
+					bunkerCancel()
+				}
+				return
+			}
+			signer.connectCancel = nil
+			if err != nil {
+				signer.setStatus("failed: " + err.Error())
+				return
+			}
+			signer.bunkerCancel = bunkerCancel
+			signer.setStatus("bunker connected")
+			onConnected(kr)
+		})
+	}()
+}
+
+// cancelConnect aborts any ongoing bunker connection attempt and drops the connected bunker, if any.
+func (signer *signerVars) cancelConnect() {
+	signer.connectAttempt++
+	if signer.connectCancel != nil {
+		signer.connectCancel()
+		signer.connectCancel = nil
+	}
+	if signer.bunkerCancel != nil {
+		signer.bunkerCancel()
+		signer.bunkerCancel = nil
+	}
+}
+
+// sign enqueues evt for signing with currentKeyer and calls onSigned on the main thread when done.
+// pending requests from the same source are canceled since they have been superseded.
+func (signer *signerVars) sign(source string, evt nostr.Event, onSigned func(nostr.Event)) {
+	kr := currentKeyer
+	if kr == nil {
+		return
+	}
+
+	for _, sr := range signer.queue {
+		if sr.source == source && sr.status == "awaiting approval" {
+			sr.cancel()
+			sr.status = "superseded"
+		}
+	}
+
+	signCtx, cancel := context.WithTimeoutCause(ctx, signer.signTimeout,
+		fmt.Errorf("timed out after %s", signer.signTimeout))
+	signer.serial++
+	sr := &signRequest{
+		id:      signer.serial,
+		source:  source,
+		event:   evt,
+		started: time.Now(),
+		status:  "awaiting approval",
+		cancel:  cancel,
+	}
+	signer.queue = append(signer.queue, sr)
+	if len(signer.queue) > 50 {
+		signer.queue = signer.queue[len(signer.queue)-50:]
+	}
+	signer.refresh()
+
+	go func() {
+		defer cancel()
+		err := kr.SignEvent(signCtx, &evt)
+		if cause := context.Cause(signCtx); err != nil && cause != nil {
+			err = cause
+		}
+
+		mainthread.Wait(func() {
+			if sr.status != "awaiting approval" {
+				// canceled or superseded, ignore whatever came back
+				signer.refresh()
+				return
+			}
+			if err != nil {
+				sr.status = "failed: " + err.Error()
+				statusLabel.SetText("failed to sign: " + err.Error())
+			} else {
+				sr.status = "signed"
+			}
+			signer.refresh()
+			if err == nil {
+				onSigned(evt)
+			}
+		})
+	}()
+}
+
+func (signer *signerVars) openDialog() {
+	if signer.dialog != nil {
+		signer.refresh()
+		signer.dialog.Show()
+		signer.dialog.ActivateWindow()
+		return
+	}
+
+	signer.dialog = qt.NewQDialog(window.QWidget)
+	signer.dialog.SetWindowTitle("signer")
+	signer.dialog.SetMinimumWidth(550)
+	signer.dialog.SetMinimumHeight(400)
+	layout := qt.NewQVBoxLayout2()
+	signer.dialog.SetLayout(layout.QLayout)
+
+	// timeouts
+	timeoutsHBox := qt.NewQHBoxLayout2()
+	layout.AddLayout(timeoutsHBox.QLayout)
+	connectTimeoutLabel := qt.NewQLabel2()
+	connectTimeoutLabel.SetText("bunker connect timeout:")
+	timeoutsHBox.AddWidget(connectTimeoutLabel.QWidget)
+	signer.connectTimeoutSpin = qt.NewQSpinBox(signer.dialog.QWidget)
+	signer.connectTimeoutSpin.SetRange(1, 600)
+	signer.connectTimeoutSpin.SetSuffix("s")
+	signer.connectTimeoutSpin.SetValue(int(signer.connectTimeout / time.Second))
+	timeoutsHBox.AddWidget(signer.connectTimeoutSpin.QWidget)
+	signer.connectTimeoutSpin.OnValueChanged(func(v int) {
+		signer.connectTimeout = time.Duration(v) * time.Second
+	})
+	signTimeoutLabel := qt.NewQLabel2()
+	signTimeoutLabel.SetText("sign timeout:")
+	timeoutsHBox.AddWidget(signTimeoutLabel.QWidget)
+	signer.signTimeoutSpin = qt.NewQSpinBox(signer.dialog.QWidget)
+	signer.signTimeoutSpin.SetRange(1, 3600)
+	signer.signTimeoutSpin.SetSuffix("s")
+	signer.signTimeoutSpin.SetValue(int(signer.signTimeout / time.Second))
+	timeoutsHBox.AddWidget(signer.signTimeoutSpin.QWidget)
+	signer.signTimeoutSpin.OnValueChanged(func(v int) {
+		signer.signTimeout = time.Duration(v) * time.Second
+	})
+
+	// queue
+	queueLabel := qt.NewQLabel2()
+	queueLabel.SetText("signature requests:")
+	layout.AddWidget(queueLabel.QWidget)
+	signer.queueList = qt.NewQListWidget(signer.dialog.QWidget)
+	layout.AddWidget(signer.queueList.QWidget)
+	detailsEdit := qt.NewQTextEdit(signer.dialog.QWidget)
+	detailsEdit.SetReadOnly(true)
+	detailsEdit.SetMaximumHeight(150)
+	layout.AddWidget(detailsEdit.QWidget)
+	signer.queueList.OnCurrentRowChanged(func(row int) {
+		if row < 0 || row >= len(signer.queue) {
+			detailsEdit.SetPlainText("")
+			return
+		}
+		detailsEdit.SetPlainText(signer.queue[row].event.String())
+	})
+
+	buttonsHBox := qt.NewQHBoxLayout2()
+	layout.AddLayout(buttonsHBox.QLayout)
+	cancelButton := qt.NewQPushButton5("cancel selected", signer.dialog.QWidget)
+	buttonsHBox.AddWidget(cancelButton.QWidget)
+	cancelButton.OnClicked(func() {
+		if row := signer.queueList.CurrentRow(); row >= 0 && row < len(signer.queue) {
+			signer.cancelRequest(signer.queue[row])
+		}
+	})
+	cancelAllButton := qt.NewQPushButton5("cancel all", signer.dialog.QWidget)
+	buttonsHBox.AddWidget(cancelAllButton.QWidget)
+	cancelAllButton.OnClicked(func() {
+		for _, sr := range signer.queue {
+			signer.cancelRequest(sr)
+		}
+	})
+	clearButton := qt.NewQPushButton5("clear finished", signer.dialog.QWidget)
+	buttonsHBox.AddWidget(clearButton.QWidget)
+	clearButton.OnClicked(func() {
+		remaining := signer.queue[:0]
+		for _, sr := range signer.queue {
+			if sr.status == "awaiting approval" {
+				remaining = append(remaining, sr)
+			}
+		}
+		signer.queue = remaining
+		signer.refresh()
+	})
+	closeButton := qt.NewQPushButton5("close", signer.dialog.QWidget)
+	buttonsHBox.AddWidget(closeButton.QWidget)
+	closeButton.OnClicked(func() { signer.dialog.Close() })
+
+	signer.refresh()
+	signer.dialog.Show()
+}
+
+func (signer *signerVars) cancelRequest(sr *signRequest) {
+	if sr.status != "awaiting approval" {
+		return
+	}
+	sr.cancel()
+	sr.status = "canceled"
+	signer.refresh()
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"fiatjaf.com/nostr"
+	"fiatjaf.com/nostr/nip19"
+	qt "github.com/mappu/miqt/qt6"
+	"github.com/mappu/miqt/qt6/mainthread"
+)
+
+type threadNode struct {
+	ref      string
+	evt      *nostr.Event
+	children []*threadNode
+}
+
+// threadRoot returns the id or address of the root of the thread evt is in, and a relay hint for it.
+func threadRoot(evt nostr.Event) (ref string, hint string) {
+	var tag nostr.Tag
+	if evt.Kind == nostr.KindComment {
+		if tag = evt.Tags.Find("E"); tag == nil {
+			tag = evt.Tags.Find("A")
+		}
+	} else if evt.Kind == 1 {
+		for _, t := range evt.Tags {
+			if len(t) >= 4 && t[0] == "e" && t[3] == "root" {
+				tag = t
+				break
+			}
+		}
+		if tag == nil {
+			tag = evt.Tags.Find("e")
+		}
+	}
+
+	if tag == nil {
+		if addr := address(evt); addr != "" {
+			return addr, ""
+		}
+		return evt.ID.Hex(), ""
+	}
+	if len(tag) >= 3 {
+		hint = tag[2]
+	}
+	return tag[1], hint
+}
+
+// threadParent returns the id or address evt is replying to, following nip22 for comments and nip10 for notes.
+func threadParent(evt nostr.Event) string {
+	if evt.Kind == nostr.KindComment {
+		if tag := evt.Tags.Find("e"); tag != nil {
+			return tag[1]
+		}
+		if tag := evt.Tags.Find("a"); tag != nil {
+			return tag[1]
+		}
+		return ""
+	}
+
+	var root, last nostr.Tag
+	for _, tag := range evt.Tags {
+		if len(tag) < 2 || tag[0] != "e" {
+			continue
+		}
+		if len(tag) >= 4 {
+			switch tag[3] {
+			case "reply":
+				return tag[1]
+			case "root":
+				root = tag
+				continue
+			case "mention":
+				continue
+			}
+		}
+		last = tag
+	}
+	// positional semantics: the last e tag is the parent
+	if last != nil {
+		return last[1]
+	}
+	if root != nil {
+		return root[1]
+	}
+	return ""
+}
+
+func (req *reqVars) relays() []string {
+	relays := make([]string, 0, len(req.relaysEdits))
+	for _, edit := range req.relaysEdits {
+		if url := strings.TrimSpace(edit.Text()); url != "" {
+			relays = append(relays, url)
+		}
+	}
+	return relays
+}
+
+func openThread(target nostr.Event, relays []string) {
+	rootRef, hint := threadRoot(target)
+	statusLabel.SetText("loading thread...")
+
+	go func() {
+		fetchCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+		defer cancel()
+
+		if hint != "" {
+			relays = append(relays, hint)
+		}
+		relays = append(relays, sys.FetchOutboxRelays(fetchCtx, target.PubKey, 3)...)
+		slices.Sort(relays)
+		relays = slices.Compact(relays)
+
+		events := map[nostr.ID]nostr.Event{target.ID: target}
+		filters := make([]nostr.Filter, 0, 3)
+		if strings.Contains(rootRef, ":") {
+			if pointer, err := nostr.EntityPointerFromTag(nostr.Tag{"a", rootRef}); err == nil {
+				filters = append(filters, pointer.AsFilter())
+			}
+			filters = append(filters,
+				nostr.Filter{Kinds: []nostr.Kind{1, nostr.KindComment}, Tags: nostr.TagMap{"a": []string{rootRef}}, Limit: 500},
+				nostr.Filter{Kinds: []nostr.Kind{nostr.KindComment}, Tags: nostr.TagMap{"A": []string{rootRef}}, Limit: 500},
+			)
+		} else {
+			if id, err := nostr.IDFromHex(rootRef); err == nil && id != target.ID {
+				filters = append(filters, nostr.Filter{IDs: []nostr.ID{id}})
+			}
+			filters = append(filters,
+				nostr.Filter{Kinds: []nostr.Kind{1, nostr.KindComment}, Tags: nostr.TagMap{"e": []string{rootRef}}, Limit: 500},
+				nostr.Filter{Kinds: []nostr.Kind{nostr.KindComment}, Tags: nostr.TagMap{"E": []string{rootRef}}, Limit: 500},
+			)
+		}
+		for _, filter := range filters {
+			for ie := range sys.Pool.FetchMany(fetchCtx, relays, filter, nostr.SubscriptionOptions{Label: "vnak-thread"}) {
+				events[ie.Event.ID] = ie.Event
+			}
+		}
+
+		mainthread.Wait(func() {
+			statusLabel.SetText("")
+			showThread(rootRef, events)
+		})
+	}()
+}
+
+func buildThread(rootRef string, events map[nostr.ID]nostr.Event) (root *threadNode, missing int) {
+	nodes := make(map[string]*threadNode, len(events))
+	root = &threadNode{ref: rootRef}
+	nodes[rootRef] = root
+	for id, evt := range events {
+		evt := evt
+		if id.Hex() == rootRef || address(evt) == rootRef {
+			root.evt = &evt
+			nodes[id.Hex()] = root
+			continue
+		}
+		nodes[id.Hex()] = &threadNode{ref: id.Hex(), evt: &evt}
+	}
+
+	sorted := make([]nostr.Event, 0, len(events))
+	for _, evt := range events {
+		sorted = append(sorted, evt)
+	}
+	slices.SortFunc(sorted, func(a, b nostr.Event) int { return int(a.CreatedAt - b.CreatedAt) })
+
+	for _, evt := range sorted {
+		node := nodes[evt.ID.Hex()]
+		if node == root {
+			continue
+		}
+		parentRef := threadParent(evt)
+		parent, ok := nodes[parentRef]
+		if parentRef == "" {
+			parent = root
+		} else if !ok {
+			// referenced but never found, keep it in the tree so it shows up
+			parent = &threadNode{ref: parentRef}
+			nodes[parentRef] = parent
+			root.children = append(root.children, parent)
+			missing++
+		}
+		parent.children = append(parent.children, node)
+	}
+	if root.evt == nil {
+		missing++
+	}
+
+	return root, missing
+}
+
+func showThread(rootRef string, events map[nostr.ID]nostr.Event) {
+	root, missing := buildThread(rootRef, events)
+
+	dialog := qt.NewQDialog(window.QWidget)
+	dialog.SetWindowTitle("thread")
+	dialog.SetMinimumWidth(900)
+	dialog.SetMinimumHeight(600)
+	layout := qt.NewQVBoxLayout2()
+	dialog.SetLayout(layout.QLayout)
+
+	summary := qt.NewQLabel2()
+	summary.SetText(fmt.Sprintf("%d events, %d missing, double-click to open in the paste tab", len(events), missing))
+	layout.AddWidget(summary.QWidget)
+
+	tree := qt.NewQTreeWidget(dialog.QWidget)
+	tree.SetColumnCount(3)
+	tree.SetHeaderLabels([]string{"author", "content", "date"})
+	layout.AddWidget(tree.QWidget)
+
+	missingBrush := qt.NewQBrush4(qt.Red)
+	itemsByAuthor := make(map[nostr.PubKey][]*qt.QTreeWidgetItem)
+	itemEvents := make(map[*qt.QTreeWidgetItem]nostr.Event)
+
+	var render func(node *threadNode, item *qt.QTreeWidgetItem)
+	render = func(node *threadNode, item *qt.QTreeWidgetItem) {
+		if node.evt == nil {
+			item.SetText(0, "?")
+			item.SetText(1, "missing event "+node.ref)
+			item.SetForeground(1, missingBrush)
+		} else {
+			content := strings.ReplaceAll(node.evt.Content, "\n", " ")
+			if len(content) > 200 {
+				content = content[0:200] + "…"
+			}
+			item.SetText(0, nip19.EncodeNpub(node.evt.PubKey)[0:16]+"…")
+			item.SetText(1, content)
+			item.SetToolTip(1, node.evt.Content)
+			item.SetText(2, node.evt.CreatedAt.Time().Format(time.DateTime))
+			itemsByAuthor[node.evt.PubKey] = append(itemsByAuthor[node.evt.PubKey], item)
+			itemEvents[item] = *node.evt
+		}
+		for _, child := range node.children {
+			render(child, qt.NewQTreeWidgetItem6(item))
+		}
+	}
+	rootItem := qt.NewQTreeWidgetItem3(tree)
+	render(root, rootItem)
+	tree.ExpandAll()
+
+	tree.OnItemDoubleClicked(func(item *qt.QTreeWidgetItem, column int) {
+		if evt, ok := itemEvents[item]; ok {
+			j, _ := json.Marshal(evt)
+			dialog.Close()
+			paste.inputEdit.SetPlainText(string(j))
+			tabWidget.SetCurrentIndex(tabIndexes.paste)
+		}
+	})
+
+	// resolve author names in the background
+	nameCtx, cancel := context.WithCancel(ctx)
+	for pk, items := range itemsByAuthor {
+		go func() {
+			pm := sys.FetchProfileMetadata(nameCtx, pk)
+			if pm.Event == nil {
+				return
+			}
+			mainthread.Wait(func() {
+				if nameCtx.Err() != nil {
+					return
+				}
+				for _, item := range items {
+					item.SetText(0, pm.ShortName())
+				}
+			})
+		}()
+	}
+
+	closeButton := qt.NewQPushButton5("close", dialog.QWidget)
+	closeButton.OnClicked(func() { dialog.Close() })
+	layout.AddWidget(closeButton.QWidget)
+
+	dialog.Exec()
+	cancel()
+}
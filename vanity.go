@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"fiatjaf.com/nostr"
+	"fiatjaf.com/nostr/nip19"
+	qt "github.com/mappu/miqt/qt6"
+	"github.com/mappu/miqt/qt6/mainthread"
+)
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+type vanityVars struct {
+	dialog       *qt.QDialog
+	prefixEdit   *qt.QLineEdit
+	suffixEdit   *qt.QLineEdit
+	searchButton *qt.QPushButton
+	progressText *qt.QLabel
+
+	onFound func(nostr.SecretKey)
+	cancel  context.CancelFunc
+	serial  int // bumped when the dialog closes so a late result isn't used
+}
+
+var vanity = &vanityVars{}
+
+func (vanity *vanityVars) open(onFound func(nostr.SecretKey)) {
+	vanity.onFound = onFound
+
+	if vanity.dialog != nil {
+		vanity.dialog.Show()
+		vanity.dialog.ActivateWindow()
+		return
+	}
+
+	vanity.dialog = qt.NewQDialog(window.QWidget)
+	vanity.dialog.SetWindowTitle("vanity npub")
+	vanity.dialog.SetMinimumWidth(450)
+	layout := qt.NewQVBoxLayout2()
+	vanity.dialog.SetLayout(layout.QLayout)
+
+	// prefix and suffix
+	prefixHBox := qt.NewQHBoxLayout2()
+	layout.AddLayout(prefixHBox.QLayout)
+	prefixLabel := qt.NewQLabel2()
+	prefixLabel.SetText("npub1")
+	prefixHBox.AddWidget(prefixLabel.QWidget)
+	vanity.prefixEdit = qt.NewQLineEdit(vanity.dialog.QWidget)
+	vanity.prefixEdit.SetPlaceholderText("prefix")
+	prefixHBox.AddWidget(vanity.prefixEdit.QWidget)
+	dotsLabel := qt.NewQLabel2()
+	dotsLabel.SetText("...")
+	prefixHBox.AddWidget(dotsLabel.QWidget)
+	vanity.suffixEdit = qt.NewQLineEdit(vanity.dialog.QWidget)
+	vanity.suffixEdit.SetPlaceholderText("suffix")
+	prefixHBox.AddWidget(vanity.suffixEdit.QWidget)
+
+	charsetLabel := qt.NewQLabel2()
+	charsetLabel.SetText("allowed characters: " + bech32Charset)
+	layout.AddWidget(charsetLabel.QWidget)
+
+	// progress
+	vanity.progressText = qt.NewQLabel2()
+	layout.AddWidget(vanity.progressText.QWidget)
+
+	// buttons
+	buttonsHBox := qt.NewQHBoxLayout2()
+	layout.AddLayout(buttonsHBox.QLayout)
+	vanity.searchButton = qt.NewQPushButton5("search", vanity.dialog.QWidget)
+	buttonsHBox.AddWidget(vanity.searchButton.QWidget)
+	closeButton := qt.NewQPushButton5("close", vanity.dialog.QWidget)
+	buttonsHBox.AddWidget(closeButton.QWidget)
+
+	vanity.searchButton.OnClicked(func() {
+		if vanity.cancel != nil {
+			vanity.cancel()
+			return
+		}
+
+		prefix := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(vanity.prefixEdit.Text())), "npub1")
+		suffix := strings.ToLower(strings.TrimSpace(vanity.suffixEdit.Text()))
+		if prefix == "" && suffix == "" {
+			vanity.progressText.SetText("type a prefix or a suffix")
+			return
+		}
+		for _, c := range prefix + suffix {
+			if !strings.ContainsRune(bech32Charset, c) {
+				vanity.progressText.SetText(fmt.Sprintf("'%c' can't appear in an npub", c))
+				return
+			}
+		}
+		if len(prefix) > 52 || len(suffix) > 58 {
+			vanity.progressText.SetText("too long")
+			return
+		}
+
+		vanity.search(prefix, suffix)
+	})
+	closeButton.OnClicked(func() { vanity.dialog.Close() })
+	vanity.dialog.OnFinished(func(int) {
+		vanity.serial++
+		if vanity.cancel != nil {
+			vanity.cancel()
+		}
+	})
+
+	vanity.dialog.Show()
+}
+
+func (vanity *vanityVars) search(prefix string, suffix string) {
+	searchCtx, cancel := context.WithCancel(ctx)
+	vanity.cancel = cancel
+	serial := vanity.serial
+	vanity.searchButton.SetText("cancel")
+	vanity.prefixEdit.SetEnabled(false)
+	vanity.suffixEdit.SetEnabled(false)
+
+	cores := runtime.NumCPU()
+	expected := math.Pow(32, float64(len(prefix)+len(suffix)))
+	vanity.progressText.SetText(fmt.Sprintf("searching on %d cores, ~%.0f attempts expected", cores, expected))
+
+	attempts := atomic.Uint64{}
+	found := make(chan nostr.SecretKey, 1)
+	for range cores {
+		go func() {
+			for searchCtx.Err() == nil {
+				sk := nostr.Generate()
+				npub := nip19.EncodeNpub(nostr.GetPublicKey(sk))
+				attempts.Add(1)
+				if strings.HasPrefix(npub[5:], prefix) && strings.HasSuffix(npub, suffix) {
+					select {
+					case found <- sk:
+						cancel()
+					default:
+					}
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		start := time.Now()
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+
+		finish := func(text string) {
+			mainthread.Wait(func() {
+				vanity.cancel = nil
+				vanity.searchButton.SetText("search")
+				vanity.prefixEdit.SetEnabled(true)
+				vanity.suffixEdit.SetEnabled(true)
+				vanity.progressText.SetText(text)
+			})
+		}
+
+		for {
+			select {
+			case <-ticker.C:
+				n := attempts.Load()
+				elapsed := time.Since(start)
+				rate := float64(n) / elapsed.Seconds()
+				eta := "any moment now"
+				if remaining := expected - float64(n); remaining > 0 && rate > 0 {
+					// anything longer wouldn't fit in a time.Duration anyway
+					if seconds := remaining / rate; seconds > 100*365*24*60*60 {
+						eta = "> 100 years"
+					} else {
+						eta = "~" + time.Duration(seconds*float64(time.Second)).Round(time.Second).String()
+					}
+				}
+				mainthread.Wait(func() {
+					vanity.progressText.SetText(fmt.Sprintf("%d attempts, %.0f/s, elapsed %s, eta %s",
+						n, rate, elapsed.Round(time.Second), eta))
+				})
+			case <-searchCtx.Done():
+				select {
+				case sk := <-found:
+					finish(fmt.Sprintf("found after %d attempts in %s", attempts.Load(), time.Since(start).Round(time.Second)))
+					mainthread.Wait(func() {
+						if serial == vanity.serial && vanity.onFound != nil {
+							vanity.onFound(sk)
+						}
+					})
+				default:
+					finish(fmt.Sprintf("canceled after %d attempts", attempts.Load()))
+				}
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,569 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"fiatjaf.com/nostr"
+	"fiatjaf.com/nostr/nip19"
+	"github.com/btcsuite/btcd/btcutil/bech32"
+	qt "github.com/mappu/miqt/qt6"
+	"github.com/mappu/miqt/qt6/mainthread"
+)
+
+type bolt11Invoice struct {
+	network         string
+	msats           uint64
+	hasAmount       bool
+	timestamp       int64
+	paymentHash     string
+	descriptionHash string
+	description     string
+}
+
+// parseBolt11 decodes just enough of a bolt11 invoice to check zaps, it doesn't verify the signature.
+func parseBolt11(invoice string) (bolt11Invoice, error) {
+	var inv bolt11Invoice
+	invoice = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(invoice), "lightning:"))
+	hrp, data, err := bech32.DecodeNoLimit(invoice)
+	if err != nil {
+		return inv, err
+	}
+	if !strings.HasPrefix(hrp, "ln") {
+		return inv, fmt.Errorf("not a lightning invoice")
+	}
+
+	rest := hrp[2:]
+	for _, network := range []string{"bcrt", "tbs", "bc", "tb", "sb"} {
+		if strings.HasPrefix(rest, network) {
+			inv.network = network
+			rest = rest[len(network):]
+			break
+		}
+	}
+	if rest != "" {
+		digits := rest
+		multiplier := rest[len(rest)-1]
+		if multiplier >= 'a' && multiplier <= 'z' {
+			digits = rest[:len(rest)-1]
+		}
+		n, err := strconv.ParseUint(digits, 10, 64)
+		if err != nil {
+			return inv, fmt.Errorf("invalid amount %q", rest)
+		}
+		switch multiplier {
+		case 'm':
+			inv.msats = n * 100_000_000
+		case 'u':
+			inv.msats = n * 100_000
+		case 'n':
+			inv.msats = n * 100
+		case 'p':
+			inv.msats = n / 10
+		default:
+			inv.msats = n * 100_000_000_000
+		}
+		inv.hasAmount = true
+	}
+
+	// 35 bits of timestamp, then tagged fields, then the 520 bits signature
+	if len(data) < 7+104 {
+		return inv, fmt.Errorf("invoice too short")
+	}
+	for i := 0; i < 7; i++ {
+		inv.timestamp = inv.timestamp<<5 | int64(data[i])
+	}
+	fields := data[7 : len(data)-104]
+	for len(fields) >= 3 {
+		kind := fields[0]
+		length := int(fields[1])<<5 | int(fields[2])
+		fields = fields[3:]
+		if length > len(fields) {
+			return inv, fmt.Errorf("broken tagged field")
+		}
+		value, _ := bech32.ConvertBits(fields[:length], 5, 8, false)
+		fields = fields[length:]
+
+		switch kind {
+		case 1:
+			inv.paymentHash = hex.EncodeToString(value)
+		case 13:
+			inv.description = string(value)
+		case 23:
+			inv.descriptionHash = hex.EncodeToString(value)
+		}
+	}
+
+	return inv, nil
+}
+
+type lnurlPayParams struct {
+	Callback    string `json:"callback"`
+	MinSendable uint64 `json:"minSendable"`
+	MaxSendable uint64 `json:"maxSendable"`
+	AllowsNostr bool   `json:"allowsNostr"`
+	NostrPubkey string `json:"nostrPubkey"`
+	Tag         string `json:"tag"`
+}
+
+// lnurlEndpoint takes a lightning address, an lnurl1 or an url and returns the url to call.
+func lnurlEndpoint(value string) (string, error) {
+	value = strings.TrimPrefix(strings.TrimSpace(value), "lightning:")
+	if name, domain, ok := strings.Cut(value, "@"); ok {
+		return "https://" + domain + "/.well-known/lnurlp/" + name, nil
+	}
+	if strings.HasPrefix(strings.ToLower(value), "lnurl1") {
+		_, data, err := bech32.DecodeNoLimit(strings.ToLower(value))
+		if err != nil {
+			return "", err
+		}
+		decoded, err := bech32.ConvertBits(data, 5, 8, false)
+		if err != nil {
+			return "", err
+		}
+		return string(decoded), nil
+	}
+	if strings.HasPrefix(value, "https://") || strings.HasPrefix(value, "http://") {
+		return value, nil
+	}
+	return "", fmt.Errorf("expected a lightning address, lnurl or url")
+}
+
+func encodeLnurl(endpoint string) string {
+	lnurl, _ := bech32.EncodeFromBase256("lnurl", []byte(endpoint))
+	return lnurl
+}
+
+func fetchLnurlPay(fetchCtx context.Context, endpoint string) (lnurlPayParams, error) {
+	var params lnurlPayParams
+	req, err := http.NewRequestWithContext(fetchCtx, "GET", endpoint, nil)
+	if err != nil {
+		return params, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return params, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return params, fmt.Errorf("%s returned %d", endpoint, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&params); err != nil {
+		return params, fmt.Errorf("invalid lnurl response: %w", err)
+	}
+	if params.Tag != "payRequest" {
+		return params, fmt.Errorf("not an lnurl-pay endpoint")
+	}
+	return params, nil
+}
+
+// zapRecipientEndpoint finds the lnurl endpoint of a pubkey through its profile.
+func zapRecipientEndpoint(fetchCtx context.Context, pk nostr.PubKey) (string, error) {
+	pm := sys.FetchProfileMetadata(fetchCtx, pk)
+	if pm.LUD16 != "" {
+		return lnurlEndpoint(pm.LUD16)
+	}
+	if pm.Event != nil {
+		var legacy struct {
+			LUD06 string `json:"lud06"`
+		}
+		if json.Unmarshal([]byte(pm.Event.Content), &legacy); legacy.LUD06 != "" {
+			return lnurlEndpoint(legacy.LUD06)
+		}
+	}
+	return "", fmt.Errorf("recipient has no lightning address in their profile")
+}
+
+type zapVars struct {
+	tab *qt.QWidget
+
+	targetEdit   *qt.QLineEdit
+	amountSpin   *qt.QSpinBox
+	relaysEdit   *qt.QLineEdit
+	lnurlEdit    *qt.QLineEdit
+	commentEdit  *qt.QLineEdit
+	requestEdit  *qt.QTextEdit
+	callbackEdit *qt.QLineEdit
+	invoiceEdit  *qt.QLineEdit
+	resultLabel  *qt.QLabel
+
+	request  *nostr.Event
+	callback string
+}
+
+var zap = &zapVars{}
+
+func setupZapTab() *qt.QWidget {
+	zap.tab = qt.NewQWidget(window.QWidget)
+	layout := qt.NewQVBoxLayout2()
+	zap.tab.SetLayout(layout.QLayout)
+
+	addField := func(label string, widget *qt.QWidget) {
+		hbox := qt.NewQHBoxLayout2()
+		layout.AddLayout(hbox.QLayout)
+		l := qt.NewQLabel2()
+		l.SetText(label)
+		l.SetMinimumWidth(80)
+		hbox.AddWidget(l.QWidget)
+		hbox.AddWidget(widget)
+	}
+
+	zap.targetEdit = qt.NewQLineEdit(zap.tab)
+	zap.targetEdit.SetPlaceholderText("npub, nprofile, nevent, naddr, note or nip05")
+	addField("target:", zap.targetEdit.QWidget)
+	zap.amountSpin = qt.NewQSpinBox(zap.tab)
+	zap.amountSpin.SetRange(1, 100_000_000)
+	zap.amountSpin.SetValue(21)
+	zap.amountSpin.SetSuffix(" sats")
+	addField("amount:", zap.amountSpin.QWidget)
+	zap.relaysEdit = qt.NewQLineEdit(zap.tab)
+	zap.relaysEdit.SetPlaceholderText("relays where the receipt should be published, defaults to your write relays")
+	addField("relays:", zap.relaysEdit.QWidget)
+	zap.lnurlEdit = qt.NewQLineEdit(zap.tab)
+	zap.lnurlEdit.SetPlaceholderText("lightning address, lnurl or url, taken from the recipient profile if empty")
+	addField("lnurl:", zap.lnurlEdit.QWidget)
+	zap.commentEdit = qt.NewQLineEdit(zap.tab)
+	addField("comment:", zap.commentEdit.QWidget)
+
+	buildButton := qt.NewQPushButton5("build zap request", zap.tab)
+	layout.AddWidget(buildButton.QWidget)
+	buildButton.OnClicked(zap.build)
+
+	requestLabel := qt.NewQLabel2()
+	requestLabel.SetText("zap request (kind 9734):")
+	layout.AddWidget(requestLabel.QWidget)
+	zap.requestEdit = qt.NewQTextEdit(zap.tab)
+	zap.requestEdit.SetReadOnly(true)
+	layout.AddWidget(zap.requestEdit.QWidget)
+
+	callbackHBox := qt.NewQHBoxLayout2()
+	layout.AddLayout(callbackHBox.QLayout)
+	callbackLabel := qt.NewQLabel2()
+	callbackLabel.SetText("callback url:")
+	callbackHBox.AddWidget(callbackLabel.QWidget)
+	zap.callbackEdit = qt.NewQLineEdit(zap.tab)
+	zap.callbackEdit.SetReadOnly(true)
+	callbackHBox.AddWidget(zap.callbackEdit.QWidget)
+	copyButton := qt.NewQPushButton5("copy", zap.tab)
+	callbackHBox.AddWidget(copyButton.QWidget)
+	copyButton.OnClicked(func() {
+		qt.QGuiApplication_Clipboard().SetText(zap.callbackEdit.Text())
+	})
+	invoiceButton := qt.NewQPushButton5("fetch invoice", zap.tab)
+	callbackHBox.AddWidget(invoiceButton.QWidget)
+	invoiceButton.OnClicked(zap.fetchInvoice)
+
+	zap.invoiceEdit = qt.NewQLineEdit(zap.tab)
+	zap.invoiceEdit.SetReadOnly(true)
+	zap.invoiceEdit.SetPlaceholderText("invoice")
+	layout.AddWidget(zap.invoiceEdit.QWidget)
+
+	zap.resultLabel = qt.NewQLabel2()
+	zap.resultLabel.SetWordWrap(true)
+	layout.AddWidget(zap.resultLabel.QWidget)
+
+	return zap.tab
+}
+
+func (zap *zapVars) build() {
+	if currentKeyer == nil {
+		zap.resultLabel.SetText("no key loaded")
+		return
+	}
+	target := strings.TrimSpace(zap.targetEdit.Text())
+	if target == "" {
+		zap.resultLabel.SetText("no target specified")
+		return
+	}
+	msats := uint64(zap.amountSpin.Value()) * 1000
+	lnurlInput := strings.TrimSpace(zap.lnurlEdit.Text())
+	relays := parseRelays(zap.relaysEdit.Text())
+	comment := zap.commentEdit.Text()
+
+	zap.request = nil
+	zap.callback = ""
+	zap.requestEdit.SetPlainText("")
+	zap.callbackEdit.SetText("")
+	zap.invoiceEdit.SetText("")
+	zap.resultLabel.SetText("resolving recipient...")
+
+	go func() {
+		resolveCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+		defer cancel()
+
+		evt := nostr.Event{
+			Kind:      9734,
+			CreatedAt: nostr.Now(),
+			Content:   comment,
+			Tags:      nostr.Tags{{"amount", strconv.FormatUint(msats, 10)}},
+		}
+
+		// figure out who and what is being zapped
+		var recipient nostr.PubKey
+		var err error
+		if prefix, decoded, decodeErr := nip19.Decode(target); decodeErr == nil && (prefix == "nevent" || prefix == "naddr" || prefix == "note") {
+			switch v := decoded.(type) {
+			case nostr.EventPointer:
+				evt.Tags = append(evt.Tags, nostr.Tag{"e", v.ID.Hex()})
+				recipient = v.Author
+				if recipient == nostr.ZeroPK {
+					if ie := sys.Pool.QuerySingle(resolveCtx, append(v.Relays, sys.FallbackRelays.URLs...), nostr.Filter{IDs: []nostr.ID{v.ID}}, nostr.SubscriptionOptions{Label: "vnak-zap"}); ie != nil {
+						recipient = ie.Event.PubKey
+						evt.Tags = append(evt.Tags, nostr.Tag{"k", strconv.Itoa(int(ie.Event.Kind))})
+					}
+				}
+			case nostr.ID:
+				evt.Tags = append(evt.Tags, nostr.Tag{"e", v.Hex()})
+				if ie := sys.Pool.QuerySingle(resolveCtx, sys.FallbackRelays.URLs, nostr.Filter{IDs: []nostr.ID{v}}, nostr.SubscriptionOptions{Label: "vnak-zap"}); ie != nil {
+					recipient = ie.Event.PubKey
+					evt.Tags = append(evt.Tags, nostr.Tag{"k", strconv.Itoa(int(ie.Event.Kind))})
+				}
+			case nostr.EntityPointer:
+				evt.Tags = append(evt.Tags, nostr.Tag{"a", v.AsTagReference()}, nostr.Tag{"k", strconv.Itoa(int(v.Kind))})
+				recipient = v.PublicKey
+			}
+			if recipient == nostr.ZeroPK {
+				err = fmt.Errorf("couldn't find the author of the target event")
+			}
+		} else {
+			recipient, err = parsePubKey(target)
+		}
+
+		endpoint := ""
+		if err == nil {
+			evt.Tags = append(evt.Tags, nostr.Tag{"p", recipient.Hex()})
+			if lnurlInput != "" {
+				endpoint, err = lnurlEndpoint(lnurlInput)
+			} else {
+				endpoint, err = zapRecipientEndpoint(resolveCtx, recipient)
+			}
+		}
+		var params lnurlPayParams
+		if err == nil {
+			params, err = fetchLnurlPay(resolveCtx, endpoint)
+		}
+		if err == nil && !params.AllowsNostr {
+			err = fmt.Errorf("%s doesn't support zaps (allowsNostr is not set)", endpoint)
+		}
+		if err == nil && (msats < params.MinSendable || msats > params.MaxSendable) {
+			err = fmt.Errorf("amount must be between %d and %d sats", params.MinSendable/1000, params.MaxSendable/1000)
+		}
+		if err == nil && len(relays) == 0 {
+			pk, _ := currentKeyer.GetPublicKey(resolveCtx)
+			relays = sys.FetchWriteRelays(resolveCtx, pk)
+		}
+
+		mainthread.Wait(func() {
+			if err != nil {
+				zap.resultLabel.SetText(err.Error())
+				return
+			}
+			evt.Tags = append(evt.Tags, append(nostr.Tag{"relays"}, relays...), nostr.Tag{"lnurl", encodeLnurl(endpoint)})
+
+			zap.resultLabel.SetText("signing...")
+			signer.sign("zap tab", evt, func(signed nostr.Event) {
+				zap.request = &signed
+				j, _ := json.Marshal(signed)
+				pretty, _ := json.MarshalIndent(signed, "", "  ")
+				zap.requestEdit.SetPlainText(string(pretty))
+
+				callback, err := url.Parse(params.Callback)
+				if err != nil {
+					zap.resultLabel.SetText("invalid callback url: " + err.Error())
+					return
+				}
+				query := callback.Query()
+				query.Set("amount", strconv.FormatUint(msats, 10))
+				query.Set("nostr", string(j))
+				query.Set("lnurl", encodeLnurl(endpoint))
+				callback.RawQuery = query.Encode()
+				zap.callback = callback.String()
+				zap.callbackEdit.SetText(zap.callback)
+
+				text := "zap request signed, the callback above is what a wallet would call to get the invoice"
+				if params.NostrPubkey != "" {
+					text += "\nreceipts should be signed by " + params.NostrPubkey
+				}
+				zap.resultLabel.SetText(text)
+			})
+		})
+	}()
+}
+
+func (zap *zapVars) fetchInvoice() {
+	if zap.request == nil || zap.callback == "" {
+		zap.resultLabel.SetText("build a zap request first")
+		return
+	}
+	callback := zap.callback
+	request := *zap.request
+	zap.resultLabel.SetText("fetching invoice...")
+
+	go func() {
+		fetchCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+		defer cancel()
+
+		var response struct {
+			PR     string `json:"pr"`
+			Status string `json:"status"`
+			Reason string `json:"reason"`
+		}
+		err := func() error {
+			req, err := http.NewRequestWithContext(fetchCtx, "GET", callback, nil)
+			if err != nil {
+				return err
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+			if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+				return fmt.Errorf("invalid response: %w", err)
+			}
+			if response.Status == "ERROR" {
+				return fmt.Errorf("%s", response.Reason)
+			}
+			return nil
+		}()
+
+		mainthread.Wait(func() {
+			if err != nil {
+				zap.resultLabel.SetText("failed to get invoice: " + err.Error())
+				return
+			}
+			zap.invoiceEdit.SetText(response.PR)
+
+			// the invoice must commit to the zap request we sent
+			inv, err := parseBolt11(response.PR)
+			if err != nil {
+				zap.resultLabel.SetText("got an invalid invoice: " + err.Error())
+				return
+			}
+			j, _ := json.Marshal(request)
+			hash := sha256.Sum256(j)
+			checks := []string{}
+			if inv.descriptionHash == hex.EncodeToString(hash[:]) {
+				checks = append(checks, "✓ description hash matches the zap request")
+			} else {
+				checks = append(checks, "✗ description hash doesn't match the zap request")
+			}
+			if amount := request.Tags.Find("amount"); amount != nil && inv.hasAmount && amount[1] == strconv.FormatUint(inv.msats, 10) {
+				checks = append(checks, "✓ invoice amount matches")
+			} else {
+				checks = append(checks, fmt.Sprintf("✗ invoice amount is %d msats", inv.msats))
+			}
+			zap.resultLabel.SetText(strings.Join(checks, "\n"))
+		})
+	}()
+}
+
+func (p *pasteVars) displayZapReceipt(receipt nostr.Event) {
+	addCheck := func(ok bool, text string) {
+		label := qt.NewQLabel2()
+		label.SetWordWrap(true)
+		if ok {
+			label.SetText("✓ " + text)
+		} else {
+			label.SetText("✗ " + text)
+		}
+		p.outputVBox.AddWidget(label.QWidget)
+	}
+
+	title := qt.NewQLabel2()
+	title.SetText("zap receipt:")
+	p.outputVBox.AddWidget(title.QWidget)
+
+	addCheck(receipt.CheckID() && receipt.VerifySignature(), "receipt id and signature")
+
+	bolt11Tag := receipt.Tags.Find("bolt11")
+	if bolt11Tag == nil {
+		addCheck(false, "missing bolt11 tag")
+		return
+	}
+	inv, err := parseBolt11(bolt11Tag[1])
+	if err != nil {
+		addCheck(false, "invalid bolt11: "+err.Error())
+		return
+	}
+	addCheck(inv.hasAmount, fmt.Sprintf("invoice amount: %d sats", inv.msats/1000))
+
+	descriptionTag := receipt.Tags.Find("description")
+	if descriptionTag == nil {
+		addCheck(false, "missing description tag with the zap request")
+		return
+	}
+	var request nostr.Event
+	if err := json.Unmarshal([]byte(descriptionTag[1]), &request); err != nil {
+		addCheck(false, "description is not a valid event: "+err.Error())
+		return
+	}
+	addCheck(request.Kind == 9734, fmt.Sprintf("embedded zap request is kind %d", request.Kind))
+	addCheck(request.CheckID() && request.VerifySignature(), "zap request id and signature, sent by "+nip19.EncodeNpub(request.PubKey))
+
+	hash := sha256.Sum256([]byte(descriptionTag[1]))
+	addCheck(inv.descriptionHash == hex.EncodeToString(hash[:]), "invoice description hash commits to the zap request")
+	if amount := request.Tags.Find("amount"); amount != nil {
+		addCheck(amount[1] == strconv.FormatUint(inv.msats, 10), fmt.Sprintf("zap request asked for %s msats, invoice has %d", amount[1], inv.msats))
+	}
+	for _, name := range []string{"p", "e", "a"} {
+		requestTag := request.Tags.Find(name)
+		receiptTag := receipt.Tags.Find(name)
+		if requestTag == nil && receiptTag == nil {
+			continue
+		}
+		addCheck(requestTag != nil && receiptTag != nil && requestTag[1] == receiptTag[1], fmt.Sprintf("%q tag is the same in receipt and request", name))
+	}
+	if senderTag := receipt.Tags.Find("P"); senderTag != nil {
+		addCheck(senderTag[1] == request.PubKey.Hex(), "\"P\" tag matches the zap request author")
+	}
+
+	// the receipt must be signed by the recipient's lnurl server
+	recipientTag := request.Tags.Find("p")
+	if recipientTag == nil {
+		return
+	}
+	recipient, err := nostr.PubKeyFromHex(recipientTag[1])
+	if err != nil {
+		return
+	}
+	lnurlTag := request.Tags.Find("lnurl")
+	if p.lookupCancel != nil {
+		p.lookupCancel()
+	}
+	lookupCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+	p.lookupCancel = cancel
+	go func() {
+		defer cancel()
+		var endpoint string
+		var err error
+		if lnurlTag != nil {
+			endpoint, err = lnurlEndpoint(lnurlTag[1])
+		} else {
+			endpoint, err = zapRecipientEndpoint(lookupCtx, recipient)
+		}
+		var params lnurlPayParams
+		if err == nil {
+			params, err = fetchLnurlPay(lookupCtx, endpoint)
+		}
+		mainthread.Wait(func() {
+			// checked here so a newer paste can't have replaced the output in the meantime
+			if lookupCtx.Err() == context.Canceled {
+				return
+			}
+			if err != nil {
+				addCheck(false, "couldn't check the receipt signer: "+err.Error())
+			} else {
+				addCheck(params.NostrPubkey == receipt.PubKey.Hex(), fmt.Sprintf("receipt signed by the lnurl server key (%s)", params.NostrPubkey))
+			}
+		})
+	}()
+}